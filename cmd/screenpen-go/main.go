@@ -1,42 +1,53 @@
 package main
 
 import (
-	"sync"
+	"flag"
+	"fmt"
+	"os"
 
 	"gioui.org/app"
+	"gioui.org/io/system"
 	"gioui.org/op"
 
 	internalApp "screenpengo/internal/app"
 )
 
 func main() {
-	var wg sync.WaitGroup
-	wg.Add(1)
+	dataDir := flag.String("dir", "", "directory for saved drawings (default $SCREENPEN_DIR or $XDG_DATA_HOME/screenpen)")
+	keys := flag.String("keys", "", "key bindings file (default $XDG_CONFIG_HOME/screenpen/keys.conf)")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [-dir directory] [-keys file] [file to import ...]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
 
 	go func() {
-		defer wg.Done()
-
 		w := new(app.Window)
 		w.Option(
 			app.Title("gio-screenpen"),
 			app.Decorated(false),
 		)
 
-		a := internalApp.New()
+		a := internalApp.New(*dataDir)
+		a.LoadKeyBindings(*keys)
+		a.ImportOnStart(flag.Args()...)
 
 		var ops op.Ops
 		for {
 			switch e := w.Event().(type) {
 			case app.DestroyEvent:
-				return
+				a.Close()
+				os.Exit(0)
 			case app.FrameEvent:
 				gtx := app.NewContext(&ops, e)
 				a.Frame(gtx)
 				e.Frame(gtx.Ops)
+				if a.QuitRequested() {
+					w.Perform(system.ActionClose)
+				}
 			}
 		}
 	}()
 
 	app.Main()
-	wg.Wait()
 }
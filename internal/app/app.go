@@ -1,63 +1,227 @@
 package app
 
 import (
+	"bytes"
+	"errors"
 	"image"
 	"image/color"
+	"io"
 	"os"
+	"path/filepath"
+	"time"
 
 	"gioui.org/f32"
+	"gioui.org/io/clipboard"
 	"gioui.org/io/event"
 	"gioui.org/io/key"
+	"gioui.org/io/transfer"
 	"gioui.org/layout"
 	"gioui.org/op"
 	"gioui.org/op/clip"
 	"gioui.org/widget/material"
 
 	"screenpengo/internal/canvas"
+	"screenpengo/internal/editor"
+	"screenpengo/internal/format"
 	"screenpengo/internal/input"
 	"screenpengo/internal/render"
+	"screenpengo/internal/replay"
+	"screenpengo/internal/session"
 	"screenpengo/internal/tool"
 	"screenpengo/internal/ui"
 )
 
+const (
+	gifScale         = 0.5
+	autosaveInterval = 15 * time.Second
+	// exportPollInterval is how often a frame checks on a running
+	// timelapse export.
+	exportPollInterval = 100 * time.Millisecond
+
+	// clipboardType is the only type Gio's clipboard carries. Drawings are
+	// copied as save-file JSON.
+	clipboardType = "application/text"
+)
+
+// Version is recorded in saved drawings. Release builds set it with
+// -ldflags "-X screenpengo/internal/app.Version=...".
+var Version = "dev"
+
 type App struct {
 	canvas   *canvas.Canvas
-	pen      *tool.PenConfig
-	shape    *tool.ShapeConfig
+	tools    *tool.State
 	keyboard *input.KeyboardHandler
 	pointer  *input.PointerHandler
 	renderer *render.GioRenderer
 	toolbar  *ui.Toolbar
 	theme    *material.Theme
+	player   *replay.Player
+	storage  canvas.Storage
+	dataDir  string
+
+	// active is the tool named in tools.Tool, made when it is first used.
+	active     editor.Tool
+	activeName string
+
+	// history holds the drawing as it was before each change, for undo.
+	history canvas.History
+	// documentName is the name the drawing was last saved or loaded under,
+	// which the save shortcut saves to without asking.
+	documentName string
+
+	// exportDone delivers the result of the timelapse export running in
+	// the background, and is nil when none is. Only one runs at a time.
+	exportDone chan error
+
+	session      *session.Session
+	recovered    *canvas.Canvas
+	lastAutosave time.Time
+	quit         bool
 
 	cursorPos  f32.Point
 	showCursor bool
-	isErasing  bool
+
+	// selection is what the move tool grabbed or was inserted last, which
+	// is what gets copied. placing is set right after an insert: the new
+	// group follows the cursor until the next click drops it.
+	selection editor.Selection
+	placing   bool
+
+	// pendingImports are files given on the command line. They are read on
+	// the first frame, once the screen size is known.
+	pendingImports []string
 
 	keyTag struct{}
 	ptrTag struct{}
 }
 
-func New() *App {
+// New creates the application. Drawings are kept in dataDir, or in
+// canvas.DataDir when it is empty.
+func New(dataDir string) *App {
 	theme := material.NewTheme()
-	return &App{
-		canvas: &canvas.Canvas{},
-		pen: &tool.PenConfig{
-			Color:       color.NRGBA{R: 255, A: 255},
-			WidthDp:     6,
-			ColorPreset: tool.Red,
-			WidthPreset: tool.Medium,
-		},
-		shape: &tool.ShapeConfig{
-			Type:   tool.NoShape,
-			Active: false,
-		},
+	storage, dataDir := openStorage(dataDir)
+	location := dataDir
+	if location == "" {
+		location = "memory (lost on exit)"
+	}
+	tools := tool.NewState()
+	a := &App{
+		canvas:   &canvas.Canvas{},
+		tools:    tools,
 		keyboard: input.NewKeyboardHandler(),
 		pointer:  input.NewPointerHandler(),
-		renderer: &render.GioRenderer{},
-		toolbar:  ui.NewToolbar(theme),
+		renderer: &render.GioRenderer{Shaper: theme.Shaper},
+		toolbar:  ui.NewToolbar(theme, tools, storage, location),
 		theme:    theme,
+		storage:  storage,
+		dataDir:  dataDir,
+	}
+	a.openSession()
+	return a
+}
+
+// openStorage falls back to keeping drawings in memory, so that a missing or
+// read-only data directory does not stop the program from starting.
+func openStorage(dataDir string) (canvas.Storage, string) {
+	var err error
+	if dataDir == "" {
+		dataDir, err = canvas.DataDir()
+	}
+	if err == nil {
+		var storage *canvas.FileStorage
+		if storage, err = canvas.NewFileStorage(dataDir); err == nil {
+			return storage, dataDir
+		}
+	}
+	println("Drawings will not be saved to disk:", err.Error())
+	return canvas.NewMemoryStorage(), ""
+}
+
+func (a *App) openSession() {
+	if a.dataDir == "" {
+		return
+	}
+	var err error
+	a.session, a.recovered, err = session.Open(a.dataDir)
+	if err != nil {
+		println("Autosave disabled:", err.Error())
+		return
+	}
+	// A drawing with nothing on it, not even a text, is not worth offering.
+	if a.recovered != nil {
+		if _, _, ok := a.recovered.ContentBounds(); ok {
+			a.toolbar.OfferRecovery()
+			return
+		}
+	}
+	a.recovered = nil
+}
+
+// LoadKeyBindings replaces the default hotkeys with those in path, or in
+// input.KeymapPath when path is empty. Problems with the file are printed;
+// the bindings that are fine still apply.
+func (a *App) LoadKeyBindings(path string) {
+	if path == "" {
+		var err error
+		if path, err = input.KeymapPath(); err != nil {
+			return
+		}
+	}
+	keymap, errs := input.LoadKeymap(path)
+	for _, err := range errs {
+		println("Key bindings:", err.Error())
+	}
+	a.keyboard.Keymap = keymap
+}
+
+// ImportOnStart adds the given files, in any format format.Import reads, to
+// the drawing when the window first appears. Files dropped on the program's
+// icon arrive this way.
+func (a *App) ImportOnStart(paths ...string) {
+	a.pendingImports = append(a.pendingImports, paths...)
+}
+
+func (a *App) importPending(gtx layout.Context) {
+	center := f32.Pt(float32(gtx.Constraints.Max.X)/2, float32(gtx.Constraints.Max.Y)/2)
+	for _, path := range a.pendingImports {
+		imported, err := format.Import(path)
+		if err != nil {
+			println("Cannot import:", err.Error())
+			continue
+		}
+		imported.FitTo(screenOf(gtx))
+		a.history.Push(a.canvas)
+		a.canvas.Insert(imported, center)
+		println("Imported " + path)
+	}
+	a.pendingImports = nil
+}
+
+// QuitRequested reports whether the user asked to close the program.
+func (a *App) QuitRequested() bool {
+	return a.quit
+}
+
+// Close ends the session cleanly so that the next start does not offer to
+// restore it.
+func (a *App) Close() {
+	if a.session != nil {
+		a.session.Close()
+	}
+}
+
+// autosave keeps going while a recovered drawing is on offer: the session
+// writes to its own file, and the crashed one's stays until it is restored or
+// discarded.
+func (a *App) autosave(gtx layout.Context) {
+	if a.session == nil {
+		return
+	}
+	if gtx.Now.Sub(a.lastAutosave) >= autosaveInterval {
+		a.session.Autosave(a.canvas)
+		a.lastAutosave = gtx.Now
 	}
+	gtx.Execute(op.InvalidateCmd{At: a.lastAutosave.Add(autosaveInterval)})
 }
 
 func (a *App) Frame(gtx layout.Context) {
@@ -67,7 +231,17 @@ func (a *App) Frame(gtx layout.Context) {
 	event.Op(gtx.Ops, &a.ptrTag)
 	area.Pop()
 
-	dialogOpen := a.toolbar.IsDialogOpen()
+	// Keep drawn sizes when the window moves to a display of another density.
+	screen := screenOf(gtx)
+	if old := a.canvas.Screen.PxPerDp; old > 0 && old != screen.PxPerDp {
+		a.canvas.Scale(screen.PxPerDp / old)
+	}
+	a.canvas.Screen = screen
+	if len(a.pendingImports) > 0 {
+		a.importPending(gtx)
+	}
+
+	dialogOpen := a.toolbar.IsDialogOpen(gtx)
 
 	if !dialogOpen {
 		event.Op(gtx.Ops, &a.keyTag)
@@ -78,17 +252,28 @@ func (a *App) Frame(gtx layout.Context) {
 	a.applyPointerActions(gtx)
 	if !dialogOpen {
 		a.applyKeyboardActions(gtx)
+		a.applyClipboard(gtx)
 	}
 	a.applyToolbarActions(gtx)
+	a.checkExport(gtx)
+	a.autosave(gtx)
+
+	visibleCanvas := a.canvas
+	if a.player != nil {
+		visibleCanvas = a.advanceReplay(gtx)
+	}
 
 	layout.Stack{}.Layout(gtx,
 		layout.Expanded(func(gtx layout.Context) layout.Dimensions {
-			cursorRadiusPixels := int(scaleToPixels(gtx, a.pen.WidthDp) / 2)
-			cursorPosPixels := image.Point{
-				X: int(a.cursorPos.X),
-				Y: int(a.cursorPos.Y),
+			a.renderer.RenderFrame(gtx, visibleCanvas)
+			if a.player == nil {
+				ctx := a.toolContext(gtx)
+				active := a.activeTool(ctx)
+				active.Preview(gtx, ctx)
+				if a.showCursor {
+					active.Cursor(gtx, ctx, a.cursorPos)
+				}
 			}
-			a.renderer.RenderFrame(gtx, a.canvas, cursorPosPixels, cursorRadiusPixels, a.showCursor)
 			return layout.Dimensions{Size: gtx.Constraints.Max}
 		}),
 		layout.Stacked(func(gtx layout.Context) layout.Dimensions {
@@ -99,68 +284,141 @@ func (a *App) Frame(gtx layout.Context) {
 
 func (a *App) applyPointerActions(gtx layout.Context) {
 	actions := a.pointer.HandleEvents(gtx, &a.ptrTag)
+	if a.player != nil {
+		return
+	}
 
+	ctx := a.toolContext(gtx)
+	active := a.activeTool(ctx)
 	for _, action := range actions {
+		if a.placing {
+			a.applyPlacingAction(action)
+			continue
+		}
 		switch action.Type {
 		case input.StartStroke:
-			widthInPixels := scaleToPixels(gtx, a.pen.WidthDp)
-
-			a.isErasing = (a.pen.ColorPreset == tool.Eraser)
-
-			if a.shape.Active {
-				a.canvas.StartShape(a.shape.Type, a.pen.Color, widthInPixels, action.Position)
-			} else {
-				a.canvas.StartStroke(a.pen.Color, widthInPixels, action.Position)
-			}
+			active.Press(ctx, action.Position)
 			a.showCursor = false
 		case input.AddPoint:
-			if a.shape.Active {
-				a.canvas.UpdateShape(action.Position)
-			} else {
-				a.canvas.AddPoint(action.Position)
-			}
+			active.Drag(ctx, action.Position)
 		case input.FinishStroke:
-			if a.shape.Active {
-				a.canvas.FinishShape()
-			} else {
-				a.canvas.FinishStroke()
-
-				if a.isErasing && len(a.canvas.Strokes) > 0 {
-					lastStroke := &a.canvas.Strokes[len(a.canvas.Strokes)-1]
-					a.canvas.RemoveShapesIntersectingStroke(lastStroke)
-				}
-			}
+			active.Release(ctx)
 			a.showCursor = true
-			a.isErasing = false
 		case input.MoveCursor:
-			a.cursorPos = action.Position
+			active.Hover(ctx, action.Position)
 			a.showCursor = true
 			gtx.Execute(op.InvalidateCmd{})
 		}
+		// Releases carry no position.
+		if action.Type != input.FinishStroke {
+			a.cursorPos = action.Position
+		}
 	}
 
-	if a.canvas.Current != nil || a.canvas.CurrentShape != nil {
+	if active.Busy(ctx) {
 		gtx.Execute(op.InvalidateCmd{})
 	}
 }
 
+// applyPlacingAction moves an inserted group with the cursor until a click
+// drops it.
+func (a *App) applyPlacingAction(action input.PointerAction) {
+	switch action.Type {
+	case input.StartStroke:
+		a.placing = false
+	case input.MoveCursor:
+		a.canvas.Move(a.selection.Selection, action.Position.Sub(a.cursorPos))
+	}
+	if action.Type != input.FinishStroke {
+		a.cursorPos = action.Position
+	}
+}
+
+func (a *App) toolContext(gtx layout.Context) *editor.Context {
+	return &editor.Context{
+		Canvas:    a.canvas,
+		State:     a.tools,
+		History:   &a.history,
+		Selection: &a.selection,
+		PxPerDp:   scaleToPixels(gtx, 1),
+	}
+}
+
+// activeTool returns the tool named in a.tools. When the toolbar or the
+// keyboard picked another one, the old tool drops what it was doing.
+func (a *App) activeTool(ctx *editor.Context) editor.Tool {
+	if a.active != nil && a.activeName == a.tools.Tool {
+		return a.active
+	}
+	if a.active != nil {
+		a.active.Cancel(ctx)
+	}
+	active, ok := editor.New(a.tools.Tool)
+	if !ok {
+		println("Unknown tool:", a.tools.Tool)
+		a.tools.Select(tool.PenTool)
+		active, _ = editor.New(tool.PenTool)
+	}
+	a.active, a.activeName = active, a.tools.Tool
+	return active
+}
+
 func (a *App) applyKeyboardActions(gtx layout.Context) {
 	actions := a.keyboard.HandleEvents(gtx, &a.keyTag)
 
 	for _, action := range actions {
 		switch action.Type {
 		case input.SetColor:
-			a.pen.SetColor(action.ColorPreset)
+			a.tools.SetColor(action.ColorPreset)
 		case input.SetWidth:
-			a.pen.SetWidth(action.WidthPreset)
+			a.tools.SetWidth(action.WidthPreset)
 		case input.ToggleDim:
 			a.renderer.Dim = !a.renderer.Dim
 		case input.ToggleUI:
 			a.toolbar.ToggleHidden()
 		case input.Clear:
-			a.canvas.Clear()
+			if a.editable(gtx) {
+				a.history.Push(a.canvas)
+				a.canvas.Clear()
+			}
 		case input.Quit:
-			os.Exit(0)
+			a.quit = true
+		case input.Save:
+			if a.documentName == "" {
+				a.toolbar.ShowSaveDialog()
+			} else {
+				a.save(gtx, a.documentName, a.canvas.Meta)
+			}
+		case input.Export:
+			a.toolbar.ShowSaveDialog()
+		case input.Open:
+			a.toolbar.ShowLoadDialog()
+		case input.New:
+			if a.editable(gtx) {
+				a.history.Push(a.canvas)
+				a.setCanvas(&canvas.Canvas{Screen: a.canvas.Screen})
+				a.documentName = ""
+			}
+		case input.Copy:
+			a.copy(gtx)
+		case input.Paste:
+			if a.editable(gtx) {
+				gtx.Execute(clipboard.ReadCmd{Tag: &a.keyTag})
+			}
+		case input.Undo:
+			if !a.editable(gtx) {
+				break
+			}
+			if previous, ok := a.history.Undo(a.canvas); ok {
+				a.setCanvas(previous)
+			}
+		case input.Redo:
+			if !a.editable(gtx) {
+				break
+			}
+			if next, ok := a.history.Redo(a.canvas); ok {
+				a.setCanvas(next)
+			}
 		}
 	}
 
@@ -170,44 +428,325 @@ func (a *App) applyKeyboardActions(gtx layout.Context) {
 }
 
 func (a *App) applyToolbarActions(gtx layout.Context) {
-	color, widthDp, eraserClicked, slidersChanged, selectedShape, saveRequested, saveFilename, loadRequested, loadFilename := a.toolbar.HandleEvents(gtx)
+	ev := a.toolbar.HandleEvents(gtx)
 
-	if saveRequested {
-		if err := a.canvas.SaveToFile(saveFilename); err != nil {
-			println("Error saving file:", err.Error())
-		} else {
-			println("Saved to ~/.screenpen/" + saveFilename + ".json")
-		}
+	if ev.SaveRequested {
+		a.save(gtx, ev.SaveFilename, ev.SaveMetadata)
 	}
 
-	if loadRequested {
-		if err := a.canvas.LoadFromFile(loadFilename); err != nil {
-			println("Error loading file:", err.Error())
-		} else {
-			println("Loaded from ~/.screenpen/" + loadFilename + ".json")
+	if ev.ExportRequested {
+		a.export(gtx, ev)
+	}
+
+	if ev.LoadRequested {
+		loaded, err := a.storage.Load(ev.LoadFilename)
+		a.toolbar.LoadFinished(ev.LoadFilename, err)
+		if err == nil {
+			loaded.FitTo(screenOf(gtx))
+			a.history.Push(a.canvas)
+			a.setCanvas(loaded)
+			a.documentName = ev.LoadFilename
+			println("Loaded " + ev.LoadFilename)
 			gtx.Execute(op.InvalidateCmd{})
 		}
 	}
 
-	if selectedShape != tool.NoShape {
-		a.shape.Type = selectedShape
-		a.shape.Active = true
-		a.pen.ColorPreset = tool.Red
+	if ev.InsertRequested {
+		loaded, err := a.storage.Load(ev.InsertFilename)
+		a.toolbar.LoadFinished(ev.InsertFilename, err)
+		if err == nil {
+			a.insert(gtx, loaded)
+			println("Inserted " + ev.InsertFilename)
+		}
+	}
+
+	if ev.ImportRequested {
+		imported, err := format.Import(ev.ImportPath)
+		a.toolbar.ImportFinished(ev.ImportPath, err)
+		if err == nil {
+			a.insert(gtx, imported)
+			println("Imported " + ev.ImportPath)
+		}
 	}
 
-	if eraserClicked {
-		a.pen.SetColor(tool.Eraser)
-		a.shape.Active = false
-	} else if slidersChanged {
-		a.pen.Color = color
-		a.pen.WidthDp = widthDp
-		a.pen.ColorPreset = tool.Red
-		a.shape.Active = false
+	if ev.RecoveryRestored {
+		a.recovered.FitTo(screenOf(gtx))
+		a.history.Push(a.canvas)
+		a.setCanvas(a.recovered)
+		a.recovered = nil
+		a.session.Discard()
+		println("Restored previous session")
+	}
+	if ev.RecoveryDiscarded {
+		a.recovered = nil
+		a.session.Discard()
+	}
+
+	if ev.ReplayStarted {
+		a.canvas.FinishStroke()
+		a.canvas.FinishShape()
+		a.player = replay.NewPlayer(a.canvas)
+		a.player.Play(gtx.Now)
+	}
+	if ev.ReplayStopped {
+		a.player = nil
+	}
+	if a.player != nil {
+		if ev.ReplayPlayPause {
+			a.player.TogglePlay(gtx.Now)
+		}
+		if ev.ReplaySpeed > 0 {
+			a.player.SetSpeed(ev.ReplaySpeed)
+		}
+		if ev.ReplaySeek {
+			a.player.Seek(ev.ReplayProgress)
+		}
 	}
 
 	gtx.Execute(op.InvalidateCmd{})
 }
 
+// insert adds other to the drawing as a group under the cursor, which then
+// follows the cursor until the next click places it.
+func (a *App) insert(gtx layout.Context, other *canvas.Canvas) {
+	other.FitTo(screenOf(gtx))
+	a.history.Push(a.canvas)
+	group := a.canvas.Insert(other, a.cursorPos)
+	a.selection = editor.Selection{
+		Selection: canvas.Selection{Group: group, Stroke: -1, Shape: -1, Text: -1},
+		Valid:     true,
+	}
+	a.placing = true
+}
+
+// save stores the drawing as name. Ctrl+S comes here directly for a drawing
+// that already has a name.
+func (a *App) save(gtx layout.Context, name string, meta canvas.Metadata) {
+	meta.Modified = gtx.Now
+	if meta.Created.IsZero() {
+		meta.Created = gtx.Now
+	}
+	meta.AppVersion = Version
+	a.canvas.Meta = meta
+	a.toolbar.SetMetadata(meta)
+
+	err := a.storage.Save(name, a.canvas)
+	a.toolbar.SaveFinished(err)
+	if err != nil {
+		println("Error saving:", err.Error())
+		return
+	}
+	a.documentName = name
+	a.saveThumbnail(gtx, name)
+	println("Saved " + name)
+}
+
+// editable tells whether the drawing may be swapped or changed as a whole:
+// not while a tool is at work, or during a replay.
+func (a *App) editable(gtx layout.Context) bool {
+	if a.player != nil {
+		return false
+	}
+	ctx := a.toolContext(gtx)
+	return !a.activeTool(ctx).Busy(ctx)
+}
+
+// setCanvas puts c on screen in place of the drawing, after undo, redo or
+// loading.
+func (a *App) setCanvas(c *canvas.Canvas) {
+	a.canvas = c
+	a.toolbar.SetMetadata(c.Meta)
+	a.selection = editor.Selection{}
+	a.placing = false
+	// A fresh tool, so that nothing refers to the old drawing.
+	a.active = nil
+}
+
+// copy puts the piece last grabbed with the move tool, or else the whole
+// drawing, on the clipboard.
+func (a *App) copy(gtx layout.Context) {
+	c := a.canvas
+	if a.tools.Tool == tool.MoveTool && a.selection.Valid {
+		c = a.canvas.Selected(a.selection.Selection)
+	}
+	data, err := canvas.EncodeDocument(c)
+	if err != nil {
+		println("Cannot copy:", err.Error())
+		return
+	}
+	gtx.Execute(clipboard.WriteCmd{Type: clipboardType, Data: io.NopCloser(bytes.NewReader(data))})
+}
+
+// applyClipboard inserts what a paste read from the clipboard.
+func (a *App) applyClipboard(gtx layout.Context) {
+	for {
+		ev, ok := gtx.Event(transfer.TargetFilter{Target: &a.keyTag, Type: clipboardType})
+		if !ok {
+			break
+		}
+		e, ok := ev.(transfer.DataEvent)
+		if !ok {
+			continue
+		}
+		r := e.Open()
+		data, err := io.ReadAll(r)
+		r.Close()
+		var pasted *canvas.Canvas
+		if err == nil {
+			pasted, err = format.ReadClipboard(data)
+		}
+		if err != nil {
+			println("Cannot paste:", err.Error())
+			continue
+		}
+		a.insert(gtx, pasted)
+		gtx.Execute(op.InvalidateCmd{})
+	}
+}
+
+// saveThumbnail is best effort: the drawing itself is already saved and the
+// load dialog shows a placeholder when the preview is missing.
+func (a *App) saveThumbnail(gtx layout.Context, name string) {
+	size := gtx.Constraints.Max
+	thumb, err := render.Thumbnail(a.canvas, size.X, size.Y)
+	if err == nil {
+		err = a.storage.SaveThumbnail(name, thumb)
+	}
+	if err != nil {
+		println("Error saving thumbnail:", err.Error())
+	}
+}
+
+func (a *App) export(gtx layout.Context, ev ui.Events) {
+	saveDir := a.dataDir
+	if saveDir == "" {
+		a.toolbar.SaveFinished(errors.New("exports need a data directory on disk"))
+		return
+	}
+
+	// Exports replace what is there only once the user confirmed it, as
+	// saves do.
+	path := filepath.Join(saveDir, ev.ExportFormat.Target(ev.ExportFilename))
+	if !ev.ExportOverwrite {
+		if _, err := os.Stat(path); err == nil {
+			a.toolbar.ExportExists(filepath.Base(path))
+			return
+		}
+	}
+
+	size := gtx.Constraints.Max
+	var err error
+	switch ev.ExportFormat {
+	case ui.ExportSVG:
+		err = format.SaveSVG(path, a.canvas, size.X, size.Y)
+	case ui.ExportXopp:
+		err = format.SaveXopp(path, a.canvas)
+	case ui.ExportInkML:
+		err = format.SaveInkML(path, a.canvas)
+	case ui.ExportExcalidraw:
+		err = format.SaveExcalidraw(path, a.canvas)
+	case ui.ExportHPGL:
+		err = format.SaveHPGL(path, a.canvas, format.PlotterOptions{Paper: ev.ExportPaper})
+	case ui.ExportGCode:
+		err = format.SaveGCode(path, a.canvas, format.PlotterOptions{Paper: ev.ExportPaper})
+	case ui.ExportGIF, ui.ExportPNGSequence:
+		a.exportTimelapse(path, size, ev)
+		return
+	case ui.ExportPDF:
+		err = format.SavePDF(path, []*canvas.Canvas{a.canvas}, format.PDFOptions{
+			ScreenWidth:  size.X,
+			ScreenHeight: size.Y,
+			Template:     ev.ExportTemplate,
+		})
+	}
+
+	a.toolbar.SaveFinished(err)
+	if err == nil {
+		println("Exported to " + path)
+	}
+}
+
+func (a *App) exportTimelapse(path string, size image.Point, ev ui.Events) {
+	if a.exportDone != nil {
+		a.toolbar.SaveFinished(errors.New("a timelapse export is still running"))
+		return
+	}
+	// The export runs while drawing goes on, so it gets its own copy.
+	snapshot := a.canvas.Snapshot(a.canvas.Duration()).Clone()
+	opts := format.AnimationOptions{
+		ScreenWidth:  size.X,
+		ScreenHeight: size.Y,
+		Scale:        1,
+		FrameRate:    ev.ExportFrameRate,
+		SpeedUp:      ev.ExportSpeedUp,
+		Background:   color.NRGBA{R: 255, G: 255, B: 255, A: 255},
+	}
+
+	done := make(chan error, 1)
+	a.exportDone = done
+	a.toolbar.TimelapseStarted()
+	go func() {
+		if ev.ExportFormat == ui.ExportGIF {
+			opts.Scale = gifScale
+			err := format.SaveGIF(path, snapshot, opts)
+			if err == nil {
+				println("Exported to " + path)
+			}
+			done <- err
+			return
+		}
+
+		count, err := format.SavePNGSequence(path, snapshot, opts)
+		if err == nil {
+			println("Exported", count, "frames to "+path)
+		}
+		done <- err
+	}()
+}
+
+// checkExport hands the result of a finished timelapse export to the
+// toolbar. The export cannot wake the window, so frames keep coming while
+// it runs.
+func (a *App) checkExport(gtx layout.Context) {
+	if a.exportDone == nil {
+		return
+	}
+	select {
+	case err := <-a.exportDone:
+		a.exportDone = nil
+		if err != nil {
+			println("Error exporting file:", err.Error())
+		}
+		a.toolbar.TimelapseFinished(err)
+	default:
+		gtx.Execute(op.InvalidateCmd{At: gtx.Now.Add(exportPollInterval)})
+	}
+}
+
+func (a *App) advanceReplay(gtx layout.Context) *canvas.Canvas {
+	a.player.Advance(gtx.Now)
+	a.toolbar.SetReplayStatus(ui.ReplayStatus{
+		Playing:  a.player.Playing(),
+		Speed:    a.player.Speed(),
+		Progress: a.player.Progress(),
+		Position: a.player.Position(),
+		Duration: a.player.Duration(),
+	})
+	if a.player.Playing() {
+		gtx.Execute(op.InvalidateCmd{})
+	}
+	return a.player.Frame()
+}
+
+// screenOf describes the window the canvas is drawn in.
+func screenOf(gtx layout.Context) canvas.Screen {
+	return canvas.Screen{
+		Width:   gtx.Constraints.Max.X,
+		Height:  gtx.Constraints.Max.Y,
+		PxPerDp: gtx.Metric.PxPerDp,
+	}
+}
+
 func scaleToPixels(gtx layout.Context, deviceIndependentValue float32) float32 {
 	return float32(gtx.Metric.PxPerDp) * deviceIndependentValue
 }
@@ -1,10 +1,8 @@
 package canvas
 
 import (
-	"encoding/json"
 	"image/color"
-	"os"
-	"path/filepath"
+	"time"
 
 	"gioui.org/f32"
 
@@ -16,30 +14,42 @@ type Canvas struct {
 	Current      *Stroke
 	Shapes       []Shape
 	CurrentShape *Shape
+	Texts        []Text
+
+	// Screen is the display the coordinates above refer to.
+	Screen Screen
+	Meta   Metadata
 }
 
-type Shape struct {
-	Type     tool.ShapeType
-	Color    color.NRGBA
-	StartPos f32.Point
-	EndPos   f32.Point
-	WidthPx  float32
+var now = func() int64 {
+	return time.Now().UnixMilli()
 }
 
-func (c *Canvas) StartStroke(color color.NRGBA, widthPx float32, startPoint f32.Point) {
+func (c *Canvas) StartStroke(color color.NRGBA, widthPx float32, dash []float32, startPoint f32.Point) {
 	c.Current = &Stroke{
-		Color:  color,
-		Width:  widthPx,
-		Points: []f32.Point{startPoint},
+		Color:     color,
+		Width:     widthPx,
+		Dash:      dash,
+		Points:    []f32.Point{startPoint},
+		StartedAt: now(),
+		Times:     []int64{0},
 	}
 }
 
+// StartErasing starts an eraser stroke.
+func (c *Canvas) StartErasing(widthPx float32, startPoint f32.Point) {
+	c.StartStroke(EraserColor, widthPx, nil, startPoint)
+	c.Current.Eraser = true
+}
+
 func (c *Canvas) AddPoint(point f32.Point) {
 	if c.Current == nil {
 		return
 	}
 	last := c.Current.Points[len(c.Current.Points)-1]
+	before := len(c.Current.Points)
 	appendInterpolated(&c.Current.Points, last, point, c.Current.Width/2)
+	c.Current.appendTimes(len(c.Current.Points)-before, now())
 }
 
 func (c *Canvas) FinishStroke() {
@@ -54,15 +64,22 @@ func (c *Canvas) Clear() {
 	c.Current = nil
 	c.Shapes = nil
 	c.CurrentShape = nil
+	c.Texts = nil
 }
 
-func (c *Canvas) StartShape(shapeType tool.ShapeType, color color.NRGBA, widthPx float32, startPoint f32.Point) {
+func (c *Canvas) StartShape(shapeType tool.ShapeType, color color.NRGBA, widthPx float32, dash []float32, arrow tool.ArrowStyle, startPoint f32.Point) {
+	if shapeType != tool.Arrow {
+		arrow = tool.ArrowStyle{}
+	}
 	c.CurrentShape = &Shape{
-		Type:     shapeType,
-		Color:    color,
-		StartPos: startPoint,
-		EndPos:   startPoint,
-		WidthPx:  widthPx,
+		Type:      shapeType,
+		Color:     color,
+		StartPos:  startPoint,
+		EndPos:    startPoint,
+		WidthPx:   widthPx,
+		Dash:      dash,
+		Arrow:     arrow,
+		StartedAt: now(),
 	}
 }
 
@@ -74,6 +91,7 @@ func (c *Canvas) UpdateShape(endPoint f32.Point) {
 
 func (c *Canvas) FinishShape() {
 	if c.CurrentShape != nil {
+		c.CurrentShape.FinishedAt = now()
 		c.Shapes = append(c.Shapes, *c.CurrentShape)
 		c.CurrentShape = nil
 	}
@@ -91,6 +109,23 @@ func (c *Canvas) RemoveShapesIntersectingStroke(stroke *Stroke) {
 		}
 	}
 	c.Shapes = remainingShapes
+
+	remainingTexts := make([]Text, 0, len(c.Texts))
+	for i := range c.Texts {
+		if !textIntersectsStroke(&c.Texts[i], stroke) {
+			remainingTexts = append(remainingTexts, c.Texts[i])
+		}
+	}
+	c.Texts = remainingTexts
+}
+
+func textIntersectsStroke(text *Text, stroke *Stroke) bool {
+	for _, point := range stroke.Points {
+		if text.contains(point, stroke.Width) {
+			return true
+		}
+	}
+	return false
 }
 
 func shapeIntersectsStroke(shape *Shape, stroke *Stroke) bool {
@@ -149,54 +184,3 @@ func sqrtFloat64(x float64) float64 {
 	}
 	return result
 }
-
-func (c *Canvas) SaveToFile(filename string) error {
-	saveDir := filepath.Join(os.Getenv("HOME"), ".screenpen")
-	if err := os.MkdirAll(saveDir, 0o755); err != nil {
-		return err
-	}
-
-	fullPath := filepath.Join(saveDir, filename+".json")
-
-	data, err := json.MarshalIndent(c, "", "  ")
-	if err != nil {
-		return err
-	}
-
-	return os.WriteFile(fullPath, data, 0o644)
-}
-
-func (c *Canvas) LoadFromFile(filename string) error {
-	saveDir := filepath.Join(os.Getenv("HOME"), ".screenpen")
-	fullPath := filepath.Join(saveDir, filename+".json")
-
-	data, err := os.ReadFile(fullPath)
-	if err != nil {
-		return err
-	}
-
-	return json.Unmarshal(data, c)
-}
-
-func ListSavedFiles() ([]string, error) {
-	saveDir := filepath.Join(os.Getenv("HOME"), ".screenpen")
-
-	if err := os.MkdirAll(saveDir, 0o755); err != nil {
-		return nil, err
-	}
-
-	entries, err := os.ReadDir(saveDir)
-	if err != nil {
-		return nil, err
-	}
-
-	var files []string
-	for _, entry := range entries {
-		if !entry.IsDir() && filepath.Ext(entry.Name()) == ".json" {
-			name := entry.Name()
-			files = append(files, name[:len(name)-5])
-		}
-	}
-
-	return files, nil
-}
@@ -0,0 +1,83 @@
+package canvas
+
+import (
+	"math"
+
+	"gioui.org/f32"
+
+	"screenpengo/internal/tool"
+)
+
+// UsableDash returns pattern, or nil when it cannot be drawn: an entry is
+// negative or not a number, or the pattern repeats more often than every
+// tool.MinDashPeriodPx. Imported and loaded patterns go through it, so they
+// draw solid instead.
+func UsableDash(pattern []float32) []float32 {
+	var total float32
+	for _, v := range pattern {
+		if !(v >= 0) {
+			return nil
+		}
+		total += v
+	}
+	if total < tool.MinDashPeriodPx {
+		return nil
+	}
+	return pattern
+}
+
+// DashPolyline splits a polyline into the visible runs of a dash pattern.
+// Even pattern entries are dash lengths and odd entries are gaps. A run with
+// a single point is a zero-length dash and is drawn as a dot. A pattern
+// that UsableDash turns down, or one too fine for the length of the line,
+// gives the undashed line.
+func DashPolyline(points []f32.Point, pattern []float32) [][]f32.Point {
+	if len(points) == 0 {
+		return nil
+	}
+	if UsableDash(pattern) == nil {
+		return [][]f32.Point{points}
+	}
+
+	var runs [][]f32.Point
+	current := []f32.Point{points[0]}
+	idx := 0
+	remaining := pattern[0]
+	on := true
+
+	for i := 1; i < len(points); i++ {
+		a, b := points[i-1], points[i]
+		segLen := float32(math.Hypot(float64(b.X-a.X), float64(b.Y-a.Y)))
+		if segLen == 0 {
+			continue
+		}
+
+		travelled := float32(0)
+		for segLen-travelled >= remaining {
+			if remaining > 0 && travelled+remaining == travelled {
+				return [][]f32.Point{points}
+			}
+			travelled += remaining
+			t := travelled / segLen
+			split := f32.Pt(a.X+(b.X-a.X)*t, a.Y+(b.Y-a.Y)*t)
+			if on {
+				runs = append(runs, append(current, split))
+				current = nil
+			} else {
+				current = []f32.Point{split}
+			}
+			on = !on
+			idx = (idx + 1) % len(pattern)
+			remaining = pattern[idx]
+		}
+		remaining -= segLen - travelled
+		if on {
+			current = append(current, b)
+		}
+	}
+
+	if on && len(current) > 0 {
+		runs = append(runs, current)
+	}
+	return runs
+}
@@ -0,0 +1,49 @@
+package canvas
+
+import (
+	"math"
+	"testing"
+
+	"gioui.org/f32"
+)
+
+func TestDashPolyline(t *testing.T) {
+	line := []f32.Point{f32.Pt(0, 0), f32.Pt(9, 0)}
+	nan := float32(math.NaN())
+	tests := []struct {
+		name    string
+		pattern []float32
+		runs    int
+	}{
+		{"dashes", []float32{2, 3}, 2},
+		{"dots", []float32{0, 5}, 2},
+		{"no pattern", nil, 1},
+		{"all zero", []float32{0, 0}, 1},
+		{"negative gap", []float32{10, -2}, 1},
+		{"negative dash", []float32{-1, 4}, 1},
+		{"not a number", []float32{nan, 2}, 1},
+		{"too fine", []float32{0, 6e-8}, 1},
+		{"finer than a pixel", []float32{0.1, 0.1}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runs := DashPolyline(line, tt.pattern)
+			if len(runs) != tt.runs {
+				t.Fatalf("got %d runs, want %d: %v", len(runs), tt.runs, runs)
+			}
+			if tt.runs == 1 && len(runs[0]) != len(line) {
+				t.Errorf("got %v, want the undashed line", runs[0])
+			}
+		})
+	}
+}
+
+// A pattern that is fine on its own can still be too short to move along a
+// long line in float32.
+func TestDashPolylineLongLine(t *testing.T) {
+	line := []f32.Point{f32.Pt(0, 0), f32.Pt(2e7, 0)}
+	runs := DashPolyline(line, []float32{1e7, 0.5})
+	if len(runs) != 1 || len(runs[0]) != 2 {
+		t.Errorf("got %d runs, want the undashed line", len(runs))
+	}
+}
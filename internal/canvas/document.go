@@ -0,0 +1,570 @@
+package canvas
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image/color"
+	"strconv"
+	"time"
+
+	"gioui.org/f32"
+
+	"screenpengo/internal/tool"
+)
+
+// DocumentVersion is the save-file format written by EncodeDocument. Files
+// without a version field are the legacy format, which was a direct dump of
+// the Canvas struct, and count as version 0. Versions before 2 stored
+// physical pixels; since then coordinates and widths are in dp. Version 3
+// added texts and per-point stroke widths, which older versions would drop.
+const DocumentVersion = 3
+
+var (
+	ErrUnsupportedVersion = errors.New("save file was written by a newer version of screenpen")
+	ErrCorruptDocument    = errors.New("save file is corrupted")
+)
+
+// migrations[v] upgrades a version v document to version v+1.
+var migrations = []func(data []byte) ([]byte, error){
+	migrateLegacy,
+	migratePixels,
+	setVersion(3),
+}
+
+type document struct {
+	Version int           `json:"version"`
+	Screen  *screenEntry  `json:"screen,omitempty"`
+	Meta    *metaEntry    `json:"meta,omitempty"`
+	Strokes []strokeEntry `json:"strokes"`
+	Shapes  []shapeEntry  `json:"shapes"`
+	Texts   []textEntry   `json:"texts,omitempty"`
+}
+
+// screenEntry is the display the drawing was made on, in dp. Documents
+// without it are treated as drawn at one pixel per dp on a screen of
+// unknown size.
+type screenEntry struct {
+	Width   float32 `json:"width,omitempty"`
+	Height  float32 `json:"height,omitempty"`
+	PxPerDp float32 `json:"pxPerDp"`
+}
+
+// metaEntry is optional, so it did not need a new version. Times are
+// RFC 3339.
+type metaEntry struct {
+	Title       string   `json:"title,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	Author      string   `json:"author,omitempty"`
+	Created     string   `json:"created,omitempty"`
+	Modified    string   `json:"modified,omitempty"`
+	AppVersion  string   `json:"app,omitempty"`
+}
+
+type docPoint [2]float32
+
+type strokeEntry struct {
+	Points    []docPoint `json:"points"`
+	Color     string     `json:"color"`
+	Width     float32    `json:"width"`
+	Widths    []float32  `json:"widths,omitempty"`
+	Dash      []float32  `json:"dash,omitempty"`
+	StartedAt int64      `json:"startedAt,omitempty"`
+	Times     []int64    `json:"times,omitempty"`
+	Group     int        `json:"group,omitempty"`
+	Eraser    bool       `json:"eraser,omitempty"`
+}
+
+type shapeEntry struct {
+	Type       string      `json:"type"`
+	Color      string      `json:"color"`
+	Start      docPoint    `json:"start"`
+	End        docPoint    `json:"end"`
+	Width      float32     `json:"width"`
+	Dash       []float32   `json:"dash,omitempty"`
+	Arrow      *arrowEntry `json:"arrow,omitempty"`
+	StartedAt  int64       `json:"startedAt,omitempty"`
+	FinishedAt int64       `json:"finishedAt,omitempty"`
+	Group      int         `json:"group,omitempty"`
+}
+
+type textEntry struct {
+	Text      string   `json:"text"`
+	Pos       docPoint `json:"pos"`
+	Size      float32  `json:"size"`
+	Color     string   `json:"color"`
+	Font      string   `json:"font,omitempty"`
+	StartedAt int64    `json:"startedAt,omitempty"`
+	Group     int      `json:"group,omitempty"`
+}
+
+type arrowEntry struct {
+	Start string  `json:"start"`
+	End   string  `json:"end"`
+	Size  float32 `json:"size"`
+	Angle float32 `json:"angle"`
+}
+
+// The names are part of the file format and must not change when the
+// labels shown in the toolbar do.
+var shapeTypeNames = map[tool.ShapeType]string{
+	tool.Circle:    "circle",
+	tool.Rectangle: "rectangle",
+	tool.Line:      "line",
+	tool.Arrow:     "arrow",
+}
+
+var arrowHeadNames = map[tool.ArrowHead]string{
+	tool.HeadNone:    "none",
+	tool.HeadOpen:    "open",
+	tool.HeadFilled:  "filled",
+	tool.HeadCircle:  "circle",
+	tool.HeadBar:     "bar",
+	tool.HeadDiamond: "diamond",
+}
+
+// EncodeDocument serialises the finished strokes and shapes of c. Anything
+// still being drawn is not part of the document.
+func EncodeDocument(c *Canvas) ([]byte, error) {
+	scale := c.Screen.pxPerDp()
+	size := c.Screen.sizeDp()
+	doc := document{
+		Version: DocumentVersion,
+		Screen:  &screenEntry{Width: size.X, Height: size.Y, PxPerDp: scale},
+		Meta:    encodeMetadata(c.Meta),
+		Strokes: make([]strokeEntry, 0, len(c.Strokes)),
+		Shapes:  make([]shapeEntry, 0, len(c.Shapes)),
+	}
+	dp := func(p f32.Point) docPoint {
+		return docPoint{p.X / scale, p.Y / scale}
+	}
+
+	for _, s := range c.Strokes {
+		entry := strokeEntry{
+			Points:    make([]docPoint, len(s.Points)),
+			Color:     formatColor(s.Color),
+			Width:     s.Width / scale,
+			Widths:    scaledDash(s.Widths, 1/scale),
+			Dash:      scaledDash(s.Dash, 1/scale),
+			StartedAt: s.StartedAt,
+			Times:     s.Times,
+			Group:     s.Group,
+			Eraser:    s.Eraser,
+		}
+		for i, p := range s.Points {
+			entry.Points[i] = dp(p)
+		}
+		doc.Strokes = append(doc.Strokes, entry)
+	}
+
+	for _, s := range c.Shapes {
+		name, ok := shapeTypeNames[s.Type]
+		if !ok {
+			return nil, fmt.Errorf("unknown shape type %d", s.Type)
+		}
+		entry := shapeEntry{
+			Type:       name,
+			Color:      formatColor(s.Color),
+			Start:      dp(s.StartPos),
+			End:        dp(s.EndPos),
+			Width:      s.WidthPx / scale,
+			Dash:       scaledDash(s.Dash, 1/scale),
+			StartedAt:  s.StartedAt,
+			FinishedAt: s.FinishedAt,
+			Group:      s.Group,
+		}
+		if s.Type == tool.Arrow && s.Arrow != (tool.ArrowStyle{}) {
+			entry.Arrow = &arrowEntry{
+				Start: arrowHeadNames[s.Arrow.Start],
+				End:   arrowHeadNames[s.Arrow.End],
+				Size:  s.Arrow.Size,
+				Angle: s.Arrow.Angle,
+			}
+		}
+		doc.Shapes = append(doc.Shapes, entry)
+	}
+
+	for _, t := range c.Texts {
+		doc.Texts = append(doc.Texts, textEntry{
+			Text:      t.Text,
+			Pos:       dp(t.Pos),
+			Size:      t.Size / scale,
+			Color:     formatColor(t.Color),
+			Font:      t.Font,
+			StartedAt: t.StartedAt,
+			Group:     t.Group,
+		})
+	}
+
+	return json.Marshal(doc)
+}
+
+// DecodeDocument parses a save file of any supported version, migrating it
+// to the current schema first.
+func DecodeDocument(data []byte) (*Canvas, error) {
+	var header struct {
+		Version int `json:"version"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCorruptDocument, err)
+	}
+	if header.Version < 0 {
+		return nil, fmt.Errorf("%w: invalid version %d", ErrCorruptDocument, header.Version)
+	}
+	if header.Version > DocumentVersion {
+		return nil, fmt.Errorf("%w: version %d, newest supported is %d", ErrUnsupportedVersion, header.Version, DocumentVersion)
+	}
+
+	for v := header.Version; v < DocumentVersion; v++ {
+		var err error
+		if data, err = migrations[v](data); err != nil {
+			return nil, fmt.Errorf("%w: upgrading from version %d: %v", ErrCorruptDocument, v, err)
+		}
+	}
+
+	var doc document
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCorruptDocument, err)
+	}
+	c, err := doc.canvas()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCorruptDocument, err)
+	}
+	return c, nil
+}
+
+// canvas converts the document back to pixels of the screen it was drawn
+// on; Canvas.FitTo then adapts it to the current one.
+func (doc *document) canvas() (*Canvas, error) {
+	c := &Canvas{
+		Strokes: make([]Stroke, 0, len(doc.Strokes)),
+		Shapes:  make([]Shape, 0, len(doc.Shapes)),
+	}
+	if doc.Meta != nil {
+		meta, err := doc.Meta.metadata()
+		if err != nil {
+			return nil, err
+		}
+		c.Meta = meta
+	}
+	if doc.Screen != nil {
+		if doc.Screen.PxPerDp < 0 || doc.Screen.Width < 0 || doc.Screen.Height < 0 {
+			return nil, fmt.Errorf("invalid screen %+v", *doc.Screen)
+		}
+		c.Screen.PxPerDp = doc.Screen.PxPerDp
+		c.Screen.Width = int(doc.Screen.Width*c.Screen.pxPerDp() + 0.5)
+		c.Screen.Height = int(doc.Screen.Height*c.Screen.pxPerDp() + 0.5)
+	}
+
+	for i, entry := range doc.Strokes {
+		col, err := parseColor(entry.Color)
+		if err != nil {
+			return nil, fmt.Errorf("stroke %d: %v", i, err)
+		}
+		if entry.Width <= 0 {
+			return nil, fmt.Errorf("stroke %d: invalid width %v", i, entry.Width)
+		}
+		if entry.Times != nil && len(entry.Times) != len(entry.Points) {
+			return nil, fmt.Errorf("stroke %d: %d timestamps for %d points", i, len(entry.Times), len(entry.Points))
+		}
+		if entry.Widths != nil && len(entry.Widths) != len(entry.Points) {
+			return nil, fmt.Errorf("stroke %d: %d widths for %d points", i, len(entry.Widths), len(entry.Points))
+		}
+		s := Stroke{
+			Points:    make([]f32.Point, len(entry.Points)),
+			Color:     col,
+			Width:     entry.Width,
+			Widths:    entry.Widths,
+			Dash:      entry.Dash,
+			StartedAt: entry.StartedAt,
+			Times:     entry.Times,
+			Group:     entry.Group,
+			Eraser:    entry.Eraser,
+		}
+		for j, p := range entry.Points {
+			s.Points[j] = f32.Pt(p[0], p[1])
+		}
+		c.Strokes = append(c.Strokes, s)
+	}
+
+	for i, entry := range doc.Shapes {
+		shapeType, ok := lookupName(shapeTypeNames, entry.Type)
+		if !ok {
+			return nil, fmt.Errorf("shape %d: unknown type %q", i, entry.Type)
+		}
+		col, err := parseColor(entry.Color)
+		if err != nil {
+			return nil, fmt.Errorf("shape %d: %v", i, err)
+		}
+		s := Shape{
+			Type:       shapeType,
+			Color:      col,
+			StartPos:   f32.Pt(entry.Start[0], entry.Start[1]),
+			EndPos:     f32.Pt(entry.End[0], entry.End[1]),
+			WidthPx:    entry.Width,
+			Dash:       entry.Dash,
+			StartedAt:  entry.StartedAt,
+			FinishedAt: entry.FinishedAt,
+			Group:      entry.Group,
+		}
+		if entry.Arrow != nil && shapeType == tool.Arrow {
+			start, okStart := lookupName(arrowHeadNames, entry.Arrow.Start)
+			end, okEnd := lookupName(arrowHeadNames, entry.Arrow.End)
+			if !okStart || !okEnd {
+				return nil, fmt.Errorf("shape %d: unknown arrow head %q/%q", i, entry.Arrow.Start, entry.Arrow.End)
+			}
+			s.Arrow = tool.ArrowStyle{Start: start, End: end, Size: entry.Arrow.Size, Angle: entry.Arrow.Angle}
+		}
+		c.Shapes = append(c.Shapes, s)
+	}
+
+	for i, entry := range doc.Texts {
+		col, err := parseColor(entry.Color)
+		if err != nil {
+			return nil, fmt.Errorf("text %d: %v", i, err)
+		}
+		if entry.Size <= 0 {
+			return nil, fmt.Errorf("text %d: invalid size %v", i, entry.Size)
+		}
+		c.Texts = append(c.Texts, Text{
+			Pos:       f32.Pt(entry.Pos[0], entry.Pos[1]),
+			Text:      entry.Text,
+			Size:      entry.Size,
+			Color:     col,
+			Font:      entry.Font,
+			StartedAt: entry.StartedAt,
+			Group:     entry.Group,
+		})
+	}
+
+	c.Scale(c.Screen.pxPerDp())
+	// Patterns too fine to draw, as written by versions that did not check,
+	// load as solid lines.
+	for i := range c.Strokes {
+		c.Strokes[i].Dash = UsableDash(c.Strokes[i].Dash)
+	}
+	for i := range c.Shapes {
+		c.Shapes[i].Dash = UsableDash(c.Shapes[i].Dash)
+	}
+	return c, nil
+}
+
+// DecodeMetadata reads only the metadata of a save file, for listing
+// documents without building their canvases. Files from before metadata
+// existed have none.
+func DecodeMetadata(data []byte) (Metadata, error) {
+	var doc struct {
+		Version int        `json:"version"`
+		Meta    *metaEntry `json:"meta"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return Metadata{}, fmt.Errorf("%w: %v", ErrCorruptDocument, err)
+	}
+	if doc.Version < 0 {
+		return Metadata{}, fmt.Errorf("%w: invalid version %d", ErrCorruptDocument, doc.Version)
+	}
+	if doc.Version > DocumentVersion {
+		return Metadata{}, fmt.Errorf("%w: version %d, newest supported is %d", ErrUnsupportedVersion, doc.Version, DocumentVersion)
+	}
+	if doc.Meta == nil {
+		return Metadata{}, nil
+	}
+	meta, err := doc.Meta.metadata()
+	if err != nil {
+		return Metadata{}, fmt.Errorf("%w: %v", ErrCorruptDocument, err)
+	}
+	return meta, nil
+}
+
+func encodeMetadata(m Metadata) *metaEntry {
+	entry := &metaEntry{
+		Title:       m.Title,
+		Description: m.Description,
+		Tags:        m.Tags,
+		Author:      m.Author,
+		Created:     formatTime(m.Created),
+		Modified:    formatTime(m.Modified),
+		AppVersion:  m.AppVersion,
+	}
+	if entry.Title == "" && entry.Description == "" && len(entry.Tags) == 0 && entry.Author == "" &&
+		entry.Created == "" && entry.Modified == "" && entry.AppVersion == "" {
+		return nil
+	}
+	return entry
+}
+
+func (entry *metaEntry) metadata() (Metadata, error) {
+	created, err := parseTime(entry.Created)
+	if err != nil {
+		return Metadata{}, fmt.Errorf("created: %v", err)
+	}
+	modified, err := parseTime(entry.Modified)
+	if err != nil {
+		return Metadata{}, fmt.Errorf("modified: %v", err)
+	}
+	return Metadata{
+		Title:       entry.Title,
+		Description: entry.Description,
+		Tags:        entry.Tags,
+		Author:      entry.Author,
+		Created:     created,
+		Modified:    modified,
+		AppVersion:  entry.AppVersion,
+	}, nil
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+func lookupName[K comparable](names map[K]string, name string) (K, bool) {
+	for k, n := range names {
+		if n == name {
+			return k, true
+		}
+	}
+	var zero K
+	return zero, false
+}
+
+func formatColor(c color.NRGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x%02x", c.R, c.G, c.B, c.A)
+}
+
+func parseColor(s string) (color.NRGBA, error) {
+	if len(s) != 9 || s[0] != '#' {
+		return color.NRGBA{}, fmt.Errorf("invalid color %q", s)
+	}
+	v, err := strconv.ParseUint(s[1:], 16, 32)
+	if err != nil {
+		return color.NRGBA{}, fmt.Errorf("invalid color %q", s)
+	}
+	return color.NRGBA{R: uint8(v >> 24), G: uint8(v >> 16), B: uint8(v >> 8), A: uint8(v)}, nil
+}
+
+// Legacy (version 0) files are a JSON dump of the Canvas struct with Go field
+// names, bare integer shape types and an RGBA object per colour. The structs
+// below freeze that layout so the runtime types can change freely.
+type legacyPoint struct {
+	X, Y float32
+}
+
+type legacyColor struct {
+	R, G, B, A uint8
+}
+
+type legacyStroke struct {
+	Points    []legacyPoint
+	Color     legacyColor
+	Width     float32
+	Dash      []float32
+	StartedAt int64
+	Times     []int64
+}
+
+type legacyShape struct {
+	Type     int
+	Color    legacyColor
+	StartPos legacyPoint
+	EndPos   legacyPoint
+	WidthPx  float32
+	Dash     []float32
+	Arrow    struct {
+		Start, End  int
+		Size, Angle float32
+	}
+	StartedAt  int64
+	FinishedAt int64
+}
+
+func migrateLegacy(data []byte) ([]byte, error) {
+	var legacy struct {
+		Strokes []legacyStroke
+		Shapes  []legacyShape
+	}
+	if err := json.Unmarshal(data, &legacy); err != nil {
+		return nil, err
+	}
+
+	doc := document{Version: 1}
+	for _, s := range legacy.Strokes {
+		entry := strokeEntry{
+			Points:    make([]docPoint, len(s.Points)),
+			Color:     formatColor(color.NRGBA(s.Color)),
+			Width:     s.Width,
+			Dash:      s.Dash,
+			StartedAt: s.StartedAt,
+			Times:     s.Times,
+		}
+		for i, p := range s.Points {
+			entry.Points[i] = docPoint{p.X, p.Y}
+		}
+		doc.Strokes = append(doc.Strokes, entry)
+	}
+
+	for i, s := range legacy.Shapes {
+		name, ok := shapeTypeNames[tool.ShapeType(s.Type)]
+		if !ok {
+			return nil, fmt.Errorf("shape %d: unknown type %d", i, s.Type)
+		}
+		entry := shapeEntry{
+			Type:       name,
+			Color:      formatColor(color.NRGBA(s.Color)),
+			Start:      docPoint{s.StartPos.X, s.StartPos.Y},
+			End:        docPoint{s.EndPos.X, s.EndPos.Y},
+			Width:      s.WidthPx,
+			Dash:       s.Dash,
+			StartedAt:  s.StartedAt,
+			FinishedAt: s.FinishedAt,
+		}
+		if s.Arrow.Size > 0 {
+			entry.Arrow = &arrowEntry{
+				Start: arrowHeadNames[tool.ArrowHead(s.Arrow.Start)],
+				End:   arrowHeadNames[tool.ArrowHead(s.Arrow.End)],
+				Size:  s.Arrow.Size,
+				Angle: s.Arrow.Angle,
+			}
+		}
+		doc.Shapes = append(doc.Shapes, entry)
+	}
+
+	return json.Marshal(doc)
+}
+
+// setVersion is the migration for versions that only added optional
+// fields: the data stays as it is.
+func setVersion(version int) func([]byte) ([]byte, error) {
+	return func(data []byte) ([]byte, error) {
+		var doc map[string]json.RawMessage
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return nil, err
+		}
+		doc["version"] = json.RawMessage(strconv.Itoa(version))
+		return json.Marshal(doc)
+	}
+}
+
+// migratePixels upgrades version 1, which stored physical pixels without
+// saying which screen they belonged to. Leaving the screen out makes them
+// load as dp at one pixel per dp, which is what they were on a standard
+// density display.
+func migratePixels(data []byte) ([]byte, error) {
+	var doc document
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	doc.Version = 2
+	doc.Screen = nil
+	return json.Marshal(doc)
+}
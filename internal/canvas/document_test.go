@@ -0,0 +1,198 @@
+package canvas
+
+import (
+	"errors"
+	"fmt"
+	"image/color"
+	"testing"
+
+	"gioui.org/f32"
+
+	"screenpengo/internal/tool"
+)
+
+// Save files as the versions before the current one wrote them. They must
+// keep loading, so they are never regenerated.
+const (
+	// documentV0 is a dump of the Canvas struct, from before the format had
+	// a version.
+	documentV0 = `{"Strokes":[{"Points":[{"X":10,"Y":20},{"X":30,"Y":40}],"Color":{"R":255,"G":0,"B":0,"A":255},"Width":4,"Dash":null,"StartedAt":1000,"Times":[0,16]}],"Current":null,` +
+		`"Shapes":[{"Type":4,"Color":{"R":0,"G":0,"B":255,"A":255},"StartPos":{"X":1,"Y":2},"EndPos":{"X":50,"Y":60},"WidthPx":3,"Dash":[6,4],` +
+		`"Arrow":{"Start":0,"End":2,"Size":12,"Angle":0.5},"StartedAt":1000,"FinishedAt":1200}],"CurrentShape":null}`
+	// documentV1 is in physical pixels; its screen was only a hint.
+	documentV1 = `{"version":1,"screen":{"width":800,"height":600,"pxPerDp":2},` +
+		`"strokes":[{"points":[[10,20],[30,40]],"color":"#ff0000ff","width":4}],"shapes":[]}`
+	// documentV2 is in dp on a screen of two pixels per dp.
+	documentV2 = `{"version":2,"screen":{"width":400,"height":300,"pxPerDp":2},"meta":{"title":"Old"},` +
+		`"strokes":[{"points":[[10,20],[30,40]],"color":"#ff0000ff","width":4}],"shapes":[{"type":"circle","color":"#0000ffff","start":[1,2],"end":[3,4],"width":1}]}`
+)
+
+var (
+	red = color.NRGBA{R: 255, A: 255}
+	// documentFuture comes from a newer release.
+	documentFuture = fmt.Sprintf(`{"version":%d,"strokes":[],"shapes":[]}`, DocumentVersion+1)
+)
+
+func TestDecodeDocumentV0(t *testing.T) {
+	c, err := DecodeDocument([]byte(documentV0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Strokes) != 1 || len(c.Shapes) != 1 {
+		t.Fatalf("got %d strokes and %d shapes, want 1 and 1", len(c.Strokes), len(c.Shapes))
+	}
+	s := c.Strokes[0]
+	if s.Color != red || s.Width != 4 || s.StartedAt != 1000 {
+		t.Errorf("stroke = %+v", s)
+	}
+	if len(s.Points) != 2 || s.Points[1] != f32.Pt(30, 40) || len(s.Times) != 2 || s.Times[1] != 16 {
+		t.Errorf("stroke points %v, times %v", s.Points, s.Times)
+	}
+	sh := c.Shapes[0]
+	if sh.Type != tool.Arrow || sh.StartPos != f32.Pt(1, 2) || sh.EndPos != f32.Pt(50, 60) || sh.WidthPx != 3 {
+		t.Errorf("shape = %+v", sh)
+	}
+	if sh.Arrow != (tool.ArrowStyle{Start: tool.HeadNone, End: tool.HeadFilled, Size: 12, Angle: 0.5}) {
+		t.Errorf("arrow = %+v", sh.Arrow)
+	}
+	if len(sh.Dash) != 2 || sh.FinishedAt != 1200 {
+		t.Errorf("shape dash %v, finished at %d", sh.Dash, sh.FinishedAt)
+	}
+}
+
+func TestDecodeDocumentV1(t *testing.T) {
+	c, err := DecodeDocument([]byte(documentV1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The pixels load as dp at one pixel per dp.
+	if c.Screen != (Screen{}) {
+		t.Errorf("screen = %+v, want none", c.Screen)
+	}
+	if len(c.Strokes) != 1 || c.Strokes[0].Points[1] != f32.Pt(30, 40) || c.Strokes[0].Width != 4 {
+		t.Errorf("strokes = %+v", c.Strokes)
+	}
+}
+
+func TestDecodeDocumentV2(t *testing.T) {
+	c, err := DecodeDocument([]byte(documentV2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Screen != (Screen{Width: 800, Height: 600, PxPerDp: 2}) {
+		t.Errorf("screen = %+v", c.Screen)
+	}
+	if c.Meta.Title != "Old" {
+		t.Errorf("title = %q", c.Meta.Title)
+	}
+	if len(c.Strokes) != 1 || c.Strokes[0].Points[1] != f32.Pt(60, 80) || c.Strokes[0].Width != 8 {
+		t.Errorf("strokes = %+v", c.Strokes)
+	}
+	if len(c.Shapes) != 1 || c.Shapes[0].Type != tool.Circle || c.Shapes[0].EndPos != f32.Pt(6, 8) {
+		t.Errorf("shapes = %+v", c.Shapes)
+	}
+}
+
+func TestDocumentRoundTrip(t *testing.T) {
+	c := &Canvas{
+		Screen: Screen{Width: 800, Height: 600, PxPerDp: 2},
+		Meta:   Metadata{Title: "Now", Tags: []string{"a"}},
+		Strokes: []Stroke{{
+			Points: []f32.Point{f32.Pt(2, 4), f32.Pt(6, 8)},
+			Widths: []float32{2, 4},
+			Color:  red,
+			Width:  4,
+		}, {
+			Points: []f32.Point{f32.Pt(2, 4)},
+			Color:  EraserColor,
+			Width:  8,
+			Eraser: true,
+		}},
+		Texts: []Text{{Pos: f32.Pt(10, 10), Text: "hi", Size: 32, Color: red}},
+	}
+	data, err := EncodeDocument(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := DecodeDocument(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Screen != c.Screen || got.Meta.Title != "Now" {
+		t.Errorf("screen %+v, meta %+v", got.Screen, got.Meta)
+	}
+	if len(got.Strokes) != 2 || got.Strokes[0].Points[1] != f32.Pt(6, 8) || got.Strokes[0].Widths[1] != 4 {
+		t.Fatalf("strokes = %+v", got.Strokes)
+	}
+	if got.Strokes[0].Eraser || !got.Strokes[1].Eraser {
+		t.Errorf("eraser flags %v and %v, want false and true", got.Strokes[0].Eraser, got.Strokes[1].Eraser)
+	}
+	if len(got.Texts) != 1 || got.Texts[0].Text != "hi" || got.Texts[0].Size != 32 {
+		t.Errorf("texts = %+v", got.Texts)
+	}
+}
+
+func TestDecodeDocumentErrors(t *testing.T) {
+	full, err := EncodeDocument(&Canvas{Strokes: []Stroke{{Points: []f32.Point{f32.Pt(1, 1)}, Color: red, Width: 1}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		data string
+		want error
+	}{
+		{"future version", documentFuture, ErrUnsupportedVersion},
+		{"truncated", string(full[:len(full)/2]), ErrCorruptDocument},
+		{"truncated legacy", documentV0[:len(documentV0)-20], ErrCorruptDocument},
+		{"negative version", `{"version":-1,"strokes":[],"shapes":[]}`, ErrCorruptDocument},
+		{"not an object", `[1,2]`, ErrCorruptDocument},
+		{"bad colour", `{"version":3,"strokes":[{"points":[[0,0]],"color":"red","width":1}],"shapes":[]}`, ErrCorruptDocument},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := DecodeDocument([]byte(tt.data)); !errors.Is(err, tt.want) {
+				t.Errorf("DecodeDocument: got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeMetadata(t *testing.T) {
+	meta, err := DecodeMetadata([]byte(documentV2))
+	if err != nil || meta.Title != "Old" {
+		t.Errorf("v2: got %+v, %v", meta, err)
+	}
+	if meta, err := DecodeMetadata([]byte(documentV0)); err != nil || meta.Title != "" {
+		t.Errorf("v0: got %+v, %v", meta, err)
+	}
+	errs := []struct {
+		name string
+		data string
+		want error
+	}{
+		{"future version", documentFuture, ErrUnsupportedVersion},
+		{"negative version", `{"version":-1,"meta":{"title":"x"}}`, ErrCorruptDocument},
+		{"truncated", `{"version":3,"meta":{"tit`, ErrCorruptDocument},
+		{"bad time", `{"version":3,"meta":{"created":"yesterday"}}`, ErrCorruptDocument},
+	}
+	for _, tt := range errs {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := DecodeMetadata([]byte(tt.data)); !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeDocumentUnusableDash(t *testing.T) {
+	data := `{"version":3,"strokes":[{"points":[[0,0],[10,0]],"color":"#ff0000ff","width":1,"dash":[0,6e-8]}],` +
+		`"shapes":[{"type":"line","color":"#ff0000ff","start":[0,0],"end":[10,0],"width":1,"dash":[-1,2]}]}`
+	c, err := DecodeDocument([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Strokes[0].Dash != nil || c.Shapes[0].Dash != nil {
+		t.Errorf("dashes %v and %v, want solid lines", c.Strokes[0].Dash, c.Shapes[0].Dash)
+	}
+}
@@ -0,0 +1,239 @@
+package canvas
+
+import (
+	"math"
+
+	"gioui.org/f32"
+)
+
+// pickTolerance widens thin lines so they are easy to grab with the mouse.
+const pickTolerance = 6
+
+// Selection is what the move tool drags: every element of Group, or when
+// Group is 0 the single stroke, shape or text at the given index (the other
+// indices are -1).
+type Selection struct {
+	Group  int
+	Stroke int
+	Shape  int
+	Text   int
+}
+
+// NextGroup returns a group id not used by any element yet. Elements with the
+// same non-zero Group move together.
+func (c *Canvas) NextGroup() int {
+	next := 1
+	for i := range c.Strokes {
+		next = maxInt(next, c.Strokes[i].Group+1)
+	}
+	for i := range c.Shapes {
+		next = maxInt(next, c.Shapes[i].Group+1)
+	}
+	for i := range c.Texts {
+		next = maxInt(next, c.Texts[i].Group+1)
+	}
+	return next
+}
+
+// ContentBounds returns the box around everything drawn, including line
+// widths. ok is false for an empty canvas.
+func (c *Canvas) ContentBounds() (topLeft, bottomRight f32.Point, ok bool) {
+	extend := func(p f32.Point, pad float32) {
+		if !ok {
+			topLeft, bottomRight, ok = p.Sub(f32.Pt(pad, pad)), p.Add(f32.Pt(pad, pad)), true
+			return
+		}
+		topLeft = f32.Pt(min(topLeft.X, p.X-pad), min(topLeft.Y, p.Y-pad))
+		bottomRight = f32.Pt(max(bottomRight.X, p.X+pad), max(bottomRight.Y, p.Y+pad))
+	}
+
+	for i := range c.Strokes {
+		for j, p := range c.Strokes[i].Points {
+			extend(p, c.Strokes[i].WidthAt(j)/2)
+		}
+	}
+	for i := range c.Texts {
+		a, b := c.Texts[i].Bounds()
+		extend(a, 0)
+		extend(b, 0)
+	}
+	for i := range c.Shapes {
+		s := &c.Shapes[i]
+		for _, line := range s.Outline() {
+			for _, p := range line {
+				extend(p, s.OutlineWidth()/2)
+			}
+		}
+	}
+	return topLeft, bottomRight, ok
+}
+
+// Insert merges a copy of other into c as a new group centred on center and
+// returns the group. The copies are stamped with the current time so that a
+// replay shows them appearing at the moment of insertion.
+func (c *Canvas) Insert(other *Canvas, center f32.Point) int {
+	group := c.NextGroup()
+	topLeft, bottomRight, ok := other.ContentBounds()
+	if !ok {
+		return group
+	}
+	offset := center.Sub(topLeft.Add(bottomRight).Mul(0.5))
+	at := now()
+
+	for _, s := range other.Strokes {
+		s.Points = translated(s.Points, offset)
+		s.Widths = append([]float32(nil), s.Widths...)
+		s.Dash = append([]float32(nil), s.Dash...)
+		s.StartedAt = at
+		s.Times = make([]int64, len(s.Points))
+		s.Group = group
+		c.Strokes = append(c.Strokes, s)
+	}
+	for _, s := range other.Shapes {
+		s.StartPos = s.StartPos.Add(offset)
+		s.EndPos = s.EndPos.Add(offset)
+		s.Dash = append([]float32(nil), s.Dash...)
+		s.StartedAt = at
+		s.FinishedAt = at
+		s.Group = group
+		c.Shapes = append(c.Shapes, s)
+	}
+	for _, t := range other.Texts {
+		t.Pos = t.Pos.Add(offset)
+		t.StartedAt = at
+		t.Group = group
+		c.Texts = append(c.Texts, t)
+	}
+	return group
+}
+
+// Pick finds the topmost element under p. Texts are drawn over shapes and
+// shapes over strokes, so they are checked in that order, newest to oldest.
+func (c *Canvas) Pick(p f32.Point) (Selection, bool) {
+	for i := len(c.Texts) - 1; i >= 0; i-- {
+		if c.Texts[i].contains(p, pickTolerance) {
+			return selectionOf(c.Texts[i].Group, -1, -1, i), true
+		}
+	}
+	for i := len(c.Shapes) - 1; i >= 0; i-- {
+		s := &c.Shapes[i]
+		for _, line := range s.Outline() {
+			if nearPolyline(p, line, s.OutlineWidth()/2+pickTolerance) {
+				return selectionOf(s.Group, -1, i, -1), true
+			}
+		}
+	}
+	for i := len(c.Strokes) - 1; i >= 0; i-- {
+		s := &c.Strokes[i]
+		if nearPolyline(p, s.Points, s.Width/2+pickTolerance) {
+			return selectionOf(s.Group, i, -1, -1), true
+		}
+	}
+	return Selection{}, false
+}
+
+func selectionOf(group, stroke, shape, text int) Selection {
+	if group != 0 {
+		return Selection{Group: group, Stroke: -1, Shape: -1, Text: -1}
+	}
+	return Selection{Stroke: stroke, Shape: shape, Text: text}
+}
+
+// Move shifts the selected elements by delta.
+func (c *Canvas) Move(sel Selection, delta f32.Point) {
+	for i := range c.Strokes {
+		s := &c.Strokes[i]
+		if sel.has(s.Group, i, sel.Stroke) {
+			for j := range s.Points {
+				s.Points[j] = s.Points[j].Add(delta)
+			}
+		}
+	}
+	for i := range c.Shapes {
+		s := &c.Shapes[i]
+		if sel.has(s.Group, i, sel.Shape) {
+			s.StartPos = s.StartPos.Add(delta)
+			s.EndPos = s.EndPos.Add(delta)
+		}
+	}
+	for i := range c.Texts {
+		t := &c.Texts[i]
+		if sel.has(t.Group, i, sel.Text) {
+			t.Pos = t.Pos.Add(delta)
+		}
+	}
+}
+
+// Selected returns a copy of the selected elements on a canvas of their own,
+// for the clipboard.
+func (c *Canvas) Selected(sel Selection) *Canvas {
+	all := c.Clone()
+	selected := &Canvas{Screen: c.Screen}
+	for i, s := range all.Strokes {
+		if sel.has(s.Group, i, sel.Stroke) {
+			selected.Strokes = append(selected.Strokes, s)
+		}
+	}
+	for i, s := range all.Shapes {
+		if sel.has(s.Group, i, sel.Shape) {
+			selected.Shapes = append(selected.Shapes, s)
+		}
+	}
+	for i, t := range all.Texts {
+		if sel.has(t.Group, i, sel.Text) {
+			selected.Texts = append(selected.Texts, t)
+		}
+	}
+	return selected
+}
+
+// has reports whether the element at index, in a group or not, is selected;
+// selected is the index the selection holds for that kind of element.
+func (sel Selection) has(group, index, selected int) bool {
+	if sel.Group != 0 {
+		return group == sel.Group
+	}
+	return index == selected
+}
+
+func translated(points []f32.Point, offset f32.Point) []f32.Point {
+	out := make([]f32.Point, len(points))
+	for i, p := range points {
+		out[i] = p.Add(offset)
+	}
+	return out
+}
+
+func nearPolyline(p f32.Point, line []f32.Point, radius float32) bool {
+	if len(line) == 1 {
+		return distance(p, line[0]) <= radius
+	}
+	for i := 1; i < len(line); i++ {
+		if distanceToSegment(p, line[i-1], line[i]) <= radius {
+			return true
+		}
+	}
+	return false
+}
+
+func distance(a, b f32.Point) float32 {
+	return float32(math.Hypot(float64(a.X-b.X), float64(a.Y-b.Y)))
+}
+
+func distanceToSegment(p, a, b f32.Point) float32 {
+	ab := b.Sub(a)
+	lengthSq := ab.X*ab.X + ab.Y*ab.Y
+	if lengthSq == 0 {
+		return distance(p, a)
+	}
+	t := ((p.X-a.X)*ab.X + (p.Y-a.Y)*ab.Y) / lengthSq
+	t = max(0, min(1, t))
+	return distance(p, a.Add(ab.Mul(t)))
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
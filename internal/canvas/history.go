@@ -0,0 +1,71 @@
+package canvas
+
+import "gioui.org/f32"
+
+// historyLimit bounds the undo steps kept. Every step is a full copy of the
+// drawing.
+const historyLimit = 50
+
+// History keeps copies of earlier states of a drawing for undo and redo.
+// Call Push before every change.
+type History struct {
+	undo []*Canvas
+	redo []*Canvas
+}
+
+// Push records c as it is before a change. The redo steps are dropped.
+func (h *History) Push(c *Canvas) {
+	h.undo = append(h.undo, c.Clone())
+	if len(h.undo) > historyLimit {
+		h.undo = h.undo[len(h.undo)-historyLimit:]
+	}
+	h.redo = nil
+}
+
+// Undo returns the state before the last change, keeping current for Redo.
+// ok is false when there is nothing to undo.
+func (h *History) Undo(current *Canvas) (previous *Canvas, ok bool) {
+	if len(h.undo) == 0 {
+		return current, false
+	}
+	previous = h.undo[len(h.undo)-1]
+	h.undo = h.undo[:len(h.undo)-1]
+	h.redo = append(h.redo, current.Clone())
+	return previous, true
+}
+
+// Redo takes back the last Undo.
+func (h *History) Redo(current *Canvas) (next *Canvas, ok bool) {
+	if len(h.redo) == 0 {
+		return current, false
+	}
+	next = h.redo[len(h.redo)-1]
+	h.redo = h.redo[:len(h.redo)-1]
+	h.undo = append(h.undo, current.Clone())
+	return next, true
+}
+
+// Clone returns a deep copy of the finished elements of c, its screen and
+// metadata. Anything still being drawn is left out.
+func (c *Canvas) Clone() *Canvas {
+	clone := &Canvas{
+		Strokes: make([]Stroke, len(c.Strokes)),
+		Shapes:  make([]Shape, len(c.Shapes)),
+		Texts:   append([]Text(nil), c.Texts...),
+		Screen:  c.Screen,
+		Meta:    c.Meta,
+	}
+	clone.Meta.Tags = append([]string(nil), c.Meta.Tags...)
+	for i, s := range c.Strokes {
+		s.Points = append([]f32.Point(nil), s.Points...)
+		s.Widths = append([]float32(nil), s.Widths...)
+		s.Dash = append([]float32(nil), s.Dash...)
+		s.Times = append([]int64(nil), s.Times...)
+		clone.Strokes[i] = s
+	}
+	for i, s := range c.Shapes {
+		s.Dash = append([]float32(nil), s.Dash...)
+		clone.Shapes[i] = s
+	}
+	return clone
+}
@@ -0,0 +1,159 @@
+package canvas
+
+import (
+	"fmt"
+	"io/fs"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStorage keeps encoded documents in memory. It goes through the same
+// encoding as FileStorage, so round trips behave like the real thing.
+type MemoryStorage struct {
+	mu   sync.Mutex
+	docs map[string]memoryDocument
+}
+
+type memoryDocument struct {
+	data      []byte
+	thumbnail []byte
+	modTime   time.Time
+}
+
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{docs: make(map[string]memoryDocument)}
+}
+
+func (s *MemoryStorage) List() ([]DocumentInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	docs := make([]DocumentInfo, 0, len(s.docs))
+	for name, doc := range s.docs {
+		docs = append(docs, doc.info(name))
+	}
+	sort.Slice(docs, func(i, j int) bool { return docs[i].Name < docs[j].Name })
+	return docs, nil
+}
+
+func (s *MemoryStorage) Load(name string) (*Canvas, error) {
+	if err := ValidateName(name); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	doc, ok := s.docs[name]
+	s.mu.Unlock()
+
+	if !ok {
+		return nil, notExist("load", name)
+	}
+	return DecodeDocument(doc.data)
+}
+
+func (s *MemoryStorage) Save(name string, c *Canvas) error {
+	if err := ValidateName(name); err != nil {
+		return err
+	}
+	data, err := EncodeDocument(c)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	doc := s.docs[name]
+	doc.data = data
+	doc.modTime = time.Now()
+	s.docs[name] = doc
+	return nil
+}
+
+func (s *MemoryStorage) Delete(name string) error {
+	if err := ValidateName(name); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.docs[name]; !ok {
+		return notExist("delete", name)
+	}
+	delete(s.docs, name)
+	return nil
+}
+
+func (s *MemoryStorage) Rename(oldName, newName string) error {
+	if err := ValidateName(oldName); err != nil {
+		return err
+	}
+	if err := ValidateName(newName); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	doc, ok := s.docs[oldName]
+	if !ok {
+		return notExist("rename", oldName)
+	}
+	if _, exists := s.docs[newName]; exists {
+		return fmt.Errorf("rename %s: %w", newName, fs.ErrExist)
+	}
+	delete(s.docs, oldName)
+	s.docs[newName] = doc
+	return nil
+}
+
+func (s *MemoryStorage) Stat(name string) (DocumentInfo, error) {
+	if err := ValidateName(name); err != nil {
+		return DocumentInfo{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	doc, ok := s.docs[name]
+	if !ok {
+		return DocumentInfo{}, notExist("stat", name)
+	}
+	return doc.info(name), nil
+}
+
+func (s *MemoryStorage) SaveThumbnail(name string, png []byte) error {
+	if err := ValidateName(name); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	doc, ok := s.docs[name]
+	if !ok {
+		return notExist("save thumbnail", name)
+	}
+	doc.thumbnail = png
+	s.docs[name] = doc
+	return nil
+}
+
+func (s *MemoryStorage) Thumbnail(name string) ([]byte, error) {
+	if err := ValidateName(name); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	doc, ok := s.docs[name]
+	if !ok || doc.thumbnail == nil {
+		return nil, notExist("thumbnail", name)
+	}
+	return doc.thumbnail, nil
+}
+
+func (d memoryDocument) info(name string) DocumentInfo {
+	meta, _ := DecodeMetadata(d.data)
+	return DocumentInfo{Name: name, ModTime: d.modTime, Size: int64(len(d.data)), Meta: meta}
+}
+
+func notExist(op, name string) error {
+	return fmt.Errorf("%s %s: %w", op, name, fs.ErrNotExist)
+}
@@ -0,0 +1,45 @@
+package canvas
+
+import (
+	"strings"
+	"time"
+)
+
+// Metadata describes a drawing. Title, description, tags and author are
+// edited in the save dialog; the rest is filled in when saving.
+type Metadata struct {
+	Title       string
+	Description string
+	Tags        []string
+	Author      string
+	Created     time.Time
+	Modified    time.Time
+	AppVersion  string
+}
+
+// ParseTags splits a comma-separated tag list. Blank entries and repeats,
+// ignoring case, are dropped.
+func ParseTags(s string) []string {
+	var tags []string
+	for _, tag := range strings.Split(s, ",") {
+		tag = strings.Join(strings.Fields(tag), " ")
+		if tag != "" && !hasTag(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// HasTag reports whether the drawing is tagged with tag, ignoring case.
+func (m Metadata) HasTag(tag string) bool {
+	return hasTag(m.Tags, tag)
+}
+
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
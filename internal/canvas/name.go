@@ -0,0 +1,61 @@
+package canvas
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const maxNameLength = 100
+
+// Names that Windows refuses as file names, with or without an extension.
+var reservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true,
+	"COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true,
+	"LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// CleanName trims the surrounding whitespace people tend to type or paste
+// into the filename field. The result still has to pass ValidateName.
+func CleanName(name string) string {
+	return strings.TrimSpace(name)
+}
+
+// ValidateName checks that name can be used as a document name on every
+// platform and cannot point outside the storage directory.
+func ValidateName(name string) error {
+	if name == "" {
+		return errors.New("name cannot be empty")
+	}
+	if !utf8.ValidString(name) {
+		return errors.New("name is not valid text")
+	}
+	if utf8.RuneCountInString(name) > maxNameLength {
+		return fmt.Errorf("name cannot be longer than %d characters", maxNameLength)
+	}
+	for _, r := range name {
+		switch {
+		case r == '/' || r == '\\':
+			return errors.New("name cannot contain / or \\")
+		case unicode.IsControl(r):
+			return errors.New("name cannot contain control characters")
+		case strings.ContainsRune(`<>:"|?*`, r):
+			return fmt.Errorf("name cannot contain %q", r)
+		}
+	}
+	if strings.HasPrefix(name, ".") {
+		return errors.New("name cannot start with a dot")
+	}
+	if strings.HasSuffix(name, ".") || strings.HasSuffix(name, " ") {
+		return errors.New("name cannot end with a dot or a space")
+	}
+	base, _, _ := strings.Cut(name, ".")
+	if reservedNames[strings.ToUpper(strings.TrimSpace(base))] {
+		return fmt.Errorf("%q is a reserved name", name)
+	}
+	return nil
+}
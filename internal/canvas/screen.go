@@ -0,0 +1,87 @@
+package canvas
+
+import (
+	"gioui.org/f32"
+)
+
+// Screen describes a display. Canvas coordinates and widths are physical
+// pixels of its Screen; documents store them in dp together with the screen
+// so that a drawing can be rescaled for another display.
+type Screen struct {
+	Width, Height int
+	PxPerDp       float32
+}
+
+func (s Screen) pxPerDp() float32 {
+	if s.PxPerDp <= 0 {
+		return 1
+	}
+	return s.PxPerDp
+}
+
+func (s Screen) sizeDp() f32.Point {
+	return f32.Pt(float32(s.Width), float32(s.Height)).Div(s.pxPerDp())
+}
+
+// FitTo rescales c for target, keeping sizes in dp the same. If the screen c
+// was drawn on is larger than target in dp, the drawing is shrunk further so
+// that it stays on screen. Old documents do not know their screen; their
+// drawing itself is used instead.
+func (c *Canvas) FitTo(target Screen) {
+	source := c.Screen
+	if source.Width <= 0 || source.Height <= 0 {
+		_, bottomRight, ok := c.ContentBounds()
+		if !ok {
+			c.Screen = target
+			return
+		}
+		source.Width, source.Height = int(bottomRight.X), int(bottomRight.Y)
+	}
+
+	k := target.pxPerDp() / source.pxPerDp()
+	if target.Width > 0 && target.Height > 0 && source.Width > 0 && source.Height > 0 {
+		have, want := source.sizeDp(), target.sizeDp()
+		k *= min(1, min(want.X/have.X, want.Y/have.Y))
+	}
+	c.Scale(k)
+	c.Screen = target
+}
+
+// Scale multiplies every coordinate, width, dash length and font size by k.
+func (c *Canvas) Scale(k float32) {
+	if k == 1 {
+		return
+	}
+	for i := range c.Strokes {
+		s := &c.Strokes[i]
+		for j := range s.Points {
+			s.Points[j] = s.Points[j].Mul(k)
+		}
+		s.Width *= k
+		s.Widths = scaledDash(s.Widths, k)
+		s.Dash = scaledDash(s.Dash, k)
+	}
+	for i := range c.Shapes {
+		s := &c.Shapes[i]
+		s.StartPos = s.StartPos.Mul(k)
+		s.EndPos = s.EndPos.Mul(k)
+		s.WidthPx *= k
+		s.Dash = scaledDash(s.Dash, k)
+	}
+	for i := range c.Texts {
+		t := &c.Texts[i]
+		t.Pos = t.Pos.Mul(k)
+		t.Size *= k
+	}
+}
+
+func scaledDash(lengths []float32, k float32) []float32 {
+	if lengths == nil {
+		return nil
+	}
+	out := make([]float32, len(lengths))
+	for i, d := range lengths {
+		out[i] = d * k
+	}
+	return out
+}
@@ -0,0 +1,133 @@
+package canvas
+
+import (
+	"image/color"
+	"math"
+
+	"gioui.org/f32"
+
+	"screenpengo/internal/tool"
+)
+
+const minOutlineWidth = 2
+
+type Shape struct {
+	Type       tool.ShapeType
+	Color      color.NRGBA
+	StartPos   f32.Point
+	EndPos     f32.Point
+	WidthPx    float32
+	Dash       []float32
+	Arrow      tool.ArrowStyle
+	StartedAt  int64
+	FinishedAt int64
+	Group      int
+}
+
+func (s *Shape) OutlineWidth() float32 {
+	return max(minOutlineWidth, s.WidthPx)
+}
+
+func (s *Shape) Radius() float32 {
+	dx := float64(s.EndPos.X - s.StartPos.X)
+	dy := float64(s.EndPos.Y - s.StartPos.Y)
+	return float32(math.Hypot(dx, dy))
+}
+
+func (s *Shape) Bounds() (topLeft, bottomRight f32.Point) {
+	topLeft = f32.Pt(min(s.StartPos.X, s.EndPos.X), min(s.StartPos.Y, s.EndPos.Y))
+	bottomRight = f32.Pt(max(s.StartPos.X, s.EndPos.X), max(s.StartPos.Y, s.EndPos.Y))
+	return topLeft, bottomRight
+}
+
+type ArrowHeadGeometry struct {
+	Style tool.ArrowHead
+	// Points is the V for open heads, the polygon for triangles and
+	// diamonds and the segment for bars.
+	Points []f32.Point
+	Center f32.Point
+	Radius float32
+}
+
+func (s *Shape) ArrowHeads() []ArrowHeadGeometry {
+	if s.Type != tool.Arrow {
+		return nil
+	}
+
+	dx := s.EndPos.X - s.StartPos.X
+	dy := s.EndPos.Y - s.StartPos.Y
+	length := float32(math.Hypot(float64(dx), float64(dy)))
+	if length < 1 {
+		return nil
+	}
+
+	style := s.Arrow.OrDefault()
+	dir := f32.Pt(dx/length, dy/length)
+	size := s.OutlineWidth() * style.Size
+	angle := float64(style.Angle) * math.Pi / 180
+
+	var heads []ArrowHeadGeometry
+	if style.End != tool.HeadNone {
+		heads = append(heads, arrowHead(style.End, s.EndPos, dir, size, angle))
+	}
+	if style.Start != tool.HeadNone {
+		heads = append(heads, arrowHead(style.Start, s.StartPos, dir.Mul(-1), size, angle))
+	}
+	return heads
+}
+
+func arrowHead(style tool.ArrowHead, tip, dir f32.Point, size float32, angle float64) ArrowHeadGeometry {
+	cos := float32(math.Cos(angle))
+	sin := float32(math.Sin(angle))
+	perp := f32.Pt(-dir.Y, dir.X)
+	head := ArrowHeadGeometry{Style: style}
+
+	switch style {
+	case tool.HeadOpen, tool.HeadFilled:
+		left := tip.Sub(dir.Mul(size * cos)).Add(perp.Mul(size * sin))
+		right := tip.Sub(dir.Mul(size * cos)).Sub(perp.Mul(size * sin))
+		head.Points = []f32.Point{left, tip, right}
+	case tool.HeadCircle:
+		head.Radius = size * sin
+		head.Center = tip.Sub(dir.Mul(head.Radius))
+	case tool.HeadBar:
+		head.Points = []f32.Point{tip.Add(perp.Mul(size * sin)), tip.Sub(perp.Mul(size * sin))}
+	case tool.HeadDiamond:
+		halfWidth := size / 2 * float32(math.Tan(angle))
+		middle := tip.Sub(dir.Mul(size / 2))
+		head.Points = []f32.Point{
+			tip,
+			middle.Add(perp.Mul(halfWidth)),
+			tip.Sub(dir.Mul(size)),
+			middle.Sub(perp.Mul(halfWidth)),
+		}
+	}
+	return head
+}
+
+// Outline returns the shape body as polylines, without arrow wings.
+func (s *Shape) Outline() [][]f32.Point {
+	switch s.Type {
+	case tool.Circle:
+		radius := float64(s.Radius())
+		if radius < 1 {
+			return nil
+		}
+		numPoints := int(math.Max(32, radius*2))
+		points := make([]f32.Point, 0, numPoints+1)
+		for i := 0; i <= numPoints; i++ {
+			angle := float64(i) * 2.0 * math.Pi / float64(numPoints)
+			points = append(points, f32.Pt(
+				s.StartPos.X+float32(radius*math.Cos(angle)),
+				s.StartPos.Y+float32(radius*math.Sin(angle)),
+			))
+		}
+		return [][]f32.Point{points}
+	case tool.Rectangle:
+		tl, br := s.Bounds()
+		return [][]f32.Point{{tl, f32.Pt(br.X, tl.Y), br, f32.Pt(tl.X, br.Y), tl}}
+	case tool.Line, tool.Arrow:
+		return [][]f32.Point{{s.StartPos, s.EndPos}}
+	}
+	return nil
+}
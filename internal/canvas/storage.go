@@ -0,0 +1,244 @@
+package canvas
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+const (
+	documentExt  = ".json"
+	thumbnailDir = ".thumbnails"
+)
+
+type DocumentInfo struct {
+	Name    string
+	ModTime time.Time
+	Size    int64
+	Meta    Metadata
+}
+
+// Storage keeps named drawings. Names never include the file extension and
+// must pass ValidateName. Missing documents are reported with
+// fs.ErrNotExist, and Rename refuses to replace an existing document with
+// fs.ErrExist.
+type Storage interface {
+	List() ([]DocumentInfo, error)
+	Load(name string) (*Canvas, error)
+	Save(name string, c *Canvas) error
+	Delete(name string) error
+	Rename(oldName, newName string) error
+	Stat(name string) (DocumentInfo, error)
+
+	// Thumbnails are PNG previews kept next to the document. They are
+	// deleted and renamed together with it.
+	SaveThumbnail(name string, png []byte) error
+	Thumbnail(name string) ([]byte, error)
+}
+
+// DataDir picks the directory for drawings: $SCREENPEN_DIR if set, then the
+// pre-XDG ~/.screenpen if it already exists, then $XDG_DATA_HOME/screenpen
+// or the platform default for it.
+func DataDir() (string, error) {
+	if dir := os.Getenv("SCREENPEN_DIR"); dir != "" {
+		return dir, nil
+	}
+
+	home, homeErr := os.UserHomeDir()
+	if homeErr == nil {
+		legacy := filepath.Join(home, ".screenpen")
+		if info, err := os.Stat(legacy); err == nil && info.IsDir() {
+			return legacy, nil
+		}
+	}
+
+	if dir := os.Getenv("XDG_DATA_HOME"); dir != "" {
+		return filepath.Join(dir, "screenpen"), nil
+	}
+
+	switch runtime.GOOS {
+	case "windows", "darwin":
+		dir, err := os.UserConfigDir()
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(dir, "screenpen"), nil
+	}
+
+	if homeErr != nil {
+		return "", errors.New("cannot find a directory for drawings: set SCREENPEN_DIR or XDG_DATA_HOME")
+	}
+	return filepath.Join(home, ".local", "share", "screenpen"), nil
+}
+
+type FileStorage struct {
+	Dir string
+}
+
+func NewFileStorage(dir string) (*FileStorage, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &FileStorage{Dir: dir}, nil
+}
+
+func (s *FileStorage) Path(name string) string {
+	return filepath.Join(s.Dir, name+documentExt)
+}
+
+func (s *FileStorage) thumbnailPath(name string) string {
+	return filepath.Join(s.Dir, thumbnailDir, name+".png")
+}
+
+func (s *FileStorage) List() ([]DocumentInfo, error) {
+	entries, err := os.ReadDir(s.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var docs []DocumentInfo
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || filepath.Ext(name) != documentExt {
+			continue
+		}
+		name = strings.TrimSuffix(name, documentExt)
+		if ValidateName(name) != nil {
+			continue
+		}
+		info, err := s.Stat(name)
+		if err != nil {
+			continue
+		}
+		docs = append(docs, info)
+	}
+	return docs, nil
+}
+
+func (s *FileStorage) Load(name string) (*Canvas, error) {
+	if err := ValidateName(name); err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(s.Path(name))
+	if err != nil {
+		return nil, err
+	}
+	return DecodeDocument(data)
+}
+
+func (s *FileStorage) Save(name string, c *Canvas) error {
+	if err := ValidateName(name); err != nil {
+		return err
+	}
+	data, err := EncodeDocument(c)
+	if err != nil {
+		return err
+	}
+	return WriteFileAtomic(s.Path(name), data)
+}
+
+func (s *FileStorage) Delete(name string) error {
+	if err := ValidateName(name); err != nil {
+		return err
+	}
+	if err := os.Remove(s.Path(name)); err != nil {
+		return err
+	}
+	if err := os.Remove(s.thumbnailPath(name)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *FileStorage) Rename(oldName, newName string) error {
+	if err := ValidateName(oldName); err != nil {
+		return err
+	}
+	if err := ValidateName(newName); err != nil {
+		return err
+	}
+	if _, err := os.Stat(s.Path(oldName)); err != nil {
+		return err
+	}
+	if _, err := os.Stat(s.Path(newName)); err == nil {
+		return fmt.Errorf("rename %s: %w", newName, fs.ErrExist)
+	}
+	if err := os.Rename(s.Path(oldName), s.Path(newName)); err != nil {
+		return err
+	}
+	err := os.Rename(s.thumbnailPath(oldName), s.thumbnailPath(newName))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *FileStorage) Stat(name string) (DocumentInfo, error) {
+	if err := ValidateName(name); err != nil {
+		return DocumentInfo{}, err
+	}
+	info, err := os.Stat(s.Path(name))
+	if err != nil {
+		return DocumentInfo{}, err
+	}
+	return DocumentInfo{Name: name, ModTime: info.ModTime(), Size: info.Size(), Meta: s.metadata(name)}, nil
+}
+
+// metadata is best effort: a document that cannot be read is still listed,
+// and loading it reports the problem.
+func (s *FileStorage) metadata(name string) Metadata {
+	data, err := os.ReadFile(s.Path(name))
+	if err != nil {
+		return Metadata{}
+	}
+	meta, _ := DecodeMetadata(data)
+	return meta
+}
+
+func (s *FileStorage) SaveThumbnail(name string, png []byte) error {
+	if err := ValidateName(name); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Join(s.Dir, thumbnailDir), 0o755); err != nil {
+		return err
+	}
+	return WriteFileAtomic(s.thumbnailPath(name), png)
+}
+
+func (s *FileStorage) Thumbnail(name string) ([]byte, error) {
+	if err := ValidateName(name); err != nil {
+		return nil, err
+	}
+	return os.ReadFile(s.thumbnailPath(name))
+}
+
+// WriteFileAtomic writes data to a temporary file next to path and renames it
+// into place, so a crash never leaves a half-written file behind.
+func WriteFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,184 @@
+package canvas
+
+import (
+	"bytes"
+	"errors"
+	"image/color"
+	"io/fs"
+	"testing"
+
+	"gioui.org/f32"
+)
+
+// storageBackends are the Storage implementations the contract tests run
+// against.
+var storageBackends = []struct {
+	name string
+	open func(t *testing.T) Storage
+}{
+	{"file", func(t *testing.T) Storage {
+		s, err := NewFileStorage(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}},
+	{"memory", func(t *testing.T) Storage { return NewMemoryStorage() }},
+}
+
+func forEachStorage(t *testing.T, test func(t *testing.T, s Storage)) {
+	for _, b := range storageBackends {
+		t.Run(b.name, func(t *testing.T) { test(t, b.open(t)) })
+	}
+}
+
+func testDrawing(title string) *Canvas {
+	c := &Canvas{Meta: Metadata{Title: title}}
+	c.Strokes = []Stroke{{
+		Color:  color.NRGBA{R: 255, A: 255},
+		Width:  4,
+		Points: []f32.Point{f32.Pt(1, 2), f32.Pt(3, 4)},
+	}}
+	return c
+}
+
+func TestStorageRoundTrip(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, s Storage) {
+		if err := s.Save("sketch", testDrawing("Sketch")); err != nil {
+			t.Fatal(err)
+		}
+		c, err := s.Load("sketch")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(c.Strokes) != 1 || len(c.Strokes[0].Points) != 2 {
+			t.Errorf("loaded %d strokes, want 1 with 2 points", len(c.Strokes))
+		}
+		info, err := s.Stat("sketch")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Name != "sketch" || info.Meta.Title != "Sketch" || info.Size == 0 {
+			t.Errorf("Stat = %+v", info)
+		}
+	})
+}
+
+func TestStorageList(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, s Storage) {
+		for _, name := range []string{"b", "a", "c"} {
+			if err := s.Save(name, testDrawing(name)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		docs, err := s.List()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, doc := range docs {
+			names = append(names, doc.Name)
+		}
+		if len(names) != 3 || names[0] != "a" || names[1] != "b" || names[2] != "c" {
+			t.Errorf("List = %v, want [a b c]", names)
+		}
+	})
+}
+
+func TestStorageMissing(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, s Storage) {
+		_, loadErr := s.Load("missing")
+		_, statErr := s.Stat("missing")
+		_, thumbErr := s.Thumbnail("missing")
+		errs := map[string]error{
+			"Load":      loadErr,
+			"Stat":      statErr,
+			"Delete":    s.Delete("missing"),
+			"Rename":    s.Rename("missing", "other"),
+			"Thumbnail": thumbErr,
+		}
+		for op, err := range errs {
+			if !errors.Is(err, fs.ErrNotExist) {
+				t.Errorf("%s: got %v, want fs.ErrNotExist", op, err)
+			}
+		}
+	})
+}
+
+func TestStorageInvalidNames(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, s Storage) {
+		if err := s.Save("valid", testDrawing("")); err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range []string{"", "../valid", "a/b", ".hidden", "trailing."} {
+			_, loadErr := s.Load(name)
+			_, statErr := s.Stat(name)
+			_, thumbErr := s.Thumbnail(name)
+			errs := map[string]error{
+				"Save":          s.Save(name, testDrawing("")),
+				"Load":          loadErr,
+				"Stat":          statErr,
+				"Delete":        s.Delete(name),
+				"Rename from":   s.Rename(name, "other"),
+				"Rename to":     s.Rename("valid", name),
+				"SaveThumbnail": s.SaveThumbnail(name, []byte("png")),
+				"Thumbnail":     thumbErr,
+			}
+			for op, err := range errs {
+				// A missing document would be reported with fs.ErrNotExist;
+				// the name has to be turned down before that.
+				if err == nil || errors.Is(err, fs.ErrNotExist) {
+					t.Errorf("%s %q: got %v, want the name rejected", op, name, err)
+				}
+			}
+		}
+	})
+}
+
+func TestStorageRename(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, s Storage) {
+		for _, name := range []string{"old", "taken"} {
+			if err := s.Save(name, testDrawing(name)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := s.SaveThumbnail("old", []byte("png")); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Rename("old", "taken"); !errors.Is(err, fs.ErrExist) {
+			t.Errorf("Rename onto an existing document: got %v, want fs.ErrExist", err)
+		}
+		if err := s.Rename("old", "new"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.Stat("old"); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("old name still there: %v", err)
+		}
+		if info, err := s.Stat("new"); err != nil || info.Meta.Title != "old" {
+			t.Errorf("Stat(new) = %+v, %v", info, err)
+		}
+		if thumb, err := s.Thumbnail("new"); err != nil || !bytes.Equal(thumb, []byte("png")) {
+			t.Errorf("thumbnail not moved along: %q, %v", thumb, err)
+		}
+	})
+}
+
+func TestStorageDelete(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, s Storage) {
+		if err := s.Save("doomed", testDrawing("")); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.SaveThumbnail("doomed", []byte("png")); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Delete("doomed"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.Load("doomed"); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("Load after Delete: %v", err)
+		}
+		if _, err := s.Thumbnail("doomed"); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("Thumbnail after Delete: %v", err)
+		}
+	})
+}
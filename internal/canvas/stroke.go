@@ -7,10 +7,100 @@ import (
 	"gioui.org/f32"
 )
 
+// EraserColor is what the eraser paints with.
+var EraserColor = color.NRGBA{R: 255, G: 255, B: 255, A: 255}
+
 type Stroke struct {
 	Points []f32.Point
 	Color  color.NRGBA
 	Width  float32
+	// Widths, if set, gives the width at each point for pressure-sensitive
+	// ink from other programs. Width is then the nominal width.
+	Widths    []float32
+	Dash      []float32
+	StartedAt int64
+	Times     []int64
+	Group     int
+	// Eraser marks strokes drawn with the eraser, which paint over the
+	// strokes before them. Ink that merely has EraserColor is not one.
+	Eraser bool
+}
+
+// WidthAt returns the width of the stroke at point i.
+func (s *Stroke) WidthAt(i int) float32 {
+	if i < len(s.Widths) {
+		return s.Widths[i]
+	}
+	return s.Width
+}
+
+// Densify fills in points along each segment so that neighbouring points
+// are at most half a width apart, as they are when drawing with the pen.
+// Strokes are drawn as a dot per point, so imported outlines, which only
+// have their corners, need this. Widths and timestamps are interpolated.
+func (s *Stroke) Densify() {
+	if len(s.Points) < 2 {
+		return
+	}
+	points := []f32.Point{s.Points[0]}
+	var widths []float32
+	if s.Widths != nil {
+		widths = []float32{s.Widths[0]}
+	}
+	var times []int64
+	if len(s.Times) == len(s.Points) {
+		times = []int64{s.Times[0]}
+	}
+	for i := 1; i < len(s.Points); i++ {
+		a, b := s.Points[i-1], s.Points[i]
+		spacing := float64(max(1, min(s.WidthAt(i-1), s.WidthAt(i))/2))
+		steps := maxInt(1, int(math.Ceil(math.Hypot(float64(b.X-a.X), float64(b.Y-a.Y))/spacing)))
+		for j := 1; j <= steps; j++ {
+			t := float32(j) / float32(steps)
+			points = append(points, a.Add(b.Sub(a).Mul(t)))
+			if widths != nil {
+				widths = append(widths, s.Widths[i-1]+(s.Widths[i]-s.Widths[i-1])*t)
+			}
+			if times != nil {
+				times = append(times, s.Times[i-1]+(s.Times[i]-s.Times[i-1])*int64(j)/int64(steps))
+			}
+		}
+	}
+	s.Points, s.Widths, s.Times = points, widths, times
+}
+
+// Covers reports whether the stroke paints over p.
+func (s *Stroke) Covers(p f32.Point) bool {
+	if len(s.Points) == 1 {
+		return distance(p, s.Points[0]) <= s.WidthAt(0)/2
+	}
+	for i := 1; i < len(s.Points); i++ {
+		if distanceToSegment(p, s.Points[i-1], s.Points[i]) <= max(s.WidthAt(i-1), s.WidthAt(i))/2 {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Stroke) FinishedAt() int64 {
+	if len(s.Times) == 0 {
+		return s.StartedAt
+	}
+	return s.StartedAt + s.Times[len(s.Times)-1]
+}
+
+func (s *Stroke) appendTimes(count int, at int64) {
+	if count <= 0 {
+		return
+	}
+	offset := at - s.StartedAt
+	var last int64
+	if len(s.Times) > 0 {
+		last = s.Times[len(s.Times)-1]
+	}
+	for i := 1; i <= count; i++ {
+		s.Times = append(s.Times, last+(offset-last)*int64(i)/int64(count))
+	}
 }
 
 func appendInterpolated(dst *[]f32.Point, a, b f32.Point, spacing float32) {
@@ -0,0 +1,46 @@
+package canvas
+
+import (
+	"image/color"
+	"strings"
+	"unicode/utf8"
+
+	"gioui.org/f32"
+)
+
+// Text is a block of text imported from another program; it cannot be typed
+// in screenpen itself. Pos is the top-left corner and Size the font size,
+// both in pixels like all other canvas coordinates.
+type Text struct {
+	Pos       f32.Point
+	Text      string
+	Size      float32
+	Color     color.NRGBA
+	Font      string
+	StartedAt int64
+	Group     int
+}
+
+// Average glyph advance and line height relative to the font size, for
+// picking and erasing without running the text shaper.
+const (
+	textAdvance    = 0.55
+	textLineHeight = 1.2
+)
+
+// Bounds estimates the box the text covers.
+func (t *Text) Bounds() (topLeft, bottomRight f32.Point) {
+	lines := strings.Split(t.Text, "\n")
+	longest := 0
+	for _, line := range lines {
+		longest = maxInt(longest, utf8.RuneCountInString(line))
+	}
+	size := f32.Pt(float32(longest)*t.Size*textAdvance, float32(len(lines))*t.Size*textLineHeight)
+	return t.Pos, t.Pos.Add(size)
+}
+
+func (t *Text) contains(p f32.Point, radius float32) bool {
+	topLeft, bottomRight := t.Bounds()
+	return p.X >= topLeft.X-radius && p.X <= bottomRight.X+radius &&
+		p.Y >= topLeft.Y-radius && p.Y <= bottomRight.Y+radius
+}
@@ -0,0 +1,86 @@
+package canvas
+
+import "time"
+
+func (c *Canvas) TimeRange() (start, end int64) {
+	first := true
+	extend := func(from, to int64) {
+		if from == 0 {
+			return
+		}
+		if first || from < start {
+			start = from
+		}
+		if first || to > end {
+			end = to
+		}
+		first = false
+	}
+
+	for i := range c.Strokes {
+		extend(c.Strokes[i].StartedAt, c.Strokes[i].FinishedAt())
+	}
+	for i := range c.Shapes {
+		extend(c.Shapes[i].StartedAt, max64(c.Shapes[i].StartedAt, c.Shapes[i].FinishedAt))
+	}
+	for i := range c.Texts {
+		extend(c.Texts[i].StartedAt, c.Texts[i].StartedAt)
+	}
+	return start, end
+}
+
+func (c *Canvas) Duration() time.Duration {
+	start, end := c.TimeRange()
+	return time.Duration(end-start) * time.Millisecond
+}
+
+// Snapshot returns the drawing as it looked the given time after the first
+// recorded element was started. Elements without timestamps (drawings saved
+// before timing was recorded) are always visible. The snapshot shares point
+// data with c; Clone it before handing it to another goroutine.
+func (c *Canvas) Snapshot(elapsed time.Duration) *Canvas {
+	origin, _ := c.TimeRange()
+	cutoff := origin + elapsed.Milliseconds()
+
+	snapshot := &Canvas{}
+	for i := range c.Strokes {
+		s := &c.Strokes[i]
+		if s.StartedAt == 0 || len(s.Times) != len(s.Points) {
+			snapshot.Strokes = append(snapshot.Strokes, *s)
+			continue
+		}
+		if s.StartedAt > cutoff {
+			continue
+		}
+
+		visible := 0
+		for visible < len(s.Times) && s.StartedAt+s.Times[visible] <= cutoff {
+			visible++
+		}
+		partial := *s
+		partial.Points = s.Points[:visible]
+		partial.Times = s.Times[:visible]
+		snapshot.Strokes = append(snapshot.Strokes, partial)
+	}
+
+	for i := range c.Shapes {
+		s := &c.Shapes[i]
+		if s.StartedAt == 0 || max64(s.StartedAt, s.FinishedAt) <= cutoff {
+			snapshot.Shapes = append(snapshot.Shapes, *s)
+		}
+	}
+
+	for i := range c.Texts {
+		if c.Texts[i].StartedAt <= cutoff {
+			snapshot.Texts = append(snapshot.Texts, c.Texts[i])
+		}
+	}
+	return snapshot
+}
+
+func max64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,73 @@
+package editor
+
+import (
+	"gioui.org/f32"
+	"gioui.org/layout"
+
+	"screenpengo/internal/render"
+)
+
+// move drags whatever is under the pointer instead of drawing. Hovering
+// outlines what a press would grab.
+type move struct {
+	last     f32.Point
+	hovered  Selection
+	dragging bool
+	moved    bool
+}
+
+func (t *move) Press(ctx *Context, p f32.Point) {
+	sel, ok := ctx.Canvas.Pick(p)
+	*ctx.Selection = Selection{Selection: sel, Valid: ok}
+	t.last = p
+	t.dragging = ok
+	t.moved = false
+}
+
+func (t *move) Drag(ctx *Context, p f32.Point) {
+	if !t.dragging {
+		return
+	}
+	if !t.moved {
+		ctx.History.Push(ctx.Canvas)
+		t.moved = true
+	}
+	ctx.Canvas.Move(ctx.Selection.Selection, p.Sub(t.last))
+	t.last = p
+}
+
+func (t *move) Release(ctx *Context) {
+	t.dragging = false
+}
+
+func (t *move) Cancel(ctx *Context) {
+	t.dragging = false
+	t.hovered = Selection{}
+}
+
+func (t *move) Hover(ctx *Context, p f32.Point) {
+	sel, ok := ctx.Canvas.Pick(p)
+	t.hovered = Selection{Selection: sel, Valid: ok}
+}
+
+func (t *move) Busy(ctx *Context) bool {
+	return t.dragging
+}
+
+// Preview outlines the element being dragged, or else the one under the
+// pointer.
+func (t *move) Preview(gtx layout.Context, ctx *Context) {
+	sel := t.hovered
+	if t.dragging {
+		sel = *ctx.Selection
+	}
+	if !sel.Valid {
+		return
+	}
+	if topLeft, bottomRight, ok := ctx.Canvas.Selected(sel.Selection).ContentBounds(); ok {
+		render.DrawSelection(gtx.Ops, topLeft, bottomRight)
+	}
+}
+
+// Cursor is left to the system pointer.
+func (t *move) Cursor(gtx layout.Context, ctx *Context, p f32.Point) {}
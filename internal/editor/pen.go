@@ -0,0 +1,54 @@
+package editor
+
+import (
+	"gioui.org/f32"
+	"gioui.org/layout"
+)
+
+// pen draws freehand strokes. As the eraser it paints over strokes and
+// removes the shapes and texts it touches.
+type pen struct {
+	eraser bool
+}
+
+func (t *pen) Press(ctx *Context, p f32.Point) {
+	widthPx := ctx.widthPx()
+	if t.eraser {
+		ctx.Canvas.StartErasing(widthPx, p)
+		return
+	}
+	ctx.Canvas.StartStroke(ctx.State.Pen.Color, widthPx, ctx.State.Pen.DashPattern(widthPx), p)
+}
+
+func (t *pen) Drag(ctx *Context, p f32.Point) {
+	ctx.Canvas.AddPoint(p)
+}
+
+func (t *pen) Release(ctx *Context) {
+	c := ctx.Canvas
+	if c.Current == nil {
+		return
+	}
+	ctx.History.Push(c)
+	c.FinishStroke()
+	if t.eraser {
+		c.RemoveShapesIntersectingStroke(&c.Strokes[len(c.Strokes)-1])
+	}
+}
+
+func (t *pen) Cancel(ctx *Context) {
+	ctx.Canvas.Current = nil
+}
+
+func (t *pen) Hover(ctx *Context, p f32.Point) {}
+
+func (t *pen) Busy(ctx *Context) bool {
+	return ctx.Canvas.Current != nil
+}
+
+// Preview has nothing to add: the canvas draws the stroke in progress.
+func (t *pen) Preview(gtx layout.Context, ctx *Context) {}
+
+func (t *pen) Cursor(gtx layout.Context, ctx *Context, p f32.Point) {
+	penCursor(gtx, ctx, p)
+}
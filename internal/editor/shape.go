@@ -0,0 +1,45 @@
+package editor
+
+import (
+	"gioui.org/f32"
+	"gioui.org/layout"
+)
+
+// shape draws the shape picked in tool.State, from where the pointer is
+// pressed to where it is released.
+type shape struct{}
+
+func (t *shape) Press(ctx *Context, p f32.Point) {
+	pen := &ctx.State.Pen
+	widthPx := ctx.widthPx()
+	ctx.Canvas.StartShape(ctx.State.Shape.Type, pen.Color, widthPx, pen.DashPattern(widthPx), ctx.State.Shape.Arrow, p)
+}
+
+func (t *shape) Drag(ctx *Context, p f32.Point) {
+	ctx.Canvas.UpdateShape(p)
+}
+
+func (t *shape) Release(ctx *Context) {
+	if ctx.Canvas.CurrentShape == nil {
+		return
+	}
+	ctx.History.Push(ctx.Canvas)
+	ctx.Canvas.FinishShape()
+}
+
+func (t *shape) Cancel(ctx *Context) {
+	ctx.Canvas.CurrentShape = nil
+}
+
+func (t *shape) Hover(ctx *Context, p f32.Point) {}
+
+func (t *shape) Busy(ctx *Context) bool {
+	return ctx.Canvas.CurrentShape != nil
+}
+
+// Preview has nothing to add: the canvas draws the shape in progress.
+func (t *shape) Preview(gtx layout.Context, ctx *Context) {}
+
+func (t *shape) Cursor(gtx layout.Context, ctx *Context, p f32.Point) {
+	penCursor(gtx, ctx, p)
+}
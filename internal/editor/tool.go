@@ -0,0 +1,100 @@
+// Package editor holds the tools that turn pointer input into changes of
+// the drawing. The application only passes events to the active tool, so a
+// new tool needs a Tool implementation and an entry in the registry, and
+// nothing in the application loop.
+package editor
+
+import (
+	"fmt"
+	"image"
+	"sort"
+
+	"gioui.org/f32"
+	"gioui.org/layout"
+
+	"screenpengo/internal/canvas"
+	"screenpengo/internal/render"
+	"screenpengo/internal/tool"
+)
+
+// Tool is one way of working with the pointer. Press starts an operation,
+// Drag continues it and Release finishes it; Cancel drops an unfinished one,
+// for example when another tool is picked mid-way. Hover follows the
+// pointer while no button is held.
+type Tool interface {
+	Press(ctx *Context, p f32.Point)
+	Drag(ctx *Context, p f32.Point)
+	Release(ctx *Context)
+	Cancel(ctx *Context)
+	Hover(ctx *Context, p f32.Point)
+	// Busy reports whether an operation is under way.
+	Busy(ctx *Context) bool
+	// Preview draws what the tool shows over the drawing besides the
+	// drawing itself, and Cursor the pointer at p.
+	Preview(gtx layout.Context, ctx *Context)
+	Cursor(gtx layout.Context, ctx *Context, p f32.Point)
+}
+
+// Context is what tools work on. It is made afresh for every event, as the
+// application replaces the canvas on undo or loading.
+type Context struct {
+	Canvas *canvas.Canvas
+	State  *tool.State
+	// History is pushed before every change, for undo.
+	History *canvas.History
+	// Selection is what was grabbed last. Copying uses it too.
+	Selection *Selection
+	// PxPerDp converts widths set in dp to canvas pixels.
+	PxPerDp float32
+}
+
+// Selection is a canvas.Selection that may be empty.
+type Selection struct {
+	canvas.Selection
+	Valid bool
+}
+
+// widthPx is the pen width in canvas pixels.
+func (ctx *Context) widthPx() float32 {
+	return ctx.State.Pen.WidthDp * ctx.PxPerDp
+}
+
+// registry makes the tools, keyed by their name in tool.State.
+var registry = map[string]func() Tool{
+	tool.PenTool:    func() Tool { return &pen{} },
+	tool.EraserTool: func() Tool { return &pen{eraser: true} },
+	tool.ShapeTool:  func() Tool { return &shape{} },
+	tool.MoveTool:   func() Tool { return &move{} },
+}
+
+// Register adds a tool, which tool.State.Select then picks by name.
+func Register(name string, newTool func() Tool) {
+	if _, ok := registry[name]; ok {
+		panic(fmt.Sprintf("editor: tool %q registered twice", name))
+	}
+	registry[name] = newTool
+}
+
+// Names lists the registered tools.
+func Names() []string {
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// New makes the tool registered as name.
+func New(name string) (Tool, bool) {
+	newTool, ok := registry[name]
+	if !ok {
+		return nil, false
+	}
+	return newTool(), true
+}
+
+// penCursor is the cursor of the drawing tools: a ring the size of the pen.
+func penCursor(gtx layout.Context, ctx *Context, p f32.Point) {
+	render.DrawCursor(gtx.Ops, image.Pt(int(p.X), int(p.Y)), int(ctx.widthPx()/2))
+}
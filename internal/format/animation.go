@@ -0,0 +1,163 @@
+package format
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"image/png"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+
+	"screenpengo/internal/canvas"
+	"screenpengo/internal/render"
+)
+
+const (
+	gifHoldLastFrame = 2 * time.Second
+	maxAnimFrames    = 5000
+)
+
+type AnimationOptions struct {
+	ScreenWidth  int
+	ScreenHeight int
+	Scale        float32
+	FrameRate    float64
+	SpeedUp      float64
+	// Background is only used for GIF output, which has no partial
+	// transparency. PNG frames keep the alpha channel for compositing.
+	Background color.NRGBA
+}
+
+func (o AnimationOptions) frameTimes(total time.Duration) ([]time.Duration, error) {
+	if o.ScreenWidth <= 0 || o.ScreenHeight <= 0 {
+		return nil, errors.New("animation: screen size is not set")
+	}
+	if o.FrameRate <= 0 || o.SpeedUp <= 0 {
+		return nil, errors.New("animation: frame rate and speed-up must be positive")
+	}
+
+	step := time.Duration(float64(time.Second) / o.FrameRate * o.SpeedUp)
+	count := int(math.Ceil(float64(total)/float64(step))) + 1
+	if count > maxAnimFrames {
+		return nil, fmt.Errorf("animation: %d frames exceeds the limit of %d, increase the speed-up", count, maxAnimFrames)
+	}
+
+	times := make([]time.Duration, count)
+	for i := range times {
+		times[i] = min(time.Duration(i)*step, total)
+	}
+	return times, nil
+}
+
+func (o AnimationOptions) frame(c *canvas.Canvas, at time.Duration, background color.NRGBA) *image.NRGBA {
+	return render.Rasterize(c.Snapshot(at), o.ScreenWidth, o.ScreenHeight, o.Scale, background)
+}
+
+func WriteGIF(w io.Writer, c *canvas.Canvas, opts AnimationOptions) error {
+	times, err := opts.frameTimes(c.Duration())
+	if err != nil {
+		return err
+	}
+
+	background := opts.Background
+	background.A = 255
+
+	last := opts.frame(c, times[len(times)-1], background)
+	pal := gifPalette(last)
+	delay := int(math.Round(100 / opts.FrameRate))
+
+	anim := &gif.GIF{}
+	for i, at := range times {
+		img := last
+		if i < len(times)-1 {
+			img = opts.frame(c, at, background)
+		}
+
+		frame := image.NewPaletted(img.Bounds(), pal)
+		draw.Draw(frame, frame.Bounds(), img, image.Point{}, draw.Src)
+		anim.Image = append(anim.Image, frame)
+		anim.Delay = append(anim.Delay, max(delay, 2))
+	}
+	anim.Delay[len(anim.Delay)-1] = int(gifHoldLastFrame / (10 * time.Millisecond))
+
+	return gif.EncodeAll(w, anim)
+}
+
+func SaveGIF(path string, c *canvas.Canvas, opts AnimationOptions) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := WriteGIF(f, c, opts); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// SavePNGSequence writes numbered frames (frame_00001.png, ...) into dir and
+// returns the number of frames written. Frames left in dir by an earlier
+// export are removed first, so that a shorter sequence does not end with
+// stale ones; other files are kept.
+func SavePNGSequence(dir string, c *canvas.Canvas, opts AnimationOptions) (int, error) {
+	times, err := opts.frameTimes(c.Duration())
+	if err != nil {
+		return 0, err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return 0, err
+	}
+	stale, err := filepath.Glob(filepath.Join(dir, "frame_*.png"))
+	if err != nil {
+		return 0, err
+	}
+	for _, path := range stale {
+		if err := os.Remove(path); err != nil {
+			return 0, err
+		}
+	}
+
+	for i, at := range times {
+		img := opts.frame(c, at, color.NRGBA{})
+		if err := savePNG(filepath.Join(dir, fmt.Sprintf("frame_%05d.png", i+1)), img); err != nil {
+			return i, err
+		}
+	}
+	return len(times), nil
+}
+
+func savePNG(path string, img image.Image) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func gifPalette(img *image.NRGBA) color.Palette {
+	seen := make(map[color.NRGBA]bool)
+	var pal color.Palette
+	for i := 0; i < len(img.Pix); i += 4 {
+		c := color.NRGBA{R: img.Pix[i], G: img.Pix[i+1], B: img.Pix[i+2], A: 255}
+		if seen[c] {
+			continue
+		}
+		if len(pal) == 256 {
+			return palette.Plan9
+		}
+		seen[c] = true
+		pal = append(pal, c)
+	}
+	return pal
+}
@@ -0,0 +1,41 @@
+package format
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"screenpengo/internal/canvas"
+)
+
+func TestSavePNGSequenceRemovesStaleFrames(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"frame_00001.png", "frame_00099.png", "notes.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("old"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	opts := AnimationOptions{ScreenWidth: 20, ScreenHeight: 10, Scale: 1, FrameRate: 10, SpeedUp: 1}
+	count, err := SavePNGSequence(dir, &canvas.Canvas{}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	sort.Strings(names)
+	if count != 1 || strings.Join(names, " ") != "frame_00001.png notes.txt" {
+		t.Errorf("wrote %d frames, folder holds %v", count, names)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "frame_00001.png")); string(data) == "old" {
+		t.Error("frame_00001.png was not rewritten")
+	}
+}
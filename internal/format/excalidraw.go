@@ -0,0 +1,476 @@
+package format
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image/color"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"time"
+
+	"gioui.org/f32"
+
+	"screenpengo/internal/canvas"
+	"screenpengo/internal/tool"
+)
+
+// Excalidraw draws freehand lines with perfect-freehand, which makes them
+// roughly six times as thick as their strokeWidth. A pressure of 0.5 is the
+// nominal width; 0 and 1 give about half and one and a half times that.
+const (
+	excalidrawFreedrawScale   = 6
+	excalidrawNominalPressure = 0.5
+)
+
+var excalidrawHeads = map[tool.ArrowHead]string{
+	tool.HeadOpen:    "arrow",
+	tool.HeadFilled:  "triangle",
+	tool.HeadCircle:  "dot",
+	tool.HeadBar:     "bar",
+	tool.HeadDiamond: "diamond",
+}
+
+// excalidrawHeadNames also accepts the outline variants of newer versions.
+var excalidrawHeadNames = map[string]tool.ArrowHead{
+	"arrow":            tool.HeadOpen,
+	"triangle":         tool.HeadFilled,
+	"triangle_outline": tool.HeadFilled,
+	"dot":              tool.HeadCircle,
+	"circle":           tool.HeadCircle,
+	"circle_outline":   tool.HeadCircle,
+	"bar":              tool.HeadBar,
+	"diamond":          tool.HeadDiamond,
+	"diamond_outline":  tool.HeadDiamond,
+}
+
+// Excalidraw font families: 1 is the hand-drawn Virgil, 3 the monospace
+// Cascadia and 5 Virgil's successor Excalifont.
+var excalidrawFonts = map[int]string{1: "Virgil", 3: "monospace", 5: "Excalifont"}
+
+type excalidrawFile struct {
+	Type     string              `json:"type"`
+	Elements []excalidrawElement `json:"elements"`
+}
+
+// excalidrawElement holds the fields the importer reads. Export writes
+// maps instead, since Excalidraw wants explicit nulls for some fields
+// depending on the element type.
+type excalidrawElement struct {
+	Type             string       `json:"type"`
+	X                float32      `json:"x"`
+	Y                float32      `json:"y"`
+	Width            float32      `json:"width"`
+	Height           float32      `json:"height"`
+	Angle            float64      `json:"angle"`
+	StrokeColor      string       `json:"strokeColor"`
+	StrokeWidth      float32      `json:"strokeWidth"`
+	StrokeStyle      string       `json:"strokeStyle"`
+	Opacity          *float32     `json:"opacity"`
+	GroupIDs         []string     `json:"groupIds"`
+	IsDeleted        bool         `json:"isDeleted"`
+	Points           [][2]float32 `json:"points"`
+	Pressures        []float32    `json:"pressures"`
+	SimulatePressure bool         `json:"simulatePressure"`
+	StartArrowhead   *string      `json:"startArrowhead"`
+	EndArrowhead     *string      `json:"endArrowhead"`
+	Text             string       `json:"text"`
+	FontSize         float32      `json:"fontSize"`
+	FontFamily       int          `json:"fontFamily"`
+}
+
+// isExcalidrawType reports whether typ, the top-level "type" of a JSON
+// file, is that of an Excalidraw scene or clipboard.
+func isExcalidrawType(typ string) bool {
+	return typ == "excalidraw" || typ == "excalidraw/clipboard"
+}
+
+// ReadExcalidraw imports the freedraw, rectangle, ellipse, line, arrow and
+// text elements of an Excalidraw scene or clipboard, with their colour,
+// opacity, width, dash style and groups. Excalidraw pixels become dp.
+// Rectangles, circles and two-point lines keep their type when not rotated;
+// rotated shapes, ellipses and lines with more points become strokes.
+// Curves are imported as straight segments and other elements are skipped.
+func ReadExcalidraw(r io.Reader) (*canvas.Canvas, error) {
+	var file excalidrawFile
+	if err := json.NewDecoder(r).Decode(&file); err != nil {
+		return nil, fmt.Errorf("excalidraw: %w", err)
+	}
+	if !isExcalidrawType(file.Type) {
+		return nil, fmt.Errorf("excalidraw: not an Excalidraw scene (type %q)", file.Type)
+	}
+
+	c := &canvas.Canvas{}
+	groups := make(map[string]int)
+	for _, e := range file.Elements {
+		if e.IsDeleted {
+			continue
+		}
+		group := 0
+		if n := len(e.GroupIDs); n > 0 {
+			// The last id is the outermost group, which moves as a whole.
+			id := e.GroupIDs[n-1]
+			if groups[id] == 0 {
+				groups[id] = len(groups) + 1
+			}
+			group = groups[id]
+		}
+		e.readInto(c, group)
+	}
+	if len(c.Strokes) == 0 && len(c.Shapes) == 0 && len(c.Texts) == 0 {
+		return nil, errors.New("excalidraw: scene has no supported elements")
+	}
+	c.Screen = canvas.Screen{PxPerDp: 1}
+	return c, nil
+}
+
+func (e *excalidrawElement) readInto(c *canvas.Canvas, group int) {
+	col, ok := parseSVGColor(e.StrokeColor)
+	if !ok {
+		if e.StrokeColor == "transparent" {
+			return
+		}
+		col = color.NRGBA{A: 255}
+	}
+	if e.Opacity != nil {
+		col.A = uint8(math.Round(float64(clamp01(*e.Opacity/100)) * 255))
+	}
+	width := max(e.StrokeWidth, 0.5)
+	var dash []float32
+	switch e.StrokeStyle {
+	case "dashed":
+		dash = tool.Dashed.Pattern()
+	case "dotted":
+		dash = tool.Dotted.Pattern()
+	}
+
+	addShape := func(shape canvas.Shape) {
+		shape.Color, shape.WidthPx, shape.Group = col, width, group
+		shape.Dash = scaledPattern(dash, width)
+		c.Shapes = append(c.Shapes, shape)
+	}
+	addStroke := func(points []f32.Point, w float32, widths []float32) {
+		s := canvas.Stroke{Points: points, Color: col, Width: w, Widths: widths, Group: group}
+		s.Dash = scaledPattern(dash, w)
+		s.Densify()
+		c.Strokes = append(c.Strokes, s)
+	}
+
+	origin := f32.Pt(e.X, e.Y)
+	switch e.Type {
+	case "rectangle":
+		corners := []f32.Point{origin, origin.Add(f32.Pt(e.Width, 0)), origin.Add(f32.Pt(e.Width, e.Height)), origin.Add(f32.Pt(0, e.Height))}
+		if e.Angle == 0 {
+			addShape(canvas.Shape{Type: tool.Rectangle, StartPos: corners[0], EndPos: corners[2]})
+			return
+		}
+		addStroke(e.rotated(append(corners, corners[0])), width, nil)
+	case "ellipse":
+		center := origin.Add(f32.Pt(e.Width/2, e.Height/2))
+		if math.Abs(float64(e.Width-e.Height)) < 0.5 {
+			addShape(canvas.Shape{Type: tool.Circle, StartPos: center, EndPos: center.Add(f32.Pt(e.Width/2, 0))})
+			return
+		}
+		var points []f32.Point
+		for i := 0; i <= 64; i++ {
+			angle := float64(i) * 2 * math.Pi / 64
+			points = append(points, center.Add(f32.Pt(
+				e.Width/2*float32(math.Cos(angle)),
+				e.Height/2*float32(math.Sin(angle)))))
+		}
+		addStroke(e.rotated(points), width, nil)
+	case "line", "arrow":
+		points := e.rotated(e.absolutePoints())
+		if len(points) < 2 {
+			return
+		}
+		shapeType := tool.Line
+		var style tool.ArrowStyle
+		if e.Type == "arrow" {
+			shapeType = tool.Arrow
+			style = tool.DefaultArrowStyle
+			style.Start, style.End = excalidrawHead(e.StartArrowhead), excalidrawHead(e.EndArrowhead)
+		}
+		if len(points) == 2 {
+			addShape(canvas.Shape{Type: shapeType, StartPos: points[0], EndPos: points[1], Arrow: style})
+			return
+		}
+		// A bent arrow becomes a stroke with a short arrow over the end
+		// segments that carry heads.
+		addStroke(points, width, nil)
+		n := len(points)
+		if style.End != tool.HeadNone {
+			addShape(canvas.Shape{Type: tool.Arrow, StartPos: points[n-2], EndPos: points[n-1], Arrow: tool.ArrowStyle{End: style.End, Size: style.Size, Angle: style.Angle}})
+		}
+		if style.Start != tool.HeadNone {
+			addShape(canvas.Shape{Type: tool.Arrow, StartPos: points[1], EndPos: points[0], Arrow: tool.ArrowStyle{End: style.Start, Size: style.Size, Angle: style.Angle}})
+		}
+	case "freedraw":
+		points := e.rotated(e.absolutePoints())
+		if len(points) == 0 {
+			return
+		}
+		w := width * excalidrawFreedrawScale
+		var widths []float32
+		if !e.SimulatePressure && len(e.Pressures) == len(points) {
+			widths = make([]float32, len(points))
+			for i, p := range e.Pressures {
+				widths[i] = w * (0.5 + clamp01(p))
+			}
+		}
+		dash = nil
+		addStroke(points, w, widths)
+	case "text":
+		if e.Text == "" {
+			return
+		}
+		size := e.FontSize
+		if size <= 0 {
+			size = 20
+		}
+		c.Texts = append(c.Texts, canvas.Text{
+			Pos:   origin,
+			Text:  e.Text,
+			Size:  size,
+			Color: col,
+			Font:  excalidrawFonts[e.FontFamily],
+			Group: group,
+		})
+	}
+}
+
+func (e *excalidrawElement) absolutePoints() []f32.Point {
+	points := make([]f32.Point, len(e.Points))
+	for i, p := range e.Points {
+		points[i] = f32.Pt(e.X+p[0], e.Y+p[1])
+	}
+	return points
+}
+
+// rotated turns points by the element's angle around the centre of its box,
+// which for lines and freehand is the box around their points.
+func (e *excalidrawElement) rotated(points []f32.Point) []f32.Point {
+	if e.Angle == 0 || len(points) == 0 {
+		return points
+	}
+	center := f32.Pt(e.X+e.Width/2, e.Y+e.Height/2)
+	if len(e.Points) > 0 {
+		topLeft, bottomRight := points[0], points[0]
+		for _, p := range points {
+			topLeft = f32.Pt(min(topLeft.X, p.X), min(topLeft.Y, p.Y))
+			bottomRight = f32.Pt(max(bottomRight.X, p.X), max(bottomRight.Y, p.Y))
+		}
+		center = topLeft.Add(bottomRight).Mul(0.5)
+	}
+	rotation := f32.Affine2D{}.Rotate(center, float32(e.Angle))
+	out := make([]f32.Point, len(points))
+	for i, p := range points {
+		out[i] = rotation.Transform(p)
+	}
+	return out
+}
+
+func excalidrawHead(name *string) tool.ArrowHead {
+	if name == nil {
+		return tool.HeadNone
+	}
+	return excalidrawHeadNames[*name]
+}
+
+func scaledPattern(pattern []float32, width float32) []float32 {
+	if pattern == nil {
+		return nil
+	}
+	out := make([]float32, len(pattern))
+	for i, v := range pattern {
+		out[i] = v * width
+	}
+	return out
+}
+
+// WriteExcalidraw writes c as an Excalidraw scene: strokes as freedraw
+// elements, circles as ellipses, rectangles, lines and arrows as their
+// Excalidraw counterparts and texts as text elements, in dp. Groups are
+// kept. Elements are drawn without Excalidraw's hand-drawn roughness so
+// they look as they did on screen.
+func WriteExcalidraw(w io.Writer, c *canvas.Canvas) error {
+	scale := c.Screen.PxPerDp
+	if scale <= 0 {
+		scale = 1
+	}
+	ew := &excalidrawWriter{scale: scale, updated: time.Now().UnixMilli()}
+
+	for i := range c.Strokes {
+		ew.stroke(&c.Strokes[i])
+	}
+	for i := range c.Shapes {
+		ew.shape(&c.Shapes[i])
+	}
+	for i := range c.Texts {
+		ew.text(&c.Texts[i])
+	}
+
+	data, err := json.MarshalIndent(map[string]any{
+		"type":     "excalidraw",
+		"version":  2,
+		"source":   "screenpen",
+		"elements": ew.elements,
+		"appState": map[string]any{"viewBackgroundColor": "#ffffff", "gridSize": nil},
+		"files":    map[string]any{},
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+func SaveExcalidraw(path string, c *canvas.Canvas) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := WriteExcalidraw(f, c); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+type excalidrawWriter struct {
+	scale    float32
+	updated  int64
+	elements []map[string]any
+}
+
+// element starts an element with the fields every type has.
+func (ew *excalidrawWriter) element(kind string, topLeft, size f32.Point, col color.NRGBA, width float32, dash []float32, group int) map[string]any {
+	n := len(ew.elements) + 1
+	style := "solid"
+	if len(dash) > 0 {
+		style = "dashed"
+		if dash[0] <= width/2 {
+			style = "dotted"
+		}
+	}
+	groupIDs := []string{}
+	if group != 0 {
+		groupIDs = append(groupIDs, "group-"+strconv.Itoa(group))
+	}
+	e := map[string]any{
+		"id":              "screenpen-" + strconv.Itoa(n),
+		"type":            kind,
+		"x":               topLeft.X / ew.scale,
+		"y":               topLeft.Y / ew.scale,
+		"width":           size.X / ew.scale,
+		"height":          size.Y / ew.scale,
+		"angle":           0,
+		"strokeColor":     fmt.Sprintf("#%02x%02x%02x", col.R, col.G, col.B),
+		"backgroundColor": "transparent",
+		"fillStyle":       "solid",
+		"strokeWidth":     width / ew.scale,
+		"strokeStyle":     style,
+		"roughness":       0,
+		"opacity":         int(math.Round(float64(col.A) * 100 / 255)),
+		"groupIds":        groupIDs,
+		"frameId":         nil,
+		"roundness":       nil,
+		"seed":            n,
+		"version":         1,
+		"versionNonce":    n,
+		"isDeleted":       false,
+		"boundElements":   nil,
+		"updated":         ew.updated,
+		"link":            nil,
+		"locked":          false,
+	}
+	ew.elements = append(ew.elements, e)
+	return e
+}
+
+// points returns points relative to origin, in dp, and their extent.
+func (ew *excalidrawWriter) points(points []f32.Point, origin f32.Point) ([][2]float32, f32.Point) {
+	out := make([][2]float32, len(points))
+	var lo, hi f32.Point
+	for i, p := range points {
+		d := p.Sub(origin).Div(ew.scale)
+		out[i] = [2]float32{d.X, d.Y}
+		lo = f32.Pt(min(lo.X, d.X), min(lo.Y, d.Y))
+		hi = f32.Pt(max(hi.X, d.X), max(hi.Y, d.Y))
+	}
+	return out, hi.Sub(lo).Mul(ew.scale)
+}
+
+func (ew *excalidrawWriter) stroke(s *canvas.Stroke) {
+	if len(s.Points) == 0 {
+		return
+	}
+	points, size := ew.points(s.Points, s.Points[0])
+	// A stroke without a nominal width has nothing to scale its widths by.
+	pressures := make([]float32, len(s.Points))
+	for i := range pressures {
+		pressures[i] = excalidrawNominalPressure
+		if s.Width > 0 {
+			pressures[i] = clamp01(s.WidthAt(i)/s.Width - 0.5)
+		}
+	}
+	e := ew.element("freedraw", s.Points[0], size, s.Color, s.Width/excalidrawFreedrawScale, s.Dash, s.Group)
+	e["points"] = points
+	e["pressures"] = pressures
+	e["simulatePressure"] = false
+	e["lastCommittedPoint"] = nil
+}
+
+func (ew *excalidrawWriter) shape(s *canvas.Shape) {
+	switch s.Type {
+	case tool.Circle:
+		r := s.Radius()
+		ew.element("ellipse", s.StartPos.Sub(f32.Pt(r, r)), f32.Pt(2*r, 2*r), s.Color, s.OutlineWidth(), s.Dash, s.Group)
+	case tool.Rectangle:
+		topLeft, bottomRight := s.Bounds()
+		ew.element("rectangle", topLeft, bottomRight.Sub(topLeft), s.Color, s.OutlineWidth(), s.Dash, s.Group)
+	case tool.Line, tool.Arrow:
+		points, size := ew.points([]f32.Point{s.StartPos, s.EndPos}, s.StartPos)
+		kind := "line"
+		var start, end any
+		if s.Type == tool.Arrow {
+			kind = "arrow"
+			style := s.Arrow.OrDefault()
+			if name, ok := excalidrawHeads[style.Start]; ok {
+				start = name
+			}
+			if name, ok := excalidrawHeads[style.End]; ok {
+				end = name
+			}
+		}
+		e := ew.element(kind, s.StartPos, size, s.Color, s.OutlineWidth(), s.Dash, s.Group)
+		e["points"] = points
+		e["lastCommittedPoint"] = nil
+		e["startBinding"] = nil
+		e["endBinding"] = nil
+		e["startArrowhead"] = start
+		e["endArrowhead"] = end
+	}
+}
+
+func (ew *excalidrawWriter) text(t *canvas.Text) {
+	family := 2
+	for id, name := range excalidrawFonts {
+		if name == t.Font {
+			family = id
+		}
+	}
+	topLeft, bottomRight := t.Bounds()
+	e := ew.element("text", topLeft, bottomRight.Sub(topLeft), t.Color, 1, nil, t.Group)
+	e["text"] = t.Text
+	e["originalText"] = t.Text
+	e["fontSize"] = t.Size / ew.scale
+	e["fontFamily"] = family
+	e["textAlign"] = "left"
+	e["verticalAlign"] = "top"
+	e["containerId"] = nil
+	e["lineHeight"] = 1.25
+	e["autoResize"] = true
+}
@@ -0,0 +1,70 @@
+package format
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"screenpengo/internal/canvas"
+)
+
+// importers reads foreign drawing formats, keyed by lower-case file
+// extension.
+var importers = map[string]func(io.Reader) (*canvas.Canvas, error){
+	".excalidraw": ReadExcalidraw,
+	".inkml":      ReadInkML,
+	".svg":        ReadSVG,
+	".xopp":       ReadXopp,
+}
+
+// ImportExtensions lists the file extensions Import understands.
+func ImportExtensions() []string {
+	exts := make([]string, 0, len(importers))
+	for ext := range importers {
+		exts = append(exts, ext)
+	}
+	sort.Strings(exts)
+	return exts
+}
+
+// Import reads a drawing in any supported foreign format, chosen by the
+// file extension.
+func Import(path string) (*canvas.Canvas, error) {
+	read, ok := importers[strings.ToLower(filepath.Ext(path))]
+	if !ok {
+		return nil, fmt.Errorf("cannot import %s: supported formats are %s", filepath.Base(path), strings.Join(ImportExtensions(), ", "))
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return read(f)
+}
+
+// ReadClipboard reads a drawing from clipboard text: a screenpen document,
+// an Excalidraw scene or clipboard, or SVG markup. JSON is taken for
+// Excalidraw by its top-level type alone, since a screenpen document may
+// mention Excalidraw in its texts or metadata.
+func ReadClipboard(data []byte) (*canvas.Canvas, error) {
+	text := bytes.TrimSpace(data)
+	switch {
+	case bytes.HasPrefix(text, []byte("<")):
+		return ReadSVG(bytes.NewReader(text))
+	case bytes.HasPrefix(text, []byte("{")):
+		var header struct {
+			Type string `json:"type"`
+		}
+		if json.Unmarshal(text, &header) == nil && isExcalidrawType(header.Type) {
+			return ReadExcalidraw(bytes.NewReader(text))
+		}
+		return canvas.DecodeDocument(text)
+	}
+	return nil, errors.New("the clipboard does not hold a drawing")
+}
@@ -0,0 +1,59 @@
+package format
+
+import (
+	"image/color"
+	"testing"
+
+	"gioui.org/f32"
+
+	"screenpengo/internal/canvas"
+)
+
+func TestReadClipboard(t *testing.T) {
+	doc, err := canvas.EncodeDocument(&canvas.Canvas{
+		Meta: canvas.Metadata{Title: `"excalidraw"`},
+		Strokes: []canvas.Stroke{{
+			Points: []f32.Point{f32.Pt(0, 0), f32.Pt(10, 10)},
+			Color:  color.NRGBA{A: 255},
+			Width:  2,
+		}},
+		Texts: []canvas.Text{{Text: `{"type":"excalidraw"}`, Size: 16, Color: color.NRGBA{A: 255}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	scene := `{"type":"excalidraw/clipboard","elements":[` +
+		`{"type":"line","x":0,"y":0,"strokeColor":"#000000","strokeWidth":1,"points":[[0,0],[10,10]]}]}`
+	svg := `<svg xmlns="http://www.w3.org/2000/svg"><line x1="0" y1="0" x2="10" y2="10" stroke="black"/></svg>`
+
+	tests := []struct {
+		name            string
+		data            string
+		strokes, shapes int
+		texts           int
+		wantErr         bool
+	}{
+		{name: "document mentioning excalidraw", data: string(doc), strokes: 1, texts: 1},
+		{name: "excalidraw clipboard", data: "\n" + scene, shapes: 1},
+		{name: "svg", data: svg, shapes: 1},
+		{name: "plain text", data: "excalidraw", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := ReadClipboard([]byte(tt.data))
+			if tt.wantErr {
+				if err == nil {
+					t.Error("got a drawing, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(c.Strokes) != tt.strokes || len(c.Shapes) != tt.shapes || len(c.Texts) != tt.texts {
+				t.Errorf("got %d strokes, %d shapes and %d texts, want %d, %d and %d",
+					len(c.Strokes), len(c.Shapes), len(c.Texts), tt.strokes, tt.shapes, tt.texts)
+			}
+		})
+	}
+}
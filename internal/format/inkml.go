@@ -0,0 +1,635 @@
+package format
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"image/color"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gioui.org/f32"
+
+	"screenpengo/internal/canvas"
+)
+
+// inkmlDefaultWidth is the brush width in dp when a file gives none.
+const inkmlDefaultWidth = 2
+
+// inkmlDpPerUnit converts InkML length units to dp. On desktops a dp is
+// 1/96 inch, the same as a CSS pixel.
+var inkmlDpPerUnit = map[string]float32{
+	"":         1,
+	"dp":       1,
+	"px":       1,
+	"in":       96,
+	"cm":       96 / 2.54,
+	"mm":       96 / 25.4,
+	"m":        96 / 0.0254,
+	"pt":       96.0 / 72,
+	"pc":       96.0 / 6,
+	"himetric": 96 / 2540.0,
+}
+
+// inkmlNode is a generic element. InkML lets definitions be referenced
+// from anywhere and inherited through contexts, so the reader keeps the
+// whole tree rather than decoding into fixed structs.
+type inkmlNode struct {
+	XMLName xml.Name
+	Attrs   []xml.Attr  `xml:",any,attr"`
+	Nodes   []inkmlNode `xml:",any"`
+	Text    string      `xml:",chardata"`
+}
+
+func (n *inkmlNode) attr(name string) string {
+	for _, a := range n.Attrs {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+func (n *inkmlNode) child(name string) *inkmlNode {
+	for i := range n.Nodes {
+		if n.Nodes[i].XMLName.Local == name {
+			return &n.Nodes[i]
+		}
+	}
+	return nil
+}
+
+// inkmlChannel is one column of trace data.
+type inkmlChannel struct {
+	name         string
+	scale        float32 // to dp for lengths, to milliseconds for T
+	base         int64   // the time T is relative to
+	intermittent bool
+}
+
+type inkmlBrush struct {
+	color color.NRGBA
+	width float32
+}
+
+type inkmlContext struct {
+	channels []inkmlChannel
+	brush    inkmlBrush
+	time     int64
+}
+
+type inkmlReader struct {
+	ids map[string]*inkmlNode
+	c   *canvas.Canvas
+}
+
+// ReadInkML imports the traces of a W3C InkML document as strokes. X, Y and
+// T channels give the points and their timing, and a W channel the width at
+// each point; brushes give colour, transparency and width. Lengths are
+// converted to dp. Pen-up traces and annotations are skipped.
+func ReadInkML(r io.Reader) (*canvas.Canvas, error) {
+	var root inkmlNode
+	if err := xml.NewDecoder(r).Decode(&root); err != nil {
+		return nil, fmt.Errorf("inkml: %w", err)
+	}
+	if root.XMLName.Local != "ink" {
+		return nil, fmt.Errorf("inkml: root element is <%s>, not <ink>", root.XMLName.Local)
+	}
+
+	ir := &inkmlReader{ids: make(map[string]*inkmlNode), c: &canvas.Canvas{}}
+	ir.index(&root)
+	ctx := inkmlContext{
+		channels: []inkmlChannel{{name: "X", scale: 1}, {name: "Y", scale: 1}},
+		brush:    inkmlBrush{color: color.NRGBA{A: 255}, width: inkmlDefaultWidth},
+	}
+	if err := ir.group(&root, ctx); err != nil {
+		return nil, fmt.Errorf("inkml: %w", err)
+	}
+	if len(ir.c.Strokes) == 0 {
+		return nil, errors.New("inkml: document has no traces")
+	}
+	ir.c.Screen = canvas.Screen{PxPerDp: 1}
+	return ir.c, nil
+}
+
+func (ir *inkmlReader) index(n *inkmlNode) {
+	if id := n.attr("id"); id != "" {
+		ir.ids[id] = n
+	}
+	for i := range n.Nodes {
+		ir.index(&n.Nodes[i])
+	}
+}
+
+func (ir *inkmlReader) ref(value string) *inkmlNode {
+	return ir.ids[strings.TrimPrefix(strings.TrimSpace(value), "#")]
+}
+
+// group reads the traces of <ink> or a <traceGroup> in document order. A
+// <context> outside <definitions> changes the context of the traces after
+// it.
+func (ir *inkmlReader) group(n *inkmlNode, ctx inkmlContext) error {
+	ctx = ir.apply(n, ctx, 0)
+	for i := range n.Nodes {
+		child := &n.Nodes[i]
+		switch child.XMLName.Local {
+		case "context":
+			ctx = ir.context(child, ctx, 0)
+		case "traceGroup":
+			if err := ir.group(child, ctx); err != nil {
+				return err
+			}
+		case "trace":
+			if err := ir.trace(child, ctx); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// context applies a <context> element: first what it refers to, then what
+// it defines inline. depth guards against reference cycles.
+func (ir *inkmlReader) context(n *inkmlNode, ctx inkmlContext, depth int) inkmlContext {
+	if depth > 8 {
+		return ctx
+	}
+	ctx = ir.apply(n, ctx, depth)
+	if source := ir.ref(n.attr("inkSourceRef")); source != nil {
+		ctx = ir.inkSource(source, ctx)
+	}
+	if ts := ir.ref(n.attr("timestampRef")); ts != nil {
+		ctx.time = ir.timestamp(ts, 0)
+	}
+	for i := range n.Nodes {
+		child := &n.Nodes[i]
+		switch child.XMLName.Local {
+		case "inkSource":
+			ctx = ir.inkSource(child, ctx)
+		case "traceFormat":
+			ctx.channels = ir.traceFormat(child)
+		case "brush":
+			ctx.brush = ir.brush(child, ctx.brush, 0)
+		case "timestamp":
+			ctx.time = ir.timestamp(child, 0)
+		}
+	}
+	return ctx
+}
+
+// apply follows the context, trace format and brush references that
+// contexts, trace groups and traces can have.
+func (ir *inkmlReader) apply(n *inkmlNode, ctx inkmlContext, depth int) inkmlContext {
+	if c := ir.ref(n.attr("contextRef")); c != nil && c != n {
+		ctx = ir.context(c, ctx, depth+1)
+	}
+	if f := ir.ref(n.attr("traceFormatRef")); f != nil {
+		ctx.channels = ir.traceFormat(f)
+	}
+	if b := ir.ref(n.attr("brushRef")); b != nil {
+		ctx.brush = ir.brush(b, ctx.brush, 0)
+	}
+	return ctx
+}
+
+func (ir *inkmlReader) inkSource(n *inkmlNode, ctx inkmlContext) inkmlContext {
+	if f := n.child("traceFormat"); f != nil {
+		ctx.channels = ir.traceFormat(f)
+	}
+	return ctx
+}
+
+func (ir *inkmlReader) traceFormat(n *inkmlNode) []inkmlChannel {
+	if f := ir.ref(n.attr("href")); f != nil && f != n && len(n.Nodes) == 0 {
+		n = f
+	}
+	var channels []inkmlChannel
+	add := func(ch *inkmlNode, intermittent bool) {
+		c := inkmlChannel{name: ch.attr("name"), scale: 1, intermittent: intermittent}
+		units := ch.attr("units")
+		switch c.name {
+		case "T":
+			if units == "s" {
+				c.scale = 1000
+			}
+			if ts := ir.ref(ch.attr("respectTo")); ts != nil {
+				c.base = ir.timestamp(ts, 0)
+			}
+		default:
+			if k, ok := inkmlDpPerUnit[units]; ok {
+				c.scale = k
+			}
+		}
+		channels = append(channels, c)
+	}
+	for i := range n.Nodes {
+		switch child := &n.Nodes[i]; child.XMLName.Local {
+		case "channel":
+			add(child, false)
+		case "intermittentChannels":
+			for j := range child.Nodes {
+				if child.Nodes[j].XMLName.Local == "channel" {
+					add(&child.Nodes[j], true)
+				}
+			}
+		}
+	}
+	return channels
+}
+
+// brush reads a brush on top of the one it refers to, or else on top of
+// the brush of the current context.
+func (ir *inkmlReader) brush(n *inkmlNode, b inkmlBrush, depth int) inkmlBrush {
+	if depth > 8 {
+		return b
+	}
+	if parent := ir.ref(n.attr("brushRef")); parent != nil {
+		b = ir.brush(parent, b, depth+1)
+	}
+	for i := range n.Nodes {
+		p := &n.Nodes[i]
+		if p.XMLName.Local != "brushProperty" {
+			continue
+		}
+		value := p.attr("value")
+		switch p.attr("name") {
+		case "color":
+			if col, ok := parseSVGColor(value); ok {
+				col.A = b.color.A
+				b.color = col
+			}
+		case "transparency":
+			if v, err := strconv.ParseFloat(value, 32); err == nil {
+				b.color.A = uint8(255 - clamp01(float32(v)/255)*255)
+			}
+		case "width":
+			if v, err := strconv.ParseFloat(value, 32); err == nil && v > 0 {
+				k, ok := inkmlDpPerUnit[p.attr("units")]
+				if !ok {
+					k = 1
+				}
+				b.width = float32(v) * k
+			}
+		}
+	}
+	return b
+}
+
+// timestamp returns a <timestamp> as Unix milliseconds.
+func (ir *inkmlReader) timestamp(n *inkmlNode, depth int) int64 {
+	if v, err := strconv.ParseFloat(n.attr("time"), 64); err == nil {
+		return int64(v)
+	}
+	var t int64
+	if parent := ir.ref(n.attr("timestampRef")); parent != nil && depth < 8 {
+		t = ir.timestamp(parent, depth+1)
+	}
+	if v, err := strconv.ParseFloat(n.attr("timeOffset"), 64); err == nil {
+		t += int64(v)
+	}
+	return t
+}
+
+func (ir *inkmlReader) trace(n *inkmlNode, ctx inkmlContext) error {
+	ctx = ir.apply(n, ctx, 0)
+	if n.attr("type") == "penUp" {
+		return nil
+	}
+	rows, err := parseInkMLTrace(n.Text, ctx.channels)
+	if err != nil {
+		return fmt.Errorf("trace %d: %w", len(ir.c.Strokes)+1, err)
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+
+	s := canvas.Stroke{Color: ctx.brush.color, Width: ctx.brush.width}
+	var times []int64
+	for _, row := range rows {
+		var p f32.Point
+		var t int64
+		var width float32
+		hasT, hasW := false, false
+		for i, ch := range ctx.channels {
+			if i >= len(row) || math.IsNaN(row[i]) {
+				continue
+			}
+			v := row[i] * float64(ch.scale)
+			switch ch.name {
+			case "X":
+				p.X = float32(v)
+			case "Y":
+				p.Y = float32(v)
+			case "T":
+				t, hasT = ch.base+int64(math.Round(v)), true
+			case "W":
+				width, hasW = float32(v), v > 0
+			}
+		}
+		s.Points = append(s.Points, p)
+		if hasT {
+			times = append(times, t)
+		}
+		if hasW {
+			s.Widths = append(s.Widths, width)
+		}
+	}
+
+	if len(s.Widths) != len(s.Points) {
+		s.Widths = nil
+	} else {
+		s.Width = s.Widths[0]
+		for _, w := range s.Widths {
+			s.Width = max(s.Width, w)
+		}
+	}
+	if len(times) == len(s.Points) {
+		s.StartedAt = times[0]
+		s.Times = make([]int64, len(times))
+		for i, t := range times {
+			s.Times[i] = t - times[0]
+		}
+	} else if v, err := strconv.ParseFloat(n.attr("timeOffset"), 64); err == nil {
+		s.StartedAt = ctx.time + int64(v)
+	}
+	s.Densify()
+	ir.c.Strokes = append(ir.c.Strokes, s)
+	return nil
+}
+
+// parseInkMLTrace decodes trace data: points separated by commas, with one
+// value per channel. A value may be prefixed by ! (explicit), ' (first
+// difference) or " (second difference), which applies to the values after
+// it until the next prefix, so "10 20, '1'2" is (10, 20), (11, 22). Boolean
+// channels use T and F, * repeats a value and ? leaves it unknown (NaN).
+func parseInkMLTrace(data string, channels []inkmlChannel) ([][]float64, error) {
+	n := len(channels)
+	prev := make([]float64, n)
+	velocity := make([]float64, n)
+	mode := make([]byte, n)
+	for i := range mode {
+		mode[i] = '!'
+	}
+
+	var rows [][]float64
+	for _, point := range strings.Split(data, ",") {
+		if strings.TrimSpace(point) == "" {
+			continue
+		}
+		s := &pathScanner{s: point}
+		row := make([]float64, 0, n)
+		for {
+			s.skipSpace()
+			if s.done() {
+				break
+			}
+			i := len(row)
+			if i >= n {
+				return nil, fmt.Errorf("point %d has more than %d values", len(rows)+1, n)
+			}
+			if c := s.peek(); c == '!' || c == '\'' || c == '"' {
+				mode[i] = c
+				s.pos++
+				s.skipSpace()
+				if s.done() {
+					return nil, fmt.Errorf("point %d: missing value after %c", len(rows)+1, c)
+				}
+			}
+			var v float64
+			switch c := s.peek(); {
+			case c == 'T' || c == 'F':
+				s.pos++
+				if c == 'T' {
+					v = 1
+				}
+			case c == '*':
+				s.pos++
+				v = prev[i]
+			case c == '?':
+				s.pos++
+				row = append(row, math.NaN())
+				continue
+			default:
+				x, err := s.number()
+				if err != nil {
+					return nil, fmt.Errorf("point %d: %w", len(rows)+1, err)
+				}
+				switch mode[i] {
+				case '\'':
+					v = prev[i] + float64(x)
+				case '"':
+					v = prev[i] + velocity[i] + float64(x)
+				default:
+					v = float64(x)
+				}
+			}
+			if len(rows) > 0 {
+				velocity[i] = v - prev[i]
+			}
+			prev[i] = v
+			row = append(row, v)
+		}
+		if len(row) < n && !channels[len(row)].intermittent {
+			return nil, fmt.Errorf("point %d has %d of %d values", len(rows)+1, len(row), n)
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// The InkML document written by WriteInkML.
+type inkmlDocument struct {
+	XMLName     xml.Name           `xml:"http://www.w3.org/2003/InkML ink"`
+	Definitions inkmlDefinitions   `xml:"definitions"`
+	Traces      []inkmlTraceOutput `xml:"trace"`
+}
+
+type inkmlDefinitions struct {
+	Timestamp    *inkmlTimestamp     `xml:"timestamp,omitempty"`
+	TraceFormats []inkmlFormatOutput `xml:"traceFormat"`
+	Contexts     []inkmlContextRef   `xml:"context"`
+	Brushes      []inkmlBrushOutput  `xml:"brush"`
+}
+
+type inkmlTimestamp struct {
+	ID   string `xml:"http://www.w3.org/XML/1998/namespace id,attr"`
+	Time int64  `xml:"time,attr"`
+}
+
+type inkmlFormatOutput struct {
+	ID       string               `xml:"http://www.w3.org/XML/1998/namespace id,attr"`
+	Channels []inkmlChannelOutput `xml:"channel"`
+}
+
+type inkmlChannelOutput struct {
+	Name      string `xml:"name,attr"`
+	Type      string `xml:"type,attr"`
+	Units     string `xml:"units,attr"`
+	RespectTo string `xml:"respectTo,attr,omitempty"`
+}
+
+type inkmlContextRef struct {
+	ID             string `xml:"http://www.w3.org/XML/1998/namespace id,attr"`
+	TraceFormatRef string `xml:"traceFormatRef,attr"`
+}
+
+type inkmlBrushOutput struct {
+	ID         string               `xml:"http://www.w3.org/XML/1998/namespace id,attr"`
+	Properties []inkmlBrushProperty `xml:"brushProperty"`
+}
+
+type inkmlBrushProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+	Units string `xml:"units,attr,omitempty"`
+}
+
+type inkmlTraceOutput struct {
+	ContextRef string `xml:"contextRef,attr"`
+	BrushRef   string `xml:"brushRef,attr"`
+	Data       string `xml:",chardata"`
+}
+
+// WriteInkML writes the strokes of c as InkML traces with X and Y channels
+// in dp, a T channel in milliseconds when the stroke has timing, and a W
+// channel for strokes with a width per point. Each colour and width gets a
+// brush. Shapes become traces like strokes; dash patterns and texts have no
+// InkML equivalent and are left out.
+func WriteInkML(w io.Writer, c *canvas.Canvas) error {
+	scale := c.Screen.PxPerDp
+	if scale <= 0 {
+		scale = 1
+	}
+
+	strokes := make([]canvas.Stroke, 0, len(c.Strokes))
+	strokes = append(strokes, c.Strokes...)
+	for i := range c.Shapes {
+		s := &c.Shapes[i]
+		for _, line := range shapeLines(s) {
+			strokes = append(strokes, canvas.Stroke{Points: line, Color: s.Color, Width: s.OutlineWidth()})
+		}
+	}
+
+	var doc inkmlDocument
+	var origin int64
+	timed := false
+	for _, s := range strokes {
+		if len(s.Times) == len(s.Points) && len(s.Points) > 0 && (!timed || s.StartedAt < origin) {
+			origin, timed = s.StartedAt, true
+		}
+	}
+	if timed {
+		doc.Definitions.Timestamp = &inkmlTimestamp{ID: "origin", Time: origin}
+	}
+
+	formats := make(map[string]bool)
+	brushes := make(map[inkmlBrushKey]string)
+	for i := range strokes {
+		s := &strokes[i]
+		if len(s.Points) == 0 {
+			continue
+		}
+		hasT := len(s.Times) == len(s.Points)
+		hasW := len(s.Widths) == len(s.Points)
+		format := "xy"
+		if hasT {
+			format += "t"
+		}
+		if hasW {
+			format += "w"
+		}
+		formats[format] = true
+
+		key := inkmlBrushKey{color: s.Color, width: s.Width / scale}
+		brush, ok := brushes[key]
+		if !ok {
+			brush = "brush" + strconv.Itoa(len(brushes))
+			brushes[key] = brush
+			doc.Definitions.Brushes = append(doc.Definitions.Brushes, key.output(brush))
+		}
+
+		var data strings.Builder
+		for j, p := range s.Points {
+			if j > 0 {
+				data.WriteString(", ")
+			}
+			data.WriteString(xoppNum(p.X/scale) + " " + xoppNum(p.Y/scale))
+			if hasT {
+				data.WriteString(" " + strconv.FormatInt(s.StartedAt-origin+s.Times[j], 10))
+			}
+			if hasW {
+				data.WriteString(" " + xoppNum(s.Widths[j]/scale))
+			}
+		}
+		doc.Traces = append(doc.Traces, inkmlTraceOutput{
+			ContextRef: "#ctx-" + format,
+			BrushRef:   "#" + brush,
+			Data:       data.String(),
+		})
+	}
+
+	names := make([]string, 0, len(formats))
+	for format := range formats {
+		names = append(names, format)
+	}
+	sort.Strings(names)
+	for _, format := range names {
+		f := inkmlFormatOutput{ID: format}
+		for _, ch := range format {
+			switch ch {
+			case 'x', 'y':
+				f.Channels = append(f.Channels, inkmlChannelOutput{Name: strings.ToUpper(string(ch)), Type: "decimal", Units: "dp"})
+			case 't':
+				f.Channels = append(f.Channels, inkmlChannelOutput{Name: "T", Type: "integer", Units: "ms", RespectTo: "#origin"})
+			case 'w':
+				f.Channels = append(f.Channels, inkmlChannelOutput{Name: "W", Type: "decimal", Units: "dp"})
+			}
+		}
+		doc.Definitions.TraceFormats = append(doc.Definitions.TraceFormats, f)
+		doc.Definitions.Contexts = append(doc.Definitions.Contexts, inkmlContextRef{ID: "ctx-" + format, TraceFormatRef: "#" + format})
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	enc := xml.NewEncoder(&buf)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	buf.WriteString("\n")
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func SaveInkML(path string, c *canvas.Canvas) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := WriteInkML(f, c); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+type inkmlBrushKey struct {
+	color color.NRGBA
+	width float32
+}
+
+func (k inkmlBrushKey) output(id string) inkmlBrushOutput {
+	b := inkmlBrushOutput{ID: id, Properties: []inkmlBrushProperty{
+		{Name: "color", Value: fmt.Sprintf("#%02X%02X%02X", k.color.R, k.color.G, k.color.B)},
+		{Name: "width", Value: xoppNum(k.width), Units: "dp"},
+	}}
+	if k.color.A < 255 {
+		b.Properties = append(b.Properties, inkmlBrushProperty{Name: "transparency", Value: strconv.Itoa(255 - int(k.color.A))})
+	}
+	return b
+}
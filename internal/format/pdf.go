@@ -0,0 +1,445 @@
+package format
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"image/color"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gioui.org/f32"
+
+	"screenpengo/internal/canvas"
+	"screenpengo/internal/tool"
+)
+
+type PageTemplate int
+
+const (
+	TemplateNone PageTemplate = iota
+	TemplateGrid
+	TemplateLined
+	TemplateDotted
+)
+
+func (t PageTemplate) String() string {
+	switch t {
+	case TemplateGrid:
+		return "Grid"
+	case TemplateLined:
+		return "Lined"
+	case TemplateDotted:
+		return "Dotted"
+	default:
+		return "Plain"
+	}
+}
+
+const (
+	pdfLongSide        = 842 // A4 long side in points
+	pdfTemplateSpacing = 5 * 72 / 25.4
+	pdfBezierKappa     = 0.5522847
+
+	// Texts are set in Helvetica, one of the fonts every PDF reader has, so
+	// nothing needs embedding. pdfTextAscent is its height above the
+	// baseline relative to the font size.
+	pdfFontName   = "F1"
+	pdfTextAscent = 0.718
+)
+
+var pdfTemplateColor = color.NRGBA{R: 200, G: 200, B: 200, A: 255}
+
+type PDFOptions struct {
+	ScreenWidth  int
+	ScreenHeight int
+	Template     PageTemplate
+}
+
+func PageSize(screenWidth, screenHeight int) (width, height float64) {
+	if screenWidth <= 0 || screenHeight <= 0 {
+		return pdfLongSide, pdfLongSide * 210 / 297
+	}
+	if screenWidth >= screenHeight {
+		return pdfLongSide, pdfLongSide * float64(screenHeight) / float64(screenWidth)
+	}
+	return pdfLongSide * float64(screenWidth) / float64(screenHeight), pdfLongSide
+}
+
+func WritePDF(w io.Writer, pages []*canvas.Canvas, opts PDFOptions) error {
+	if len(pages) == 0 {
+		return errors.New("pdf: no pages to write")
+	}
+
+	pageWidth, pageHeight := PageSize(opts.ScreenWidth, opts.ScreenHeight)
+	scale := 1.0
+	if opts.ScreenWidth > 0 {
+		scale = pageWidth / float64(opts.ScreenWidth)
+	}
+
+	alphas := pdfCollectAlphas(pages)
+
+	pw := &pdfWriter{w: bufio.NewWriter(w)}
+	pw.printf("%%PDF-1.4\n%%\xe2\xe3\xcf\xd3\n")
+
+	const (
+		catalogID   = 1
+		pagesID     = 2
+		resourcesID = 3
+		firstPageID = 4
+	)
+
+	pw.beginObject(catalogID)
+	pw.printf("<< /Type /Catalog /Pages %d 0 R >>\n", pagesID)
+	pw.endObject()
+
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", firstPageID+2*i)
+	}
+	pw.beginObject(pagesID)
+	pw.printf("<< /Type /Pages /Kids [%s] /Count %d >>\n", strings.Join(kids, " "), len(pages))
+	pw.endObject()
+
+	pw.beginObject(resourcesID)
+	pw.printf("<< /ExtGState <<")
+	for _, a := range alphas {
+		pw.printf(" /%s << /CA %s /ca %s >>", pdfAlphaName(a), pdfNum(float64(a)/255), pdfNum(float64(a)/255))
+	}
+	pw.printf(" >> /Font << /%s << /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >> >> >>\n", pdfFontName)
+	pw.endObject()
+
+	for i, page := range pages {
+		pageID := firstPageID + 2*i
+		contentID := pageID + 1
+
+		pw.beginObject(pageID)
+		pw.printf("<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %s %s] /Resources %d 0 R /Contents %d 0 R >>\n",
+			pagesID, pdfNum(pageWidth), pdfNum(pageHeight), resourcesID, contentID)
+		pw.endObject()
+
+		content, err := pdfPageContent(page, pageWidth, pageHeight, scale, opts.Template)
+		if err != nil {
+			return err
+		}
+		pw.beginObject(contentID)
+		pw.printf("<< /Length %d /Filter /FlateDecode >>\nstream\n", len(content))
+		pw.write(content)
+		pw.printf("\nendstream\n")
+		pw.endObject()
+	}
+
+	xrefOffset := pw.offset
+	pw.printf("xref\n0 %d\n", len(pw.offsets)+1)
+	pw.printf("0000000000 65535 f \n")
+	for _, off := range pw.offsets {
+		pw.printf("%010d 00000 n \n", off)
+	}
+	pw.printf("trailer\n<< /Size %d /Root %d 0 R >>\nstartxref\n%d\n%%%%EOF\n",
+		len(pw.offsets)+1, catalogID, xrefOffset)
+
+	if pw.err != nil {
+		return pw.err
+	}
+	return pw.w.Flush()
+}
+
+func SavePDF(path string, pages []*canvas.Canvas, opts PDFOptions) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := WritePDF(f, pages, opts); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+type pdfWriter struct {
+	w       *bufio.Writer
+	offset  int
+	offsets []int
+	err     error
+}
+
+func (pw *pdfWriter) write(b []byte) {
+	if pw.err != nil {
+		return
+	}
+	n, err := pw.w.Write(b)
+	pw.offset += n
+	pw.err = err
+}
+
+func (pw *pdfWriter) printf(format string, args ...any) {
+	pw.write([]byte(fmt.Sprintf(format, args...)))
+}
+
+func (pw *pdfWriter) beginObject(id int) {
+	for len(pw.offsets) < id {
+		pw.offsets = append(pw.offsets, 0)
+	}
+	pw.offsets[id-1] = pw.offset
+	pw.printf("%d 0 obj\n", id)
+}
+
+func (pw *pdfWriter) endObject() {
+	pw.printf("endobj\n")
+}
+
+func pdfPageContent(c *canvas.Canvas, pageWidth, pageHeight, scale float64, template PageTemplate) ([]byte, error) {
+	var content bytes.Buffer
+
+	content.WriteString("1 1 1 rg\n")
+	fmt.Fprintf(&content, "0 0 %s %s re f\n", pdfNum(pageWidth), pdfNum(pageHeight))
+	pdfWriteTemplate(&content, pageWidth, pageHeight, template)
+
+	fmt.Fprintf(&content, "%s 0 0 %s 0 %s cm\n", pdfNum(scale), pdfNum(-scale), pdfNum(pageHeight))
+	content.WriteString("1 J 1 j\n")
+
+	for i := range c.Strokes {
+		pdfWriteStroke(&content, &c.Strokes[i])
+	}
+	for i := range c.Shapes {
+		pdfWriteShape(&content, &c.Shapes[i])
+	}
+	for i := range c.Texts {
+		pdfWriteText(&content, &c.Texts[i])
+	}
+
+	var compressed bytes.Buffer
+	zw := zlib.NewWriter(&compressed)
+	if _, err := zw.Write(content.Bytes()); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return compressed.Bytes(), nil
+}
+
+func pdfWriteTemplate(w io.Writer, pageWidth, pageHeight float64, template PageTemplate) {
+	if template == TemplateNone {
+		return
+	}
+
+	fmt.Fprintf(w, "q %s\n", pdfStrokeColor(pdfTemplateColor))
+	switch template {
+	case TemplateGrid:
+		fmt.Fprintf(w, "0.5 w\n")
+		for x := pdfTemplateSpacing; x < pageWidth; x += pdfTemplateSpacing {
+			fmt.Fprintf(w, "%s 0 m %s %s l\n", pdfNum(x), pdfNum(x), pdfNum(pageHeight))
+		}
+		for y := pdfTemplateSpacing; y < pageHeight; y += pdfTemplateSpacing {
+			fmt.Fprintf(w, "0 %s m %s %s l\n", pdfNum(y), pdfNum(pageWidth), pdfNum(y))
+		}
+		fmt.Fprintf(w, "S\n")
+	case TemplateLined:
+		fmt.Fprintf(w, "0.5 w\n")
+		for y := 2 * pdfTemplateSpacing; y < pageHeight; y += 2 * pdfTemplateSpacing {
+			fmt.Fprintf(w, "0 %s m %s %s l\n", pdfNum(y), pdfNum(pageWidth), pdfNum(y))
+		}
+		fmt.Fprintf(w, "S\n")
+	case TemplateDotted:
+		fmt.Fprintf(w, "1.5 w 1 J\n")
+		for x := pdfTemplateSpacing; x < pageWidth; x += pdfTemplateSpacing {
+			for y := pdfTemplateSpacing; y < pageHeight; y += pdfTemplateSpacing {
+				fmt.Fprintf(w, "%s %s m %s %s l\n", pdfNum(x), pdfNum(y), pdfNum(x), pdfNum(y))
+			}
+		}
+		fmt.Fprintf(w, "S\n")
+	}
+	fmt.Fprintf(w, "Q\n")
+}
+
+func pdfWriteStroke(w io.Writer, s *canvas.Stroke) {
+	if len(s.Points) == 0 {
+		return
+	}
+
+	pdfBeginElement(w, s.Color, s.Width, s.Dash)
+	fmt.Fprintf(w, "%s m\n", pdfPoint(s.Points[0]))
+	if len(s.Points) == 1 {
+		fmt.Fprintf(w, "%s l\n", pdfPoint(s.Points[0]))
+	}
+	for _, p := range s.Points[1:] {
+		fmt.Fprintf(w, "%s l\n", pdfPoint(p))
+	}
+	fmt.Fprintf(w, "S Q\n")
+}
+
+func pdfWriteShape(w io.Writer, s *canvas.Shape) {
+	switch s.Type {
+	case tool.Circle:
+		radius := float64(s.Radius())
+		if radius < 1 {
+			return
+		}
+		pdfBeginElement(w, s.Color, s.OutlineWidth(), s.Dash)
+		pdfWriteCircle(w, float64(s.StartPos.X), float64(s.StartPos.Y), radius)
+		fmt.Fprintf(w, "S Q\n")
+	case tool.Rectangle:
+		topLeft, bottomRight := s.Bounds()
+		pdfBeginElement(w, s.Color, s.OutlineWidth(), s.Dash)
+		fmt.Fprintf(w, "%s %s %s %s re S Q\n",
+			pdfNum(float64(topLeft.X)), pdfNum(float64(topLeft.Y)),
+			pdfNum(float64(bottomRight.X-topLeft.X)), pdfNum(float64(bottomRight.Y-topLeft.Y)))
+	case tool.Line:
+		pdfBeginElement(w, s.Color, s.OutlineWidth(), s.Dash)
+		fmt.Fprintf(w, "%s m %s l S Q\n", pdfPoint(s.StartPos), pdfPoint(s.EndPos))
+	case tool.Arrow:
+		pdfBeginElement(w, s.Color, s.OutlineWidth(), s.Dash)
+		fmt.Fprintf(w, "%s m %s l S\n", pdfPoint(s.StartPos), pdfPoint(s.EndPos))
+		fmt.Fprintf(w, "[] 0 d %s\n", pdfFillColor(s.Color))
+		for _, head := range s.ArrowHeads() {
+			pdfWriteArrowHead(w, head)
+		}
+		fmt.Fprintf(w, "Q\n")
+	}
+}
+
+// pdfWriteText sets t line by line from its top-left corner. The page is
+// drawn upside down, so the text matrix flips the glyphs back. Fonts named in
+// the drawing are not available and all texts use Helvetica.
+func pdfWriteText(w io.Writer, t *canvas.Text) {
+	if t.Text == "" {
+		return
+	}
+	size := float64(t.Size)
+	fmt.Fprintf(w, "q %s\n", pdfFillColor(t.Color))
+	if t.Color.A != 255 {
+		fmt.Fprintf(w, "/%s gs\n", pdfAlphaName(t.Color.A))
+	}
+	fmt.Fprintf(w, "BT /%s %s Tf %s TL\n", pdfFontName, pdfNum(size), pdfNum(size*1.2))
+	fmt.Fprintf(w, "1 0 0 -1 %s %s Tm\n", pdfNum(float64(t.Pos.X)), pdfNum(float64(t.Pos.Y)+size*pdfTextAscent))
+	for i, line := range strings.Split(t.Text, "\n") {
+		if i > 0 {
+			fmt.Fprintf(w, "T*\n")
+		}
+		fmt.Fprintf(w, "%s Tj\n", pdfString(line))
+	}
+	fmt.Fprintf(w, "ET Q\n")
+}
+
+// pdfString quotes s as a PDF string in WinAnsiEncoding. Its Latin-1 part
+// matches Unicode; anything else is replaced with a question mark.
+func pdfString(s string) string {
+	var b strings.Builder
+	b.WriteByte('(')
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 0x20 || r >= 0x7f && r < 0xa0 || r > 0xff:
+			b.WriteByte('?')
+		default:
+			b.WriteByte(byte(r))
+		}
+	}
+	b.WriteByte(')')
+	return b.String()
+}
+
+func pdfWriteArrowHead(w io.Writer, head canvas.ArrowHeadGeometry) {
+	switch head.Style {
+	case tool.HeadCircle:
+		pdfWriteCircle(w, float64(head.Center.X), float64(head.Center.Y), float64(head.Radius))
+		fmt.Fprintf(w, "f\n")
+		return
+	case tool.HeadNone:
+		return
+	}
+
+	fmt.Fprintf(w, "%s m\n", pdfPoint(head.Points[0]))
+	for _, p := range head.Points[1:] {
+		fmt.Fprintf(w, "%s l\n", pdfPoint(p))
+	}
+	if head.Style.Filled() {
+		fmt.Fprintf(w, "h B\n")
+	} else {
+		fmt.Fprintf(w, "S\n")
+	}
+}
+
+func pdfWriteCircle(w io.Writer, cx, cy, r float64) {
+	k := r * pdfBezierKappa
+	fmt.Fprintf(w, "%s %s m\n", pdfNum(cx+r), pdfNum(cy))
+	fmt.Fprintf(w, "%s %s %s %s %s %s c\n", pdfNum(cx+r), pdfNum(cy+k), pdfNum(cx+k), pdfNum(cy+r), pdfNum(cx), pdfNum(cy+r))
+	fmt.Fprintf(w, "%s %s %s %s %s %s c\n", pdfNum(cx-k), pdfNum(cy+r), pdfNum(cx-r), pdfNum(cy+k), pdfNum(cx-r), pdfNum(cy))
+	fmt.Fprintf(w, "%s %s %s %s %s %s c\n", pdfNum(cx-r), pdfNum(cy-k), pdfNum(cx-k), pdfNum(cy-r), pdfNum(cx), pdfNum(cy-r))
+	fmt.Fprintf(w, "%s %s %s %s %s %s c\n", pdfNum(cx+k), pdfNum(cy-r), pdfNum(cx+r), pdfNum(cy-k), pdfNum(cx+r), pdfNum(cy))
+}
+
+func pdfBeginElement(w io.Writer, col color.NRGBA, width float32, dash []float32) {
+	fmt.Fprintf(w, "q %s %s w\n", pdfStrokeColor(col), pdfNum(float64(width)))
+	if len(dash) > 0 {
+		values := make([]string, len(dash))
+		for i, v := range dash {
+			values[i] = pdfNum(float64(v))
+		}
+		fmt.Fprintf(w, "[%s] 0 d\n", strings.Join(values, " "))
+	}
+	if col.A != 255 {
+		fmt.Fprintf(w, "/%s gs\n", pdfAlphaName(col.A))
+	}
+}
+
+func pdfCollectAlphas(pages []*canvas.Canvas) []uint8 {
+	seen := make(map[uint8]bool)
+	for _, page := range pages {
+		for _, s := range page.Strokes {
+			seen[s.Color.A] = true
+		}
+		for _, s := range page.Shapes {
+			seen[s.Color.A] = true
+		}
+		for _, t := range page.Texts {
+			seen[t.Color.A] = true
+		}
+	}
+	delete(seen, 255)
+
+	alphas := make([]uint8, 0, len(seen))
+	for a := range seen {
+		alphas = append(alphas, a)
+	}
+	sort.Slice(alphas, func(i, j int) bool { return alphas[i] < alphas[j] })
+	return alphas
+}
+
+func pdfAlphaName(a uint8) string {
+	return "GSa" + strconv.Itoa(int(a))
+}
+
+func pdfStrokeColor(col color.NRGBA) string {
+	return fmt.Sprintf("%s %s %s RG", pdfChannel(col.R), pdfChannel(col.G), pdfChannel(col.B))
+}
+
+func pdfFillColor(col color.NRGBA) string {
+	return fmt.Sprintf("%s %s %s rg", pdfChannel(col.R), pdfChannel(col.G), pdfChannel(col.B))
+}
+
+func pdfChannel(v uint8) string {
+	return pdfNum(float64(v) / 255)
+}
+
+func pdfPoint(p f32.Point) string {
+	return pdfNum(float64(p.X)) + " " + pdfNum(float64(p.Y))
+}
+
+func pdfNum(v float64) string {
+	s := strconv.FormatFloat(v, 'f', 3, 64)
+	s = strings.TrimRight(s, "0")
+	s = strings.TrimSuffix(s, ".")
+	if s == "-0" {
+		return "0"
+	}
+	return s
+}
@@ -0,0 +1,461 @@
+package format
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"image/color"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+
+	"gioui.org/f32"
+
+	"screenpengo/internal/canvas"
+)
+
+type PaperSize int
+
+const (
+	PaperA4 PaperSize = iota
+	PaperA3
+	PaperLetter
+)
+
+func (p PaperSize) String() string {
+	switch p {
+	case PaperA3:
+		return "A3"
+	case PaperLetter:
+		return "Letter"
+	default:
+		return "A4"
+	}
+}
+
+// Size returns the portrait size of the paper in millimetres.
+func (p PaperSize) Size() (width, height float32) {
+	switch p {
+	case PaperA3:
+		return 297, 420
+	case PaperLetter:
+		return 215.9, 279.4
+	default:
+		return 210, 297
+	}
+}
+
+const (
+	plotDefaultMargin   = 10   // mm
+	plotDefaultFeedRate = 3000 // mm/min
+	plotMinStep         = 0.1  // mm; closer points are merged
+	plotMinEraseStep    = 0.25 // px; erased lines are never checked more finely
+	hpglUnitsPerMM      = 40
+	hpglPointsPerPD     = 64 // keeps commands short for small plotter buffers
+)
+
+// DefaultPens is the pen carousel assumed when none is given: black, red,
+// green and blue in slots 1 to 4.
+var DefaultPens = []color.NRGBA{
+	{A: 255},
+	{R: 220, G: 30, B: 30, A: 255},
+	{R: 30, G: 160, B: 60, A: 255},
+	{R: 30, G: 60, B: 220, A: 255},
+}
+
+// PlotterOptions controls plotter export. Zero values pick the defaults:
+// A4, a 10 mm margin, DefaultPens, 3000 mm/min and Z moves for the pen.
+type PlotterOptions struct {
+	Paper PaperSize
+	// Margin is kept free on every side of the paper, in millimetres.
+	Margin float32
+	// Pens lists the pen colours by slot, starting at slot 1. Every element
+	// is drawn with the pen closest to its colour.
+	Pens []color.NRGBA
+	// FeedRate, PenUp and PenDown are only used for G-code.
+	FeedRate float32
+	PenUp    string
+	PenDown  string
+}
+
+func (o PlotterOptions) withDefaults() PlotterOptions {
+	if o.Margin <= 0 {
+		o.Margin = plotDefaultMargin
+	}
+	if len(o.Pens) == 0 {
+		o.Pens = DefaultPens
+	}
+	if o.FeedRate <= 0 {
+		o.FeedRate = plotDefaultFeedRate
+	}
+	if o.PenUp == "" {
+		o.PenUp = "G0 Z5"
+	}
+	if o.PenDown == "" {
+		o.PenDown = "G1 Z0 F1000"
+	}
+	return o
+}
+
+// eraserArea is an eraser stroke with its bounds, widened by its largest
+// half width.
+type eraserArea struct {
+	index                int
+	stroke               *canvas.Stroke
+	topLeft, bottomRight f32.Point
+	// step is how far apart lines are checked against the eraser.
+	step float32
+}
+
+func eraserAreas(strokes []canvas.Stroke) []eraserArea {
+	var areas []eraserArea
+	for i := range strokes {
+		s := &strokes[i]
+		if !s.Eraser || len(s.Points) == 0 {
+			continue
+		}
+		area := eraserArea{index: i, stroke: s, topLeft: s.Points[0], bottomRight: s.Points[0], step: s.WidthAt(0)}
+		var radius float32
+		for j, p := range s.Points {
+			area.topLeft = f32.Pt(min(area.topLeft.X, p.X), min(area.topLeft.Y, p.Y))
+			area.bottomRight = f32.Pt(max(area.bottomRight.X, p.X), max(area.bottomRight.Y, p.Y))
+			radius = max(radius, s.WidthAt(j)/2)
+			area.step = min(area.step, s.WidthAt(j)/4)
+		}
+		area.topLeft = area.topLeft.Sub(f32.Pt(radius, radius))
+		area.bottomRight = area.bottomRight.Add(f32.Pt(radius, radius))
+		area.step = max(area.step, plotMinEraseStep)
+		areas = append(areas, area)
+	}
+	return areas
+}
+
+// near reports whether the segment from a to b may pass under the eraser.
+func (e *eraserArea) near(a, b f32.Point) bool {
+	return max(a.X, b.X) >= e.topLeft.X && min(a.X, b.X) <= e.bottomRight.X &&
+		max(a.Y, b.Y) >= e.topLeft.Y && min(a.Y, b.Y) <= e.bottomRight.Y
+}
+
+func (e *eraserArea) covers(p f32.Point) bool {
+	return e.near(p, p) && e.stroke.Covers(p)
+}
+
+// erase cuts out of lines what the erasers paint over, judged by the centre
+// of the line. Near an eraser, lines are checked every quarter of its width,
+// which is as precise as the cuts get.
+func erase(lines [][]f32.Point, erasers []eraserArea) [][]f32.Point {
+	if len(erasers) == 0 {
+		return lines
+	}
+	covered := func(p f32.Point) bool {
+		for i := range erasers {
+			if erasers[i].covers(p) {
+				return true
+			}
+		}
+		return false
+	}
+
+	var kept [][]f32.Point
+	for _, points := range lines {
+		if len(points) == 1 {
+			if !covered(points[0]) {
+				kept = append(kept, points)
+			}
+			continue
+		}
+		var run []f32.Point
+		visit := func(p f32.Point) {
+			if !covered(p) {
+				run = append(run, p)
+				return
+			}
+			if len(run) > 1 {
+				kept = append(kept, run)
+			}
+			run = nil
+		}
+		visit(points[0])
+		for i := 1; i < len(points); i++ {
+			a, b := points[i-1], points[i]
+			step := float32(math.Inf(1))
+			for j := range erasers {
+				if erasers[j].near(a, b) {
+					step = min(step, erasers[j].step)
+				}
+			}
+			steps := 1
+			if !math.IsInf(float64(step), 1) {
+				steps = max(1, int(math.Ceil(float64(distance(a, b)/step))))
+			}
+			for j := 1; j <= steps; j++ {
+				visit(a.Add(b.Sub(a).Mul(float32(j) / float32(steps))))
+			}
+		}
+		if len(run) > 1 {
+			kept = append(kept, run)
+		}
+	}
+	return kept
+}
+
+// plotPath is one pen-down movement in millimetres, with the origin at the
+// bottom left of the paper as plotters expect.
+type plotPath struct {
+	pen    int
+	points []f32.Point
+}
+
+// plotPaths turns strokes and shapes, with their dashes and arrow heads,
+// into pen paths scaled to fit the paper. The paper is turned to landscape
+// for wide drawings. Paths are grouped by pen and ordered to keep pen-up
+// travel short. Line widths are those of the pens; texts are not plotted.
+//
+// A pen cannot erase or lay down part of its ink, so eraser strokes are not
+// plotted; the parts of earlier strokes they paint over are cut out instead.
+// Fully transparent elements are left out, and translucent ones are drawn
+// with the pen nearest in colour at full strength: alpha only decides
+// whether an element is plotted at all.
+func plotPaths(c *canvas.Canvas, opts PlotterOptions) ([]plotPath, float32, float32, error) {
+	type line struct {
+		col    color.NRGBA
+		points []f32.Point
+	}
+	var lines []line
+	erasers := eraserAreas(c.Strokes)
+	for i := range c.Strokes {
+		s := &c.Strokes[i]
+		for len(erasers) > 0 && erasers[0].index < i {
+			erasers = erasers[1:]
+		}
+		if len(s.Points) == 0 || s.Eraser || s.Color.A == 0 {
+			continue
+		}
+		parts := [][]f32.Point{s.Points}
+		if len(s.Dash) > 0 {
+			parts = canvas.DashPolyline(s.Points, s.Dash)
+		}
+		for _, part := range erase(parts, erasers) {
+			lines = append(lines, line{s.Color, part})
+		}
+	}
+	for i := range c.Shapes {
+		s := &c.Shapes[i]
+		if s.Color.A == 0 {
+			continue
+		}
+		for _, part := range shapeLines(s) {
+			lines = append(lines, line{s.Color, part})
+		}
+	}
+
+	topLeft, bottomRight, ok := f32.Point{}, f32.Point{}, false
+	for _, l := range lines {
+		for _, p := range l.points {
+			if !ok {
+				topLeft, bottomRight, ok = p, p, true
+			}
+			topLeft = f32.Pt(min(topLeft.X, p.X), min(topLeft.Y, p.Y))
+			bottomRight = f32.Pt(max(bottomRight.X, p.X), max(bottomRight.Y, p.Y))
+		}
+	}
+	if !ok {
+		return nil, 0, 0, errors.New("plotter: nothing to plot")
+	}
+
+	width, height := opts.Paper.Size()
+	content := bottomRight.Sub(topLeft)
+	if content.X > content.Y {
+		width, height = height, width
+	}
+	area := f32.Pt(width-2*opts.Margin, height-2*opts.Margin)
+	if area.X <= 0 || area.Y <= 0 {
+		return nil, 0, 0, fmt.Errorf("plotter: margin of %g mm leaves no room on %s paper", opts.Margin, opts.Paper)
+	}
+	scale := min(area.X/max(content.X, 1e-3), area.Y/max(content.Y, 1e-3))
+	offset := f32.Pt(opts.Margin, opts.Margin).Add(area.Sub(content.Mul(scale)).Mul(0.5))
+	toPaper := func(p f32.Point) f32.Point {
+		q := p.Sub(topLeft).Mul(scale).Add(offset)
+		return f32.Pt(q.X, height-q.Y)
+	}
+
+	byPen := make(map[int][][]f32.Point)
+	for _, l := range lines {
+		points := []f32.Point{toPaper(l.points[0])}
+		for _, p := range l.points[1:] {
+			q := toPaper(p)
+			if distance(q, points[len(points)-1]) >= plotMinStep {
+				points = append(points, q)
+			}
+		}
+		if last := toPaper(l.points[len(l.points)-1]); len(points) == 1 || points[len(points)-1] != last {
+			points = append(points, last)
+		}
+		pen := nearestPen(l.col, opts.Pens)
+		byPen[pen] = append(byPen[pen], points)
+	}
+
+	pens := make([]int, 0, len(byPen))
+	for pen := range byPen {
+		pens = append(pens, pen)
+	}
+	sort.Ints(pens)
+	var paths []plotPath
+	var at f32.Point
+	for _, pen := range pens {
+		for _, points := range orderPaths(byPen[pen], &at) {
+			paths = append(paths, plotPath{pen: pen, points: points})
+		}
+	}
+	return paths, width, height, nil
+}
+
+// orderPaths sorts paths greedily, always going on with the path whose
+// nearer end is closest to the pen, and reversing paths to start there. at
+// is where the pen starts and is left where it ends.
+func orderPaths(paths [][]f32.Point, at *f32.Point) [][]f32.Point {
+	ordered := make([][]f32.Point, 0, len(paths))
+	done := make([]bool, len(paths))
+	for range paths {
+		best, reverse, bestDist := -1, false, float32(math.MaxFloat32)
+		for i, p := range paths {
+			if done[i] {
+				continue
+			}
+			if d := distance(*at, p[0]); d < bestDist {
+				best, reverse, bestDist = i, false, d
+			}
+			if d := distance(*at, p[len(p)-1]); d < bestDist {
+				best, reverse, bestDist = i, true, d
+			}
+		}
+		done[best] = true
+		p := paths[best]
+		if reverse {
+			p = make([]f32.Point, len(paths[best]))
+			for i, q := range paths[best] {
+				p[len(p)-1-i] = q
+			}
+		}
+		ordered = append(ordered, p)
+		*at = p[len(p)-1]
+	}
+	return ordered
+}
+
+// nearestPen returns the 1-based slot of the pen closest in colour to col.
+func nearestPen(col color.NRGBA, pens []color.NRGBA) int {
+	best, bestDist := 1, math.MaxFloat64
+	for i, pen := range pens {
+		dr := float64(col.R) - float64(pen.R)
+		dg := float64(col.G) - float64(pen.G)
+		db := float64(col.B) - float64(pen.B)
+		if d := dr*dr + dg*dg + db*db; d < bestDist {
+			best, bestDist = i+1, d
+		}
+	}
+	return best
+}
+
+// WriteHPGL writes c as HPGL in plotter units of 0.025 mm, selecting a pen
+// with SP before the paths drawn with it.
+func WriteHPGL(w io.Writer, c *canvas.Canvas, opts PlotterOptions) error {
+	opts = opts.withDefaults()
+	paths, _, _, err := plotPaths(c, opts)
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprint(bw, "IN;\n")
+	pen := 0
+	for _, path := range paths {
+		if path.pen != pen {
+			pen = path.pen
+			fmt.Fprintf(bw, "SP%d;\n", pen)
+		}
+		fmt.Fprintf(bw, "PU%s;\n", hpglPoint(path.points[0]))
+		for i := 1; i < len(path.points); i += hpglPointsPerPD {
+			fmt.Fprint(bw, "PD")
+			for j := i; j < min(i+hpglPointsPerPD, len(path.points)); j++ {
+				if j > i {
+					fmt.Fprint(bw, ",")
+				}
+				fmt.Fprint(bw, hpglPoint(path.points[j]))
+			}
+			fmt.Fprint(bw, ";\n")
+		}
+	}
+	fmt.Fprint(bw, "PU;\nSP0;\n")
+	return bw.Flush()
+}
+
+func hpglPoint(p f32.Point) string {
+	return strconv.Itoa(int(math.Round(float64(p.X*hpglUnitsPerMM)))) + "," +
+		strconv.Itoa(int(math.Round(float64(p.Y*hpglUnitsPerMM))))
+}
+
+// WriteGCode writes c as G-code in millimetres for plotters that lift the
+// pen with the PenUp and PenDown commands. Between pens the program stops
+// with M0 so the pen can be changed by hand.
+func WriteGCode(w io.Writer, c *canvas.Canvas, opts PlotterOptions) error {
+	opts = opts.withDefaults()
+	paths, width, height, err := plotPaths(c, opts)
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "; screenpen plot on %s paper, %s x %s mm\n", opts.Paper, gcodeNum(width), gcodeNum(height))
+	fmt.Fprint(bw, "G21 ; millimetres\nG90 ; absolute positions\n")
+	fmt.Fprintln(bw, opts.PenUp)
+	pen := 0
+	for _, path := range paths {
+		if path.pen != pen {
+			if pen != 0 {
+				fmt.Fprintf(bw, "M0 ; change to pen %d\n", path.pen)
+			}
+			pen = path.pen
+			fmt.Fprintf(bw, "; pen %d %s\n", pen, xoppColor(opts.Pens[pen-1])[:7])
+		}
+		start := path.points[0]
+		fmt.Fprintf(bw, "G0 X%s Y%s\n", gcodeNum(start.X), gcodeNum(start.Y))
+		fmt.Fprintln(bw, opts.PenDown)
+		for i, p := range path.points[1:] {
+			fmt.Fprintf(bw, "G1 X%s Y%s", gcodeNum(p.X), gcodeNum(p.Y))
+			if i == 0 {
+				fmt.Fprintf(bw, " F%s", gcodeNum(opts.FeedRate))
+			}
+			fmt.Fprintln(bw)
+		}
+		fmt.Fprintln(bw, opts.PenUp)
+	}
+	fmt.Fprint(bw, "G0 X0 Y0\nM2\n")
+	return bw.Flush()
+}
+
+func gcodeNum(v float32) string {
+	return strconv.FormatFloat(float64(v), 'f', 2, 32)
+}
+
+func SaveHPGL(path string, c *canvas.Canvas, opts PlotterOptions) error {
+	return savePlot(path, c, opts, WriteHPGL)
+}
+
+func SaveGCode(path string, c *canvas.Canvas, opts PlotterOptions) error {
+	return savePlot(path, c, opts, WriteGCode)
+}
+
+func savePlot(path string, c *canvas.Canvas, opts PlotterOptions, write func(io.Writer, *canvas.Canvas, PlotterOptions) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(f, c, opts); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,55 @@
+package format
+
+import (
+	"image/color"
+	"testing"
+
+	"gioui.org/f32"
+
+	"screenpengo/internal/canvas"
+)
+
+func TestPlotPathsErase(t *testing.T) {
+	black := canvas.Stroke{Points: []f32.Point{f32.Pt(0, 0), f32.Pt(100, 0)}, Color: color.NRGBA{A: 255}, Width: 2}
+	white := black
+	white.Color = canvas.EraserColor
+	eraser := canvas.Stroke{
+		Points: []f32.Point{f32.Pt(50, -20), f32.Pt(50, 20)},
+		Color:  canvas.EraserColor,
+		Width:  10,
+		Eraser: true,
+	}
+
+	tests := []struct {
+		name    string
+		strokes []canvas.Stroke
+		want    int
+	}{
+		{"not erased", []canvas.Stroke{black}, 1},
+		{"cut in two", []canvas.Stroke{black, eraser}, 2},
+		{"erased before drawing", []canvas.Stroke{eraser, black}, 1},
+		{"white ink", []canvas.Stroke{white}, 1},
+		{"white ink cut", []canvas.Stroke{white, eraser}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			paths, _, _, err := plotPaths(&canvas.Canvas{Strokes: tt.strokes}, PlotterOptions{}.withDefaults())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(paths) != tt.want {
+				t.Errorf("got %d paths, want %d", len(paths), tt.want)
+			}
+		})
+	}
+}
+
+func TestPlotPathsFullyErased(t *testing.T) {
+	c := &canvas.Canvas{Strokes: []canvas.Stroke{
+		{Points: []f32.Point{f32.Pt(0, 0), f32.Pt(10, 0)}, Color: color.NRGBA{A: 255}, Width: 2},
+		{Points: []f32.Point{f32.Pt(-5, 0), f32.Pt(15, 0)}, Color: canvas.EraserColor, Width: 10, Eraser: true},
+	}}
+	if _, _, _, err := plotPaths(c, PlotterOptions{}.withDefaults()); err == nil {
+		t.Error("plotted a drawing that was erased entirely")
+	}
+}
@@ -0,0 +1,176 @@
+package format
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"image/color"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"gioui.org/f32"
+
+	"screenpengo/internal/canvas"
+	"screenpengo/internal/tool"
+)
+
+func WriteSVG(w io.Writer, c *canvas.Canvas, width, height int) error {
+	bw := bufio.NewWriter(w)
+
+	fmt.Fprintf(bw, `<?xml version="1.0" encoding="UTF-8"?>`+"\n")
+	fmt.Fprintf(bw, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`+"\n",
+		width, height, width, height)
+
+	for i := range c.Strokes {
+		writeSVGStroke(bw, &c.Strokes[i])
+	}
+	for i := range c.Shapes {
+		writeSVGShape(bw, &c.Shapes[i])
+	}
+	for i := range c.Texts {
+		writeSVGText(bw, &c.Texts[i])
+	}
+
+	fmt.Fprintf(bw, "</svg>\n")
+	return bw.Flush()
+}
+
+func SaveSVG(path string, c *canvas.Canvas, width, height int) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := WriteSVG(f, c, width, height); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func writeSVGStroke(w io.Writer, s *canvas.Stroke) {
+	if len(s.Points) == 0 {
+		return
+	}
+
+	var d strings.Builder
+	d.WriteString("M" + svgPoint(s.Points[0]))
+	if len(s.Points) == 1 {
+		d.WriteString(" L" + svgPoint(s.Points[0]))
+	}
+	for _, p := range s.Points[1:] {
+		d.WriteString(" L" + svgPoint(p))
+	}
+
+	fmt.Fprintf(w, `  <path d="%s" fill="none" %s/>`+"\n", d.String(), svgStrokeAttrs(s.Color, s.Width)+svgDashAttrs(s.Dash))
+}
+
+// writeSVGText puts each line in its own element, since SVG text does not
+// wrap at newlines.
+func writeSVGText(w io.Writer, t *canvas.Text) {
+	attrs := fmt.Sprintf(`font-size="%s" %s dominant-baseline="text-before-edge"`, svgNum(t.Size), svgFillAttrs(t.Color))
+	if t.Font != "" {
+		attrs += ` font-family="` + html.EscapeString(t.Font) + `"`
+	}
+	for i, line := range strings.Split(t.Text, "\n") {
+		y := t.Pos.Y + float32(i)*t.Size*1.2
+		fmt.Fprintf(w, `  <text x="%s" y="%s" %s>%s</text>`+"\n", svgNum(t.Pos.X), svgNum(y), attrs, html.EscapeString(line))
+	}
+}
+
+func writeSVGShape(w io.Writer, s *canvas.Shape) {
+	solidAttrs := svgStrokeAttrs(s.Color, s.OutlineWidth())
+	attrs := solidAttrs + svgDashAttrs(s.Dash)
+
+	switch s.Type {
+	case tool.Circle:
+		radius := s.Radius()
+		if radius < 1 {
+			return
+		}
+		fmt.Fprintf(w, `  <circle cx="%s" cy="%s" r="%s" fill="none" %s/>`+"\n",
+			svgNum(s.StartPos.X), svgNum(s.StartPos.Y), svgNum(radius), attrs)
+	case tool.Rectangle:
+		topLeft, bottomRight := s.Bounds()
+		fmt.Fprintf(w, `  <rect x="%s" y="%s" width="%s" height="%s" fill="none" %s/>`+"\n",
+			svgNum(topLeft.X), svgNum(topLeft.Y),
+			svgNum(bottomRight.X-topLeft.X), svgNum(bottomRight.Y-topLeft.Y), attrs)
+	case tool.Line:
+		writeSVGLine(w, s.StartPos, s.EndPos, attrs)
+	case tool.Arrow:
+		writeSVGLine(w, s.StartPos, s.EndPos, attrs)
+		for _, head := range s.ArrowHeads() {
+			writeSVGArrowHead(w, head, s.Color, solidAttrs)
+		}
+	}
+}
+
+func writeSVGArrowHead(w io.Writer, head canvas.ArrowHeadGeometry, col color.NRGBA, attrs string) {
+	switch head.Style {
+	case tool.HeadOpen:
+		fmt.Fprintf(w, `  <polyline points="%s" fill="none" %s/>`+"\n", svgPoints(head.Points), attrs)
+	case tool.HeadFilled, tool.HeadDiamond:
+		fmt.Fprintf(w, `  <polygon points="%s" %s %s/>`+"\n", svgPoints(head.Points), svgFillAttrs(col), attrs)
+	case tool.HeadCircle:
+		fmt.Fprintf(w, `  <circle cx="%s" cy="%s" r="%s" %s/>`+"\n",
+			svgNum(head.Center.X), svgNum(head.Center.Y), svgNum(head.Radius), svgFillAttrs(col))
+	case tool.HeadBar:
+		writeSVGLine(w, head.Points[0], head.Points[1], attrs)
+	}
+}
+
+func writeSVGLine(w io.Writer, start, end f32.Point, attrs string) {
+	fmt.Fprintf(w, `  <line x1="%s" y1="%s" x2="%s" y2="%s" %s/>`+"\n",
+		svgNum(start.X), svgNum(start.Y), svgNum(end.X), svgNum(end.Y), attrs)
+}
+
+func svgStrokeAttrs(col color.NRGBA, width float32) string {
+	attrs := fmt.Sprintf(`stroke="%s" stroke-width="%s" stroke-linecap="round" stroke-linejoin="round"`,
+		svgColor(col), svgNum(width))
+	if col.A != 255 {
+		attrs += fmt.Sprintf(` stroke-opacity="%s"`, svgNum(float32(col.A)/255))
+	}
+	return attrs
+}
+
+func svgDashAttrs(dash []float32) string {
+	if len(dash) == 0 {
+		return ""
+	}
+	values := make([]string, len(dash))
+	for i, v := range dash {
+		values[i] = svgNum(v)
+	}
+	return fmt.Sprintf(` stroke-dasharray="%s"`, strings.Join(values, " "))
+}
+
+func svgFillAttrs(col color.NRGBA) string {
+	attrs := fmt.Sprintf(`fill="%s"`, svgColor(col))
+	if col.A != 255 {
+		attrs += fmt.Sprintf(` fill-opacity="%s"`, svgNum(float32(col.A)/255))
+	}
+	return attrs
+}
+
+func svgColor(col color.NRGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", col.R, col.G, col.B)
+}
+
+func svgPoint(p f32.Point) string {
+	return svgNum(p.X) + "," + svgNum(p.Y)
+}
+
+func svgPoints(points []f32.Point) string {
+	values := make([]string, len(points))
+	for i, p := range points {
+		values[i] = svgPoint(p)
+	}
+	return strings.Join(values, " ")
+}
+
+func svgNum(v float32) string {
+	s := strconv.FormatFloat(float64(v), 'f', 2, 32)
+	s = strings.TrimRight(s, "0")
+	return strings.TrimSuffix(s, ".")
+}
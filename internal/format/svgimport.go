@@ -0,0 +1,798 @@
+package format
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"image/color"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"gioui.org/f32"
+
+	"screenpengo/internal/canvas"
+	"screenpengo/internal/tool"
+)
+
+// Curves and arcs are flattened into straight segments about curveStep
+// pixels long after transforming, and arcs into at least one segment per
+// arcStep radians.
+const (
+	curveStep = 4
+	arcStep   = math.Pi / 16
+)
+
+// svgStyle holds the inherited presentation attributes the importer uses.
+type svgStyle struct {
+	stroke        string
+	fill          string
+	strokeWidth   float32
+	opacity       float32
+	strokeOpacity float32
+	fillOpacity   float32
+	hidden        bool
+}
+
+type svgReader struct {
+	c      *canvas.Canvas
+	width  float32
+	height float32
+}
+
+// ReadSVG converts an SVG into strokes and shapes. Paths, lines, polylines,
+// polygons, rectangles, circles and ellipses are imported with their
+// transforms and stroke colour; filled elements without a stroke are
+// outlined in their fill colour. Text, images and gradients are skipped.
+// User units become dp, and the returned canvas is sized to the SVG's
+// viewport so that Canvas.FitTo can scale it for the screen.
+func ReadSVG(r io.Reader) (*canvas.Canvas, error) {
+	dec := xml.NewDecoder(r)
+	dec.Strict = false
+
+	type frame struct {
+		transform f32.Affine2D
+		style     svgStyle
+		skip      bool
+	}
+	stack := []frame{{style: svgStyle{fill: "black", strokeWidth: 1, opacity: 1, strokeOpacity: 1, fillOpacity: 1}}}
+	sr := &svgReader{c: &canvas.Canvas{}}
+	sawRoot := false
+
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("svg: %w", err)
+		}
+
+		switch el := tok.(type) {
+		case xml.StartElement:
+			parent := stack[len(stack)-1]
+			attrs := svgAttrs(el)
+			f := frame{transform: parent.transform, style: parent.style.inherit(attrs), skip: parent.skip}
+
+			name := el.Name.Local
+			if name == "svg" && !sawRoot {
+				sawRoot = true
+				f.transform = sr.viewport(attrs)
+			}
+			switch name {
+			case "defs", "clipPath", "mask", "symbol", "marker", "pattern", "title", "desc", "metadata", "style":
+				f.skip = true
+			}
+			if t, ok := attrs["transform"]; ok {
+				m, err := parseTransform(t)
+				if err != nil {
+					return nil, fmt.Errorf("svg: <%s>: %w", name, err)
+				}
+				f.transform = f.transform.Mul(m)
+			}
+			stack = append(stack, f)
+
+			if f.skip || f.style.hidden {
+				continue
+			}
+			if err := sr.element(name, attrs, f.transform, f.style); err != nil {
+				return nil, fmt.Errorf("svg: <%s>: %w", name, err)
+			}
+		case xml.EndElement:
+			if len(stack) > 1 {
+				stack = stack[:len(stack)-1]
+			}
+		}
+	}
+
+	if !sawRoot {
+		return nil, errors.New("svg: no <svg> element")
+	}
+	sr.c.Screen = canvas.Screen{Width: int(sr.width + 0.5), Height: int(sr.height + 0.5), PxPerDp: 1}
+	return sr.c, nil
+}
+
+func svgAttrs(el xml.StartElement) map[string]string {
+	attrs := make(map[string]string, len(el.Attr))
+	for _, a := range el.Attr {
+		attrs[a.Name.Local] = strings.TrimSpace(a.Value)
+	}
+	// Declarations in style="" win over attributes.
+	for _, decl := range strings.Split(attrs["style"], ";") {
+		if name, value, ok := strings.Cut(decl, ":"); ok {
+			attrs[strings.TrimSpace(name)] = strings.TrimSpace(value)
+		}
+	}
+	return attrs
+}
+
+func (s svgStyle) inherit(attrs map[string]string) svgStyle {
+	if v, ok := attrs["stroke"]; ok {
+		s.stroke = v
+	}
+	if v, ok := attrs["fill"]; ok {
+		s.fill = v
+	}
+	if v, ok := attrs["stroke-width"]; ok {
+		if w, err := parseLength(v); err == nil {
+			s.strokeWidth = w
+		}
+	}
+	// opacity is not inherited but applies to the whole group, which for
+	// outlines comes to the same thing as multiplying it down the tree.
+	if v, err := parseLength(attrs["opacity"]); err == nil {
+		s.opacity *= v
+	}
+	if v, err := parseLength(attrs["stroke-opacity"]); err == nil {
+		s.strokeOpacity = v
+	}
+	if v, err := parseLength(attrs["fill-opacity"]); err == nil {
+		s.fillOpacity = v
+	}
+	if attrs["display"] == "none" || attrs["visibility"] == "hidden" {
+		s.hidden = true
+	}
+	return s
+}
+
+// ink picks the colour and width of the outline: the stroke if there is one,
+// otherwise a thin line in the fill colour.
+func (s svgStyle) ink() (color.NRGBA, float32, bool) {
+	if col, ok := parseSVGColor(s.stroke); ok {
+		col.A = uint8(float32(col.A) * clamp01(s.opacity*s.strokeOpacity))
+		return col, s.strokeWidth, s.strokeWidth > 0
+	}
+	if col, ok := parseSVGColor(s.fill); ok {
+		col.A = uint8(float32(col.A) * clamp01(s.opacity*s.fillOpacity))
+		return col, 1, true
+	}
+	return color.NRGBA{}, 0, false
+}
+
+// viewport maps the viewBox onto width×height, stretching uniformly and
+// centring like the default preserveAspectRatio.
+func (sr *svgReader) viewport(attrs map[string]string) f32.Affine2D {
+	width, errW := parseLength(attrs["width"])
+	height, errH := parseLength(attrs["height"])
+	box, errBox := parseNumbers(attrs["viewBox"])
+	if errBox != nil || len(box) != 4 || box[2] <= 0 || box[3] <= 0 {
+		sr.width, sr.height = width, height
+		return f32.Affine2D{}
+	}
+	if errW != nil || width <= 0 {
+		width = box[2]
+	}
+	if errH != nil || height <= 0 {
+		height = box[3]
+	}
+	sr.width, sr.height = width, height
+
+	scale := min(width/box[2], height/box[3])
+	offset := f32.Pt((width-box[2]*scale)/2, (height-box[3]*scale)/2)
+	return f32.Affine2D{}.
+		Offset(f32.Pt(-box[0], -box[1])).
+		Scale(f32.Point{}, f32.Pt(scale, scale)).
+		Offset(offset)
+}
+
+func (sr *svgReader) element(name string, attrs map[string]string, m f32.Affine2D, style svgStyle) error {
+	col, width, ok := style.ink()
+	if !ok {
+		return nil
+	}
+	// Like browsers, elements under a transform that cannot be inverted,
+	// such as scale(0), are not drawn: they would have no width.
+	width *= transformScale(m)
+	if !(width > 0) || math.IsInf(float64(width), 0) {
+		return nil
+	}
+	num := func(key string) float32 {
+		v, _ := parseLength(attrs[key])
+		return v
+	}
+
+	switch name {
+	case "line":
+		start := m.Transform(f32.Pt(num("x1"), num("y1")))
+		end := m.Transform(f32.Pt(num("x2"), num("y2")))
+		sr.shape(tool.Line, col, width, start, end)
+	case "rect":
+		x, y, w, h := num("x"), num("y"), num("width"), num("height")
+		if w <= 0 || h <= 0 {
+			return nil
+		}
+		rx, ry := num("rx"), num("ry")
+		if rx == 0 {
+			rx = ry
+		}
+		if ry == 0 {
+			ry = rx
+		}
+		if _, hx, _, hy, _, _ := m.Elems(); rx == 0 && hx == 0 && hy == 0 {
+			sr.shape(tool.Rectangle, col, width, m.Transform(f32.Pt(x, y)), m.Transform(f32.Pt(x+w, y+h)))
+			return nil
+		}
+		rx, ry = min(rx, w/2), min(ry, h/2)
+		d := fmt.Sprintf("M%g %g H%g A%g %g 0 0 1 %g %g V%g A%g %g 0 0 1 %g %g H%g A%g %g 0 0 1 %g %g V%g A%g %g 0 0 1 %g %g Z",
+			x+rx, y, x+w-rx, rx, ry, x+w, y+ry, y+h-ry, rx, ry, x+w-rx, y+h, x+rx, rx, ry, x, y+h-ry, y+ry, rx, ry, x+rx, y)
+		return sr.path(d, m, col, width)
+	case "circle", "ellipse":
+		cx, cy := num("cx"), num("cy")
+		rx, ry := num("r"), num("r")
+		if name == "ellipse" {
+			rx, ry = num("rx"), num("ry")
+		}
+		if rx <= 0 || ry <= 0 {
+			return nil
+		}
+		sx, hx, _, hy, sy, _ := m.Elems()
+		if rx == ry && hx == 0 && hy == 0 && sx == sy {
+			center := m.Transform(f32.Pt(cx, cy))
+			sr.shape(tool.Circle, col, width, center, center.Add(f32.Pt(rx*sx, 0)))
+			return nil
+		}
+		d := fmt.Sprintf("M%g %g A%g %g 0 1 1 %g %g A%g %g 0 1 1 %g %g Z",
+			cx+rx, cy, rx, ry, cx-rx, cy, rx, ry, cx+rx, cy)
+		return sr.path(d, m, col, width)
+	case "polyline", "polygon":
+		values, err := parseNumbers(attrs["points"])
+		if err != nil {
+			return err
+		}
+		var points []f32.Point
+		for i := 0; i+1 < len(values); i += 2 {
+			points = append(points, m.Transform(f32.Pt(values[i], values[i+1])))
+		}
+		if name == "polygon" && len(points) > 1 {
+			points = append(points, points[0])
+		}
+		sr.stroke(points, col, width)
+	case "path":
+		return sr.path(attrs["d"], m, col, width)
+	}
+	return nil
+}
+
+func (sr *svgReader) shape(shapeType tool.ShapeType, col color.NRGBA, width float32, start, end f32.Point) {
+	sr.c.Shapes = append(sr.c.Shapes, canvas.Shape{
+		Type:     shapeType,
+		Color:    col,
+		StartPos: start,
+		EndPos:   end,
+		WidthPx:  width,
+	})
+}
+
+func (sr *svgReader) stroke(points []f32.Point, col color.NRGBA, width float32) {
+	if len(points) == 0 {
+		return
+	}
+	s := canvas.Stroke{
+		Points: points,
+		Color:  col,
+		Width:  width,
+	}
+	s.Densify()
+	sr.c.Strokes = append(sr.c.Strokes, s)
+}
+
+// path flattens path data into one stroke per subpath. Points are computed
+// in user space and transformed afterwards, so arcs stay correct under
+// rotation and non-uniform scaling.
+func (sr *svgReader) path(d string, m f32.Affine2D, col color.NRGBA, width float32) error {
+	var (
+		points         []f32.Point
+		current, start f32.Point
+		lastControl    f32.Point
+		lastCmd        byte
+	)
+	flush := func() {
+		if len(points) > 1 {
+			transformed := make([]f32.Point, len(points))
+			for i, p := range points {
+				transformed[i] = m.Transform(p)
+			}
+			sr.stroke(transformed, col, width)
+		}
+		points = nil
+	}
+	lineTo := func(p f32.Point) {
+		if len(points) == 0 {
+			points = append(points, current)
+		}
+		points = append(points, p)
+		current = p
+	}
+
+	step := curveStep / max(transformScale(m), 1e-3)
+	s := &pathScanner{s: d}
+	var cmd byte
+	for {
+		s.skipSpace()
+		if s.done() {
+			break
+		}
+		begin := s.pos
+		if c := s.peek(); isPathCommand(c) {
+			if cmd == 0 && c != 'M' && c != 'm' {
+				return fmt.Errorf("path data must start with a moveto, got %q", c)
+			}
+			cmd = c
+			s.pos++
+		} else if c >= 'A' && c <= 'z' && c != 'e' && c != 'E' {
+			return fmt.Errorf("unsupported path command %q", c)
+		} else if cmd == 0 {
+			return fmt.Errorf("path data must start with a command, got %q", c)
+		}
+		rel := cmd >= 'a'
+		abs := func(p f32.Point) f32.Point {
+			if rel {
+				return current.Add(p)
+			}
+			return p
+		}
+
+		switch cmd {
+		case 'M', 'm':
+			p, err := s.point()
+			if err != nil {
+				return err
+			}
+			flush()
+			current = abs(p)
+			start = current
+			// Further coordinate pairs are implicit line-tos.
+			if rel {
+				cmd = 'l'
+			} else {
+				cmd = 'L'
+			}
+		case 'L', 'l':
+			p, err := s.point()
+			if err != nil {
+				return err
+			}
+			lineTo(abs(p))
+		case 'H', 'h':
+			x, err := s.number()
+			if err != nil {
+				return err
+			}
+			if rel {
+				x += current.X
+			}
+			lineTo(f32.Pt(x, current.Y))
+		case 'V', 'v':
+			y, err := s.number()
+			if err != nil {
+				return err
+			}
+			if rel {
+				y += current.Y
+			}
+			lineTo(f32.Pt(current.X, y))
+		case 'C', 'c', 'S', 's':
+			var c1 f32.Point
+			if cmd == 'S' || cmd == 's' {
+				c1 = current
+				if strings.IndexByte("CcSs", lastCmd) >= 0 {
+					c1 = current.Mul(2).Sub(lastControl)
+				}
+			} else {
+				p, err := s.point()
+				if err != nil {
+					return err
+				}
+				c1 = abs(p)
+			}
+			c2, err := s.point()
+			if err != nil {
+				return err
+			}
+			end, err := s.point()
+			if err != nil {
+				return err
+			}
+			c2, end = abs(c2), abs(end)
+			from := current
+			for _, p := range flattenCubic(from, c1, c2, end, step) {
+				lineTo(p)
+			}
+			lastControl = c2
+		case 'Q', 'q', 'T', 't':
+			var c1 f32.Point
+			if cmd == 'T' || cmd == 't' {
+				c1 = current
+				if strings.IndexByte("QqTt", lastCmd) >= 0 {
+					c1 = current.Mul(2).Sub(lastControl)
+				}
+			} else {
+				p, err := s.point()
+				if err != nil {
+					return err
+				}
+				c1 = abs(p)
+			}
+			end, err := s.point()
+			if err != nil {
+				return err
+			}
+			end = abs(end)
+			from := current
+			// A quadratic is a cubic with both controls two thirds of the
+			// way towards the quadratic control point.
+			cc1 := from.Add(c1.Sub(from).Mul(2.0 / 3))
+			cc2 := end.Add(c1.Sub(end).Mul(2.0 / 3))
+			for _, p := range flattenCubic(from, cc1, cc2, end, step) {
+				lineTo(p)
+			}
+			lastControl = c1
+		case 'A', 'a':
+			radii, err := s.point()
+			if err != nil {
+				return err
+			}
+			rotation, err := s.number()
+			if err != nil {
+				return err
+			}
+			large, err := s.flag()
+			if err != nil {
+				return err
+			}
+			sweep, err := s.flag()
+			if err != nil {
+				return err
+			}
+			end, err := s.point()
+			if err != nil {
+				return err
+			}
+			end = abs(end)
+			for _, p := range flattenArc(current, end, radii, rotation, large, sweep, step) {
+				lineTo(p)
+			}
+		case 'Z', 'z':
+			if len(points) > 0 {
+				lineTo(start)
+			}
+			flush()
+			current = start
+			// Numbers after a close are line-tos from the start point.
+			if rel {
+				cmd = 'l'
+			} else {
+				cmd = 'L'
+			}
+		default:
+			return fmt.Errorf("unsupported path command %q", cmd)
+		}
+		if s.pos == begin {
+			// Every command reads something; never spin on the same input.
+			return fmt.Errorf("invalid path data at offset %d", begin)
+		}
+		lastCmd = cmd
+	}
+	flush()
+	return nil
+}
+
+func isPathCommand(c byte) bool {
+	return strings.IndexByte("MmLlHhVvCcSsQqTtAaZz", c) >= 0
+}
+
+type pathScanner struct {
+	s   string
+	pos int
+}
+
+func (s *pathScanner) done() bool { return s.pos >= len(s.s) }
+func (s *pathScanner) peek() byte { return s.s[s.pos] }
+
+func (s *pathScanner) skipSpace() {
+	for !s.done() && strings.IndexByte(" \t\r\n,", s.peek()) >= 0 {
+		s.pos++
+	}
+}
+
+// number reads one number. Path data may run numbers together, as in
+// "1.5.5" or "1-2", so it cannot simply split on separators.
+func (s *pathScanner) number() (float32, error) {
+	s.skipSpace()
+	begin := s.pos
+	if !s.done() && (s.peek() == '+' || s.peek() == '-') {
+		s.pos++
+	}
+	digits, dot := false, false
+	for ; !s.done(); s.pos++ {
+		if c := s.peek(); c >= '0' && c <= '9' {
+			digits = true
+		} else if c == '.' && !dot {
+			dot = true
+		} else {
+			break
+		}
+	}
+	if digits && !s.done() && (s.peek() == 'e' || s.peek() == 'E') {
+		s.pos++
+		if !s.done() && (s.peek() == '+' || s.peek() == '-') {
+			s.pos++
+		}
+		for !s.done() && s.peek() >= '0' && s.peek() <= '9' {
+			s.pos++
+		}
+	}
+	if !digits {
+		return 0, fmt.Errorf("expected a number at offset %d", begin)
+	}
+	v, err := strconv.ParseFloat(s.s[begin:s.pos], 32)
+	return float32(v), err
+}
+
+func (s *pathScanner) point() (f32.Point, error) {
+	x, err := s.number()
+	if err != nil {
+		return f32.Point{}, err
+	}
+	y, err := s.number()
+	return f32.Pt(x, y), err
+}
+
+// flag reads an arc flag, which may be written without a separator.
+func (s *pathScanner) flag() (bool, error) {
+	s.skipSpace()
+	if s.done() || (s.peek() != '0' && s.peek() != '1') {
+		return false, fmt.Errorf("expected an arc flag at offset %d", s.pos)
+	}
+	s.pos++
+	return s.s[s.pos-1] == '1', nil
+}
+
+func flattenCubic(p0, p1, p2, p3 f32.Point, step float32) []f32.Point {
+	length := distance(p0, p1) + distance(p1, p2) + distance(p2, p3)
+	n := max(1, min(200, int(length/step)))
+	points := make([]f32.Point, n)
+	for i := 1; i <= n; i++ {
+		t := float32(i) / float32(n)
+		u := 1 - t
+		points[i-1] = p0.Mul(u * u * u).
+			Add(p1.Mul(3 * u * u * t)).
+			Add(p2.Mul(3 * u * t * t)).
+			Add(p3.Mul(t * t * t))
+	}
+	return points
+}
+
+// flattenArc follows the endpoint-to-centre conversion in the SVG
+// specification, appendix B.2.4.
+func flattenArc(from, to, radii f32.Point, rotationDeg float32, large, sweep bool, step float32) []f32.Point {
+	rx, ry := math.Abs(float64(radii.X)), math.Abs(float64(radii.Y))
+	if rx == 0 || ry == 0 || from == to {
+		return []f32.Point{to}
+	}
+	phi := float64(rotationDeg) * math.Pi / 180
+	sinPhi, cosPhi := math.Sincos(phi)
+
+	dx, dy := float64(from.X-to.X)/2, float64(from.Y-to.Y)/2
+	x1 := cosPhi*dx + sinPhi*dy
+	y1 := -sinPhi*dx + cosPhi*dy
+
+	if scale := x1*x1/(rx*rx) + y1*y1/(ry*ry); scale > 1 {
+		rx *= math.Sqrt(scale)
+		ry *= math.Sqrt(scale)
+	}
+
+	num := rx*rx*ry*ry - rx*rx*y1*y1 - ry*ry*x1*x1
+	den := rx*rx*y1*y1 + ry*ry*x1*x1
+	coef := math.Sqrt(math.Max(0, num/den))
+	if large == sweep {
+		coef = -coef
+	}
+	cx1 := coef * rx * y1 / ry
+	cy1 := -coef * ry * x1 / rx
+	cx := cosPhi*cx1 - sinPhi*cy1 + float64(from.X+to.X)/2
+	cy := sinPhi*cx1 + cosPhi*cy1 + float64(from.Y+to.Y)/2
+
+	angle := func(ux, uy, vx, vy float64) float64 {
+		return math.Atan2(ux*vy-uy*vx, ux*vx+uy*vy)
+	}
+	theta := angle(1, 0, (x1-cx1)/rx, (y1-cy1)/ry)
+	delta := angle((x1-cx1)/rx, (y1-cy1)/ry, (-x1-cx1)/rx, (-y1-cy1)/ry)
+	if !sweep && delta > 0 {
+		delta -= 2 * math.Pi
+	} else if sweep && delta < 0 {
+		delta += 2 * math.Pi
+	}
+
+	n := int(math.Abs(delta) * math.Max(rx, ry) / float64(step))
+	n = max(int(math.Ceil(math.Abs(delta)/arcStep)), min(200, n))
+	points := make([]f32.Point, n)
+	for i := 1; i <= n; i++ {
+		a := theta + delta*float64(i)/float64(n)
+		sinA, cosA := math.Sincos(a)
+		x := cosPhi*rx*cosA - sinPhi*ry*sinA + cx
+		y := sinPhi*rx*cosA + cosPhi*ry*sinA + cy
+		points[i-1] = f32.Pt(float32(x), float32(y))
+	}
+	points[n-1] = to
+	return points
+}
+
+// parseTransform reads a transform list. Items apply right to left, as if
+// each were a nested group.
+func parseTransform(s string) (f32.Affine2D, error) {
+	var m f32.Affine2D
+	rest := strings.TrimSpace(s)
+	for rest != "" {
+		open := strings.IndexByte(rest, '(')
+		closing := strings.IndexByte(rest, ')')
+		if open < 0 || closing < open {
+			return m, fmt.Errorf("invalid transform %q", s)
+		}
+		name := strings.TrimSpace(rest[:open])
+		args, err := parseNumbers(rest[open+1 : closing])
+		if err != nil {
+			return m, err
+		}
+		rest = strings.TrimLeft(rest[closing+1:], " \t\r\n,")
+
+		arg := func(i int, def float32) float32 {
+			if i < len(args) {
+				return args[i]
+			}
+			return def
+		}
+		var item f32.Affine2D
+		switch name {
+		case "matrix":
+			if len(args) != 6 {
+				return m, fmt.Errorf("matrix needs 6 values, got %d", len(args))
+			}
+			item = f32.NewAffine2D(args[0], args[2], args[4], args[1], args[3], args[5])
+		case "translate":
+			item = item.Offset(f32.Pt(arg(0, 0), arg(1, 0)))
+		case "scale":
+			sx := arg(0, 1)
+			item = item.Scale(f32.Point{}, f32.Pt(sx, arg(1, sx)))
+		case "rotate":
+			// SVG angles turn clockwise on screen, which is what Gio's
+			// counter-clockwise rotation does with y pointing down.
+			center := f32.Pt(arg(1, 0), arg(2, 0))
+			item = item.Rotate(center, arg(0, 0)*math.Pi/180)
+		case "skewX":
+			item = item.Shear(f32.Point{}, arg(0, 0)*math.Pi/180, 0)
+		case "skewY":
+			item = item.Shear(f32.Point{}, 0, arg(0, 0)*math.Pi/180)
+		default:
+			return m, fmt.Errorf("unknown transform %q", name)
+		}
+		m = m.Mul(item)
+	}
+	return m, nil
+}
+
+// transformScale is how much m scales lengths on average, used for stroke
+// widths.
+func transformScale(m f32.Affine2D) float32 {
+	sx, hx, _, hy, sy, _ := m.Elems()
+	return float32(math.Sqrt(math.Abs(float64(sx*sy - hx*hy))))
+}
+
+func parseNumbers(s string) ([]float32, error) {
+	scanner := &pathScanner{s: s}
+	var values []float32
+	for {
+		scanner.skipSpace()
+		if scanner.done() {
+			return values, nil
+		}
+		v, err := scanner.number()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+}
+
+// parseLength reads a number, ignoring a px unit. Percentages and other
+// units are not resolved.
+func parseLength(s string) (float32, error) {
+	s = strings.TrimSuffix(strings.TrimSpace(s), "px")
+	v, err := strconv.ParseFloat(s, 32)
+	return float32(v), err
+}
+
+var svgColorNames = map[string]color.NRGBA{
+	"black":   {A: 255},
+	"white":   {R: 255, G: 255, B: 255, A: 255},
+	"red":     {R: 255, A: 255},
+	"green":   {G: 128, A: 255},
+	"lime":    {G: 255, A: 255},
+	"blue":    {B: 255, A: 255},
+	"yellow":  {R: 255, G: 255, A: 255},
+	"orange":  {R: 255, G: 165, A: 255},
+	"purple":  {R: 128, B: 128, A: 255},
+	"magenta": {R: 255, B: 255, A: 255},
+	"fuchsia": {R: 255, B: 255, A: 255},
+	"cyan":    {G: 255, B: 255, A: 255},
+	"aqua":    {G: 255, B: 255, A: 255},
+	"gray":    {R: 128, G: 128, B: 128, A: 255},
+	"grey":    {R: 128, G: 128, B: 128, A: 255},
+	"silver":  {R: 192, G: 192, B: 192, A: 255},
+	"maroon":  {R: 128, A: 255},
+	"navy":    {B: 128, A: 255},
+	"olive":   {R: 128, G: 128, A: 255},
+	"teal":    {G: 128, B: 128, A: 255},
+	"brown":   {R: 165, G: 42, B: 42, A: 255},
+	"pink":    {R: 255, G: 192, B: 203, A: 255},
+}
+
+// parseSVGColor understands #rgb, #rrggbb, rgb() and basic colour names.
+// "none", gradients and anything else unknown mean no colour.
+func parseSVGColor(s string) (color.NRGBA, bool) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if col, ok := svgColorNames[s]; ok {
+		return col, true
+	}
+	if strings.HasPrefix(s, "#") {
+		hex := s[1:]
+		if len(hex) == 3 {
+			hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+		}
+		v, err := strconv.ParseUint(hex, 16, 32)
+		if err != nil || len(hex) != 6 {
+			return color.NRGBA{}, false
+		}
+		return color.NRGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 255}, true
+	}
+	if strings.HasPrefix(s, "rgb(") && strings.HasSuffix(s, ")") {
+		parts := strings.Split(s[4:len(s)-1], ",")
+		if len(parts) != 3 {
+			return color.NRGBA{}, false
+		}
+		var rgb [3]uint8
+		for i, part := range parts {
+			part = strings.TrimSpace(part)
+			scale := 1.0
+			if strings.HasSuffix(part, "%") {
+				part, scale = strings.TrimSuffix(part, "%"), 2.55
+			}
+			v, err := strconv.ParseFloat(part, 64)
+			if err != nil {
+				return color.NRGBA{}, false
+			}
+			rgb[i] = uint8(math.Max(0, math.Min(255, v*scale)))
+		}
+		return color.NRGBA{R: rgb[0], G: rgb[1], B: rgb[2], A: 255}, true
+	}
+	return color.NRGBA{}, false
+}
+
+func distance(a, b f32.Point) float32 {
+	return float32(math.Hypot(float64(a.X-b.X), float64(a.Y-b.Y)))
+}
+
+func clamp01(v float32) float32 {
+	return max(0, min(1, v))
+}
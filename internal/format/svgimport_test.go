@@ -0,0 +1,111 @@
+package format
+
+import (
+	"image/color"
+	"strings"
+	"testing"
+
+	"gioui.org/f32"
+
+	"screenpengo/internal/canvas"
+)
+
+func TestPathGrammar(t *testing.T) {
+	tests := []struct {
+		name string
+		d    string
+		// ends holds the first and last point of every stroke.
+		ends [][2]f32.Point
+	}{
+		{"implicit line-tos after moveto", "M0 0 10 0 10 10", [][2]f32.Point{seg(0, 0, 10, 10)}},
+		{"relative implicit line-tos", "m10 10 5 0 0 5", [][2]f32.Point{seg(10, 10, 15, 15)}},
+		{"repeated lineto", "M0 0 L10 0 20 0", [][2]f32.Point{seg(0, 0, 20, 0)}},
+		{"repeated horizontal", "M0 0 H5 10", [][2]f32.Point{seg(0, 0, 10, 0)}},
+		{"numbers run together", "M0-0L10-5.5.5.5", [][2]f32.Point{seg(0, 0, 0.5, 0.5)}},
+		{"close", "M0 0 L10 0 L10 10 Z", [][2]f32.Point{seg(0, 0, 0, 0)}},
+		{"numbers after close", "M0 0 L10 10 Z 5 5", [][2]f32.Point{seg(0, 0, 0, 0), seg(0, 0, 5, 5)}},
+		{"relative numbers after close", "M2 2 L10 2 z 0 5", [][2]f32.Point{seg(2, 2, 2, 2), seg(2, 2, 2, 7)}},
+		{"close twice", "M0 0 L10 10 Z Z", [][2]f32.Point{seg(0, 0, 0, 0)}},
+		{"moveto after close", "M0 0 L10 0 Z M20 20 L30 20", [][2]f32.Point{seg(0, 0, 0, 0), seg(20, 20, 30, 20)}},
+		{"smooth cubic", "M0 0 C0 10 10 10 10 0 S20 -10 20 0", [][2]f32.Point{seg(0, 0, 20, 0)}},
+		{"arc flags without separators", "M0 0 A5 5 0 1120 0", [][2]f32.Point{seg(0, 0, 20, 0)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sr := &svgReader{c: &canvas.Canvas{}}
+			if err := sr.path(tt.d, f32.Affine2D{}, color.NRGBA{A: 255}, 1); err != nil {
+				t.Fatalf("path %q: %v", tt.d, err)
+			}
+			if len(sr.c.Strokes) != len(tt.ends) {
+				t.Fatalf("path %q: got %d strokes, want %d", tt.d, len(sr.c.Strokes), len(tt.ends))
+			}
+			for i, s := range sr.c.Strokes {
+				first, last := s.Points[0], s.Points[len(s.Points)-1]
+				if !near(first, tt.ends[i][0]) || !near(last, tt.ends[i][1]) {
+					t.Errorf("path %q: stroke %d runs from %v to %v, want %v to %v", tt.d, i, first, last, tt.ends[i][0], tt.ends[i][1])
+				}
+			}
+		})
+	}
+}
+
+func TestPathGrammarErrors(t *testing.T) {
+	for _, d := range []string{
+		"L10 10",
+		"10 10",
+		"M0",
+		"M0 0 L10",
+		"M0 0 C1 1 2 2",
+		"M0 0 Q1 1",
+		"M0 0 A5 5 0 1",
+		"M0 0 A5 5 0 2 0 10 10",
+		"M0 0 L1e 2",
+		"M0 0 X5 5",
+		"M0 0 L10 10 #",
+		"M0 0 L10 10 Z #",
+	} {
+		sr := &svgReader{c: &canvas.Canvas{}}
+		if err := sr.path(d, f32.Affine2D{}, color.NRGBA{A: 255}, 1); err == nil {
+			t.Errorf("path %q: expected an error", d)
+		}
+	}
+}
+
+func TestReadSVGNumbersAfterClose(t *testing.T) {
+	c, err := ReadSVG(strings.NewReader(`<svg><path stroke="red" d="M0 0 L10 10 Z 5 5"/></svg>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Strokes) != 2 {
+		t.Errorf("got %d strokes, want 2", len(c.Strokes))
+	}
+}
+
+func TestReadSVGSingularTransform(t *testing.T) {
+	c, err := ReadSVG(strings.NewReader(`<svg>` +
+		`<g transform="scale(0)"><line stroke="red" x1="0" y1="0" x2="10" y2="10"/></g>` +
+		`<path stroke="red" transform="matrix(1 2 2 4 0 0)" d="M0 0 L10 10"/>` +
+		`<line stroke="red" x1="0" y1="0" x2="10" y2="10"/></svg>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Shapes) != 1 || len(c.Strokes) != 0 {
+		t.Fatalf("got %d shapes and %d strokes, want only the untransformed line", len(c.Shapes), len(c.Strokes))
+	}
+	// What is left must survive a save.
+	data, err := canvas.EncodeDocument(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := canvas.DecodeDocument(data); err != nil {
+		t.Errorf("imported drawing does not load back: %v", err)
+	}
+}
+
+func seg(x0, y0, x1, y1 float32) [2]f32.Point {
+	return [2]f32.Point{f32.Pt(x0, y0), f32.Pt(x1, y1)}
+}
+
+func near(a, b f32.Point) bool {
+	return distance(a, b) < 1e-3
+}
@@ -0,0 +1,400 @@
+package format
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"image/color"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"gioui.org/f32"
+
+	"screenpengo/internal/canvas"
+	"screenpengo/internal/tool"
+)
+
+// xoppPageGap separates imported pages, which are stacked top to bottom.
+const xoppPageGap = 20
+
+// The subset of the Xournal++ file format that maps to the canvas. Images,
+// LaTeX and PDF backgrounds are dropped on import.
+type xoppDocument struct {
+	XMLName     xml.Name   `xml:"xournal"`
+	Creator     string     `xml:"creator,attr,omitempty"`
+	FileVersion string     `xml:"fileversion,attr,omitempty"`
+	Title       string     `xml:"title,omitempty"`
+	Pages       []xoppPage `xml:"page"`
+}
+
+type xoppPage struct {
+	Width      float32        `xml:"width,attr"`
+	Height     float32        `xml:"height,attr"`
+	Background xoppBackground `xml:"background"`
+	Layers     []xoppLayer    `xml:"layer"`
+}
+
+type xoppBackground struct {
+	Type  string `xml:"type,attr"`
+	Color string `xml:"color,attr,omitempty"`
+	Style string `xml:"style,attr,omitempty"`
+}
+
+type xoppLayer struct {
+	Strokes []xoppStroke `xml:"stroke"`
+	Texts   []xoppText   `xml:"text"`
+}
+
+// xoppStroke.Width is the nominal width, followed for pressure-sensitive
+// strokes by the width of each segment. Style is the dash pattern: a name
+// from xoppDashStyles, or "cust: " and lengths in multiples of the width.
+type xoppStroke struct {
+	Tool   string `xml:"tool,attr"`
+	Color  string `xml:"color,attr"`
+	Width  string `xml:"width,attr"`
+	Style  string `xml:"style,attr,omitempty"`
+	Points string `xml:",chardata"`
+}
+
+const xoppCustomDash = "cust: "
+
+// xoppDashStyles are the patterns Xournal++ has names for.
+var xoppDashStyles = map[string][]float32{
+	"dash":    {6, 3},
+	"dashdot": {6, 3, 0.5, 3},
+	"dot":     {0.5, 3},
+}
+
+type xoppText struct {
+	Font  string  `xml:"font,attr"`
+	Size  float32 `xml:"size,attr"`
+	X     float32 `xml:"x,attr"`
+	Y     float32 `xml:"y,attr"`
+	Color string  `xml:"color,attr"`
+	Text  string  `xml:",chardata"`
+}
+
+// Colour names used by the original Xournal, which Xournal++ still reads.
+var xoppColorNames = map[string]color.NRGBA{
+	"black":      {A: 255},
+	"blue":       {R: 0x33, G: 0x33, B: 0xcc, A: 255},
+	"red":        {R: 0xff, A: 255},
+	"green":      {G: 0x80, A: 255},
+	"gray":       {R: 0x80, G: 0x80, B: 0x80, A: 255},
+	"lightblue":  {G: 0xc0, B: 0xff, A: 255},
+	"lightgreen": {G: 0xff, A: 255},
+	"magenta":    {R: 0xff, B: 0xff, A: 255},
+	"orange":     {R: 0xff, G: 0x80, A: 255},
+	"yellow":     {R: 0xff, G: 0xff, A: 255},
+	"white":      {R: 0xff, G: 0xff, B: 0xff, A: 255},
+}
+
+// ReadXopp imports a Xournal++ document, compressed or not. Pages are
+// stacked vertically with all their layers merged, and on multi-page
+// documents each page becomes a group that moves as one. Page units (points)
+// become dp.
+func ReadXopp(r io.Reader) (*canvas.Canvas, error) {
+	br := bufio.NewReader(r)
+	if magic, _ := br.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("xopp: %w", err)
+		}
+		defer gz.Close()
+		r = gz
+	} else {
+		r = br
+	}
+
+	var doc xoppDocument
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("xopp: %w", err)
+	}
+	if len(doc.Pages) == 0 {
+		return nil, errors.New("xopp: document has no pages")
+	}
+
+	c := &canvas.Canvas{}
+	var top, width float32
+	for i, page := range doc.Pages {
+		group := 0
+		if len(doc.Pages) > 1 {
+			group = i + 1
+		}
+		offset := f32.Pt(0, top)
+		for _, layer := range page.Layers {
+			for j, xs := range layer.Strokes {
+				s, ok, err := xs.stroke(offset)
+				if err != nil {
+					return nil, fmt.Errorf("xopp: page %d, stroke %d: %w", i+1, j+1, err)
+				}
+				if ok {
+					s.Group = group
+					c.Strokes = append(c.Strokes, s)
+				}
+			}
+			for _, xt := range layer.Texts {
+				col, _ := parseXoppColor(xt.Color)
+				c.Texts = append(c.Texts, canvas.Text{
+					Pos:   f32.Pt(xt.X, xt.Y).Add(offset),
+					Text:  xt.Text,
+					Size:  max(1, xt.Size),
+					Color: col,
+					Font:  xt.Font,
+					Group: group,
+				})
+			}
+		}
+		width = max(width, page.Width)
+		top += page.Height + xoppPageGap
+	}
+
+	c.Screen = canvas.Screen{Width: int(math.Ceil(float64(width))), Height: int(math.Ceil(float64(top - xoppPageGap))), PxPerDp: 1}
+	return c, nil
+}
+
+// stroke converts one stroke. Eraser strokes (Xournal's whiteout) are
+// skipped, since there is no page to paint white on.
+func (xs xoppStroke) stroke(offset f32.Point) (canvas.Stroke, bool, error) {
+	if xs.Tool == "eraser" {
+		return canvas.Stroke{}, false, nil
+	}
+	coords, err := parseNumbers(xs.Points)
+	if err != nil {
+		return canvas.Stroke{}, false, err
+	}
+	if len(coords) < 2 || len(coords)%2 != 0 {
+		return canvas.Stroke{}, false, fmt.Errorf("%d coordinates", len(coords))
+	}
+	widths, err := parseNumbers(xs.Width)
+	if err != nil || len(widths) == 0 || widths[0] <= 0 {
+		return canvas.Stroke{}, false, fmt.Errorf("invalid width %q", xs.Width)
+	}
+	col, ok := parseXoppColor(xs.Color)
+	if !ok {
+		return canvas.Stroke{}, false, fmt.Errorf("invalid color %q", xs.Color)
+	}
+	if xs.Tool == "highlighter" && col.A == 255 {
+		col.A = 128
+	}
+
+	dash, err := parseXoppDash(xs.Style)
+	if err != nil {
+		return canvas.Stroke{}, false, err
+	}
+
+	s := canvas.Stroke{Color: col, Width: widths[0], Dash: canvas.UsableDash(scaledPattern(dash, widths[0]))}
+	for i := 0; i < len(coords); i += 2 {
+		s.Points = append(s.Points, f32.Pt(coords[i], coords[i+1]).Add(offset))
+	}
+	// Segment widths belong to the point the segment starts at; the last
+	// point keeps the width of the last segment.
+	if n := len(s.Points); n > 1 && len(widths) == n {
+		s.Widths = append(widths[1:n:n], widths[n-1])
+	}
+	s.Densify()
+	return s, true, nil
+}
+
+// parseXoppDash reads a stroke style. Styles it does not know are drawn
+// solid, like "plain".
+func parseXoppDash(style string) ([]float32, error) {
+	if pattern, ok := xoppDashStyles[style]; ok {
+		return pattern, nil
+	}
+	if !strings.HasPrefix(style, xoppCustomDash) {
+		return nil, nil
+	}
+	pattern, err := parseNumbers(strings.TrimPrefix(style, xoppCustomDash))
+	if err != nil {
+		return nil, fmt.Errorf("invalid style %q", style)
+	}
+	for _, v := range pattern {
+		if v < 0 {
+			return nil, fmt.Errorf("invalid style %q", style)
+		}
+	}
+	if len(pattern) == 0 {
+		return nil, nil
+	}
+	return pattern, nil
+}
+
+func parseXoppColor(s string) (color.NRGBA, bool) {
+	if col, ok := xoppColorNames[strings.ToLower(s)]; ok {
+		return col, true
+	}
+	hex := strings.TrimPrefix(s, "#")
+	if len(hex) == 6 {
+		hex += "ff"
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil || len(hex) != 8 {
+		return color.NRGBA{A: 255}, false
+	}
+	return color.NRGBA{R: uint8(v >> 24), G: uint8(v >> 16), B: uint8(v >> 8), A: uint8(v)}, true
+}
+
+// WriteXopp writes c as a single-page Xournal++ document the size of the
+// screen it was drawn on. Shapes become plain strokes, and translucent ink
+// is written as highlighter. Dashed strokes keep their pattern as a custom
+// line style; dashed shapes are cut into their dashes.
+func WriteXopp(w io.Writer, c *canvas.Canvas) error {
+	scale := c.Screen.PxPerDp
+	if scale <= 0 {
+		scale = 1
+	}
+	width, height := float32(c.Screen.Width)/scale, float32(c.Screen.Height)/scale
+	if width <= 0 || height <= 0 {
+		_, bottomRight, _ := c.ContentBounds()
+		width, height = max(bottomRight.X/scale, 1), max(bottomRight.Y/scale, 1)
+	}
+
+	var layer xoppLayer
+	for i := range c.Strokes {
+		layer.Strokes = append(layer.Strokes, xoppStrokeOf(&c.Strokes[i], scale))
+	}
+	for i := range c.Shapes {
+		s := &c.Shapes[i]
+		for _, line := range shapeLines(s) {
+			flat := canvas.Stroke{Points: line, Color: s.Color, Width: s.OutlineWidth()}
+			layer.Strokes = append(layer.Strokes, xoppStrokeOf(&flat, scale))
+		}
+	}
+	for _, t := range c.Texts {
+		font := t.Font
+		if font == "" {
+			font = "Sans"
+		}
+		layer.Texts = append(layer.Texts, xoppText{
+			Font:  font,
+			Size:  t.Size / scale,
+			X:     t.Pos.X / scale,
+			Y:     t.Pos.Y / scale,
+			Color: xoppColor(t.Color),
+			Text:  t.Text,
+		})
+	}
+
+	doc := xoppDocument{
+		Creator:     "screenpen",
+		FileVersion: "4",
+		Title:       "Xournal++ document - see https://xournalpp.github.io/",
+		Pages: []xoppPage{{
+			Width:      width,
+			Height:     height,
+			Background: xoppBackground{Type: "solid", Color: "#ffffffff", Style: "plain"},
+			Layers:     []xoppLayer{layer},
+		}},
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(`<?xml version="1.0" standalone="no"?>` + "\n")
+	enc := xml.NewEncoder(&buf)
+	enc.Indent("", " ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(w)
+	if _, err := gz.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+func SaveXopp(path string, c *canvas.Canvas) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := WriteXopp(f, c); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func xoppStrokeOf(s *canvas.Stroke, scale float32) xoppStroke {
+	points := s.Points
+	if len(points) == 1 {
+		points = []f32.Point{points[0], points[0]}
+	}
+	coords := make([]string, 0, 2*len(points))
+	for _, p := range points {
+		coords = append(coords, xoppNum(p.X/scale), xoppNum(p.Y/scale))
+	}
+
+	widths := []string{xoppNum(s.Width / scale)}
+	if s.Widths != nil && len(points) == len(s.Points) {
+		for i := 0; i < len(points)-1; i++ {
+			widths = append(widths, xoppNum((s.WidthAt(i)+s.WidthAt(i+1))/2/scale))
+		}
+	}
+
+	var style string
+	if len(s.Dash) > 0 && s.Width > 0 {
+		lengths := make([]string, len(s.Dash))
+		for i, v := range s.Dash {
+			lengths[i] = xoppNum(v / s.Width)
+		}
+		style = xoppCustomDash + strings.Join(lengths, " ")
+	}
+
+	strokeTool := "pen"
+	if s.Color.A < 255 {
+		strokeTool = "highlighter"
+	}
+	return xoppStroke{
+		Tool:   strokeTool,
+		Color:  xoppColor(s.Color),
+		Width:  strings.Join(widths, " "),
+		Style:  style,
+		Points: strings.Join(coords, " "),
+	}
+}
+
+// shapeLines traces a shape and its arrow heads as polylines. Like on
+// screen, only the body is dashed.
+func shapeLines(s *canvas.Shape) [][]f32.Point {
+	lines := s.Outline()
+	if len(s.Dash) > 0 {
+		var dashed [][]f32.Point
+		for _, line := range lines {
+			dashed = append(dashed, canvas.DashPolyline(line, s.Dash)...)
+		}
+		lines = dashed
+	}
+	for _, head := range s.ArrowHeads() {
+		switch head.Style {
+		case tool.HeadOpen, tool.HeadBar:
+			lines = append(lines, head.Points)
+		case tool.HeadFilled, tool.HeadDiamond:
+			lines = append(lines, append(head.Points[:len(head.Points):len(head.Points)], head.Points[0]))
+		case tool.HeadCircle:
+			var circle []f32.Point
+			for i := 0; i <= 16; i++ {
+				angle := float64(i) * 2 * math.Pi / 16
+				circle = append(circle, head.Center.Add(f32.Pt(
+					head.Radius*float32(math.Cos(angle)),
+					head.Radius*float32(math.Sin(angle)))))
+			}
+			lines = append(lines, circle)
+		}
+	}
+	return lines
+}
+
+func xoppColor(c color.NRGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x%02x", c.R, c.G, c.B, c.A)
+}
+
+func xoppNum(v float32) string {
+	return strconv.FormatFloat(float64(v), 'f', -1, 32)
+}
@@ -7,23 +7,6 @@ import (
 	"screenpengo/internal/tool"
 )
 
-const (
-	keyRed    = "R"
-	keyGreen  = "G"
-	keyBlue   = "B"
-	keyYellow = "Y"
-	keyOrange = "O"
-	keyPink   = "P"
-	keyBlur   = "X"
-	keyEraser = "E"
-	keyThin   = "1"
-	keyMedium = "2"
-	keyThick  = "3"
-	keyDim     = "A"
-	keyClear   = "C"
-	keyHideUI  = "H"
-)
-
 type ActionType int
 
 const (
@@ -34,6 +17,14 @@ const (
 	Clear
 	Quit
 	ToggleUI
+	Save
+	Open
+	New
+	Export
+	Copy
+	Paste
+	Undo
+	Redo
 )
 
 type Action struct {
@@ -42,10 +33,13 @@ type Action struct {
 	WidthPreset tool.WidthPreset
 }
 
-type KeyboardHandler struct{}
+// KeyboardHandler turns key presses into actions through Keymap.
+type KeyboardHandler struct {
+	Keymap *Keymap
+}
 
 func NewKeyboardHandler() *KeyboardHandler {
-	return &KeyboardHandler{}
+	return &KeyboardHandler{Keymap: DefaultKeymap()}
 }
 
 func (h *KeyboardHandler) HandleEvents(gtx layout.Context, keyTag *struct{}) []Action {
@@ -59,7 +53,7 @@ func (h *KeyboardHandler) HandleEvents(gtx layout.Context, keyTag *struct{}) []A
 	}
 
 	for {
-		ev, ok := gtx.Event(key.Filter{Focus: keyTag, Name: ""})
+		ev, ok := gtx.Event(key.Filter{Focus: keyTag, Name: "", Optional: bindingModifiers})
 		if !ok {
 			break
 		}
@@ -68,47 +62,10 @@ func (h *KeyboardHandler) HandleEvents(gtx layout.Context, keyTag *struct{}) []A
 			continue
 		}
 
-		if action, ok := h.keyToAction(string(ke.Name)); ok {
+		if action, ok := h.Keymap.Lookup(Binding{Name: ke.Name, Modifiers: ke.Modifiers}); ok {
 			actions = append(actions, action)
 		}
 	}
 
 	return actions
 }
-
-func (h *KeyboardHandler) keyToAction(keyName string) (Action, bool) {
-	switch keyName {
-	case keyRed:
-		return Action{Type: SetColor, ColorPreset: tool.Red}, true
-	case keyGreen:
-		return Action{Type: SetColor, ColorPreset: tool.Green}, true
-	case keyBlue:
-		return Action{Type: SetColor, ColorPreset: tool.Blue}, true
-	case keyYellow:
-		return Action{Type: SetColor, ColorPreset: tool.Yellow}, true
-	case keyOrange:
-		return Action{Type: SetColor, ColorPreset: tool.Orange}, true
-	case keyPink:
-		return Action{Type: SetColor, ColorPreset: tool.Pink}, true
-	case keyBlur:
-		return Action{Type: SetColor, ColorPreset: tool.Blur}, true
-	case keyEraser:
-		return Action{Type: SetColor, ColorPreset: tool.Eraser}, true
-	case keyThin:
-		return Action{Type: SetWidth, WidthPreset: tool.Thin}, true
-	case keyMedium:
-		return Action{Type: SetWidth, WidthPreset: tool.Medium}, true
-	case keyThick:
-		return Action{Type: SetWidth, WidthPreset: tool.Thick}, true
-	case keyDim:
-		return Action{Type: ToggleDim}, true
-	case keyClear:
-		return Action{Type: Clear}, true
-	case keyHideUI:
-		return Action{Type: ToggleUI}, true
-	case string(key.NameEscape):
-		return Action{Type: Quit}, true
-	default:
-		return Action{}, false
-	}
-}
@@ -0,0 +1,401 @@
+package input
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"gioui.org/io/key"
+
+	"screenpengo/internal/tool"
+)
+
+// Binding is a key together with the modifiers held with it.
+type Binding struct {
+	Name      key.Name
+	Modifiers key.Modifiers
+}
+
+// bindingModifiers are the modifiers a binding can use. Any others held
+// with a key are ignored.
+const bindingModifiers = key.ModCtrl | key.ModCommand | key.ModShift | key.ModAlt | key.ModSuper
+
+var modifierNames = []struct {
+	mod   key.Modifiers
+	names []string
+}{
+	{key.ModCtrl, []string{"Ctrl", "Control"}},
+	{key.ModCommand, []string{"Cmd", "Command"}},
+	{key.ModAlt, []string{"Alt", "Option", "Opt"}},
+	{key.ModShift, []string{"Shift"}},
+	{key.ModSuper, []string{"Super", "Win", "Meta"}},
+}
+
+// keyNames spells out the keys whose Gio names are symbols.
+var keyNames = []struct {
+	name  key.Name
+	names []string
+}{
+	{key.NameEscape, []string{"Esc", "Escape"}},
+	{key.NameReturn, []string{"Enter", "Return"}},
+	{key.NameSpace, []string{"Space"}},
+	{key.NameTab, []string{"Tab"}},
+	{key.NameDeleteBackward, []string{"Backspace"}},
+	{key.NameDeleteForward, []string{"Delete", "Del"}},
+	{key.NameHome, []string{"Home"}},
+	{key.NameEnd, []string{"End"}},
+	{key.NamePageUp, []string{"PageUp", "PgUp"}},
+	{key.NamePageDown, []string{"PageDown", "PgDn"}},
+	{key.NameUpArrow, []string{"Up"}},
+	{key.NameDownArrow, []string{"Down"}},
+	{key.NameLeftArrow, []string{"Left"}},
+	{key.NameRightArrow, []string{"Right"}},
+}
+
+// ParseBinding reads a binding such as "R", "Ctrl+Shift+S" or "Alt+F4".
+// Names are case-insensitive. "Mod" is Ctrl, or Cmd on macOS. The plus key
+// is "+", or "Ctrl++" with modifiers.
+func ParseBinding(s string) (Binding, error) {
+	s = strings.TrimSpace(s)
+	var parts []string
+	if mods, ok := strings.CutSuffix(s, "+"); ok && plusIsKey(mods) {
+		if mods = strings.TrimSpace(mods); mods != "" {
+			parts = strings.Split(strings.TrimSuffix(mods, "+"), "+")
+		}
+		parts = append(parts, "+")
+	} else {
+		parts = strings.Split(s, "+")
+	}
+	var b Binding
+	for i, part := range parts {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			return Binding{}, fmt.Errorf("invalid key %q", s)
+		}
+		if i < len(parts)-1 {
+			mod, ok := parseModifier(part)
+			if !ok {
+				return Binding{}, fmt.Errorf("unknown modifier %q in %q", part, s)
+			}
+			b.Modifiers |= mod
+			continue
+		}
+		name, ok := parseKeyName(part)
+		if !ok {
+			return Binding{}, fmt.Errorf("unknown key %q", part)
+		}
+		b.Name = name
+	}
+	return b, nil
+}
+
+// plusIsKey reports whether a "+" that follows before is the plus key rather
+// than a separator with the key missing: it is at the start, or follows
+// another "+".
+func plusIsKey(before string) bool {
+	before = strings.TrimSpace(before)
+	return before == "" || strings.HasSuffix(before, "+")
+}
+
+func parseModifier(s string) (key.Modifiers, bool) {
+	if strings.EqualFold(s, "Mod") {
+		return key.ModShortcut, true
+	}
+	for _, m := range modifierNames {
+		for _, name := range m.names {
+			if strings.EqualFold(s, name) {
+				return m.mod, true
+			}
+		}
+	}
+	return 0, false
+}
+
+func parseKeyName(s string) (key.Name, bool) {
+	for _, k := range keyNames {
+		for _, name := range k.names {
+			if strings.EqualFold(s, name) {
+				return k.name, true
+			}
+		}
+	}
+	if len(s) >= 2 && (s[0] == 'F' || s[0] == 'f') {
+		if n, err := strconv.Atoi(s[1:]); err == nil && n >= 1 && n <= 12 {
+			return key.Name("F" + strconv.Itoa(n)), true
+		}
+	}
+	if utf8.RuneCountInString(s) == 1 {
+		// Gio names letter keys in upper case.
+		return key.Name(strings.ToUpper(s)), true
+	}
+	return "", false
+}
+
+func (b Binding) String() string {
+	var parts []string
+	for _, m := range modifierNames {
+		if b.Modifiers.Contain(m.mod) {
+			parts = append(parts, m.names[0])
+		}
+	}
+	name := string(b.Name)
+	for _, k := range keyNames {
+		if k.name == b.Name {
+			name = k.names[0]
+		}
+	}
+	return strings.Join(append(parts, name), "+")
+}
+
+// actionNames lists the actions by their name in the key bindings file,
+// with their default keys.
+var actionNames = []struct {
+	name     string
+	action   Action
+	defaults []string
+}{
+	{"red", Action{Type: SetColor, ColorPreset: tool.Red}, []string{"R"}},
+	{"green", Action{Type: SetColor, ColorPreset: tool.Green}, []string{"G"}},
+	{"blue", Action{Type: SetColor, ColorPreset: tool.Blue}, []string{"B"}},
+	{"yellow", Action{Type: SetColor, ColorPreset: tool.Yellow}, []string{"Y"}},
+	{"orange", Action{Type: SetColor, ColorPreset: tool.Orange}, []string{"O"}},
+	{"pink", Action{Type: SetColor, ColorPreset: tool.Pink}, []string{"P"}},
+	{"blur", Action{Type: SetColor, ColorPreset: tool.Blur}, []string{"X"}},
+	{"eraser", Action{Type: SetColor, ColorPreset: tool.Eraser}, []string{"E"}},
+	{"thin", Action{Type: SetWidth, WidthPreset: tool.Thin}, []string{"1"}},
+	{"medium", Action{Type: SetWidth, WidthPreset: tool.Medium}, []string{"2"}},
+	{"thick", Action{Type: SetWidth, WidthPreset: tool.Thick}, []string{"3"}},
+	{"dim", Action{Type: ToggleDim}, []string{"A"}},
+	{"clear", Action{Type: Clear}, []string{"C"}},
+	{"hide-ui", Action{Type: ToggleUI}, []string{"H"}},
+	{"quit", Action{Type: Quit}, []string{"Esc"}},
+	{"save", Action{Type: Save}, []string{"Mod+S"}},
+	{"open", Action{Type: Open}, []string{"Mod+O"}},
+	{"new", Action{Type: New}, []string{"Mod+N"}},
+	{"export", Action{Type: Export}, []string{"Mod+E"}},
+	{"copy", Action{Type: Copy}, []string{"Mod+C"}},
+	{"paste", Action{Type: Paste}, []string{"Mod+V"}},
+	{"undo", Action{Type: Undo}, []string{"Mod+Z"}},
+	{"redo", Action{Type: Redo}, []string{"Mod+Shift+Z", "Mod+Y"}},
+}
+
+// Keymap maps key presses to actions.
+type Keymap struct {
+	bindings map[Binding]Action
+}
+
+// DefaultKeymap returns the built-in bindings.
+func DefaultKeymap() *Keymap {
+	k, _ := ParseKeymap(strings.NewReader(""))
+	return k
+}
+
+// Lookup returns the action bound to b.
+func (k *Keymap) Lookup(b Binding) (Action, bool) {
+	b.Modifiers &= bindingModifiers
+	action, ok := k.bindings[b]
+	return action, ok
+}
+
+// KeymapPath returns where the key bindings file is looked for by default.
+func KeymapPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "screenpen", "keys.conf"), nil
+}
+
+// LoadKeymap reads key bindings from path. A missing file gives the
+// defaults without an error. Otherwise see ParseKeymap.
+func LoadKeymap(path string) (*Keymap, []error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return DefaultKeymap(), nil
+	}
+	if err != nil {
+		return DefaultKeymap(), []error{err}
+	}
+	defer f.Close()
+	k, errs := ParseKeymap(f)
+	for i, err := range errs {
+		errs[i] = fmt.Errorf("%s: %w", path, err)
+	}
+	return k, errs
+}
+
+// ParseKeymap reads lines of the form "action = key, key", for example
+// "clear = Ctrl+Shift+C"; lines starting with # are comments. Actions named
+// in the file get exactly the keys listed, or none if the list is empty; the
+// others keep their defaults. Lines with errors are skipped and returned
+// together with any conflicts: a key bound twice in the file stays with the
+// first action, and a key the file gives away is taken from the action it
+// was a default for. quit cannot be left without a key: its keys, from the
+// file or the default Esc, are bound before all others and never given away.
+func ParseKeymap(r io.Reader) (*Keymap, []error) {
+	type entry struct {
+		keys []Binding
+		line int
+	}
+	configured := make(map[string]entry)
+	var errs []error
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		name, value, ok := strings.Cut(text, "=")
+		if !ok {
+			errs = append(errs, fmt.Errorf("line %d: expected \"action = keys\"", line))
+			continue
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !knownAction(name) {
+			errs = append(errs, fmt.Errorf("line %d: unknown action %q", line, name))
+			continue
+		}
+		var keys []Binding
+		valid := true
+		for _, field := range splitKeys(value) {
+			b, err := ParseBinding(field)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("line %d: %w", line, err))
+				valid = false
+				break
+			}
+			keys = append(keys, b)
+		}
+		if !valid {
+			continue
+		}
+		if name == "quit" && len(keys) == 0 {
+			errs = append(errs, fmt.Errorf("line %d: quit needs a key; keeping Esc", line))
+			continue
+		}
+		if previous, ok := configured[name]; ok {
+			errs = append(errs, fmt.Errorf("line %d: %s is already set on line %d; using line %d", line, name, previous.line, line))
+		}
+		configured[name] = entry{keys: keys, line: line}
+	}
+	if err := scanner.Err(); err != nil {
+		errs = append(errs, err)
+	}
+
+	k := &Keymap{bindings: make(map[Binding]Action)}
+	owner := make(map[Binding]string)
+	boundAt := func(name string) string {
+		if e, ok := configured[name]; ok {
+			return fmt.Sprintf("on line %d", e.line)
+		}
+		return "by default"
+	}
+	quit := configured["quit"].keys
+	if quit == nil {
+		quit = defaultKeys("quit")
+	}
+	for _, b := range quit {
+		owner[b] = "quit"
+		k.bindings[b] = actionByName("quit")
+	}
+	// The rest of the file goes next, in file order, so that it wins over
+	// defaults.
+	var names []string
+	for _, a := range actionNames {
+		if _, ok := configured[a.name]; ok && a.name != "quit" {
+			names = append(names, a.name)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return configured[names[i]].line < configured[names[j]].line
+	})
+	for _, name := range names {
+		e := configured[name]
+		for _, b := range e.keys {
+			if other, taken := owner[b]; taken {
+				errs = append(errs, fmt.Errorf("line %d: %s is already bound to %s %s; ignored for %s", e.line, b, other, boundAt(other), name))
+				continue
+			}
+			owner[b] = name
+			k.bindings[b] = actionByName(name)
+		}
+	}
+	for _, a := range actionNames {
+		if _, ok := configured[a.name]; ok || a.name == "quit" {
+			continue
+		}
+		for _, b := range defaultKeys(a.name) {
+			if other, taken := owner[b]; taken {
+				errs = append(errs, fmt.Errorf("line %d: %s now runs %s, so %s loses its default key", configured[other].line, b, other, a.name))
+				continue
+			}
+			owner[b] = a.name
+			k.bindings[b] = a.action
+		}
+	}
+	return k, errs
+}
+
+// splitKeys splits a comma-separated key list, allowing "," and "Ctrl+,"
+// as keys as well as "+" and "Ctrl++".
+func splitKeys(s string) []string {
+	var keys []string
+	start := 0
+	for i := 0; i < len(s); i++ {
+		if s[i] != ',' {
+			continue
+		}
+		prev := strings.TrimSpace(s[start:i])
+		if mods, ok := strings.CutSuffix(prev, "+"); prev == "" || ok && !plusIsKey(mods) {
+			// The comma is the key.
+			continue
+		}
+		keys = append(keys, s[start:i])
+		start = i + 1
+	}
+	if strings.TrimSpace(s[start:]) != "" {
+		keys = append(keys, s[start:])
+	}
+	return keys
+}
+
+// defaultKeys returns the default bindings of the action called name.
+func defaultKeys(name string) []Binding {
+	var keys []Binding
+	for _, a := range actionNames {
+		if a.name != name {
+			continue
+		}
+		for _, field := range a.defaults {
+			b, _ := ParseBinding(field)
+			keys = append(keys, b)
+		}
+	}
+	return keys
+}
+
+func knownAction(name string) bool {
+	for _, a := range actionNames {
+		if a.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func actionByName(name string) Action {
+	for _, a := range actionNames {
+		if a.name == name {
+			return a.action
+		}
+	}
+	return Action{}
+}
@@ -0,0 +1,164 @@
+package input
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"gioui.org/io/key"
+)
+
+func TestParseBinding(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Binding
+		wantErr bool
+	}{
+		{in: "R", want: Binding{Name: "R"}},
+		{in: "r", want: Binding{Name: "R"}},
+		{in: " Ctrl+Shift+S ", want: Binding{Name: "S", Modifiers: key.ModCtrl | key.ModShift}},
+		{in: "alt + f4", want: Binding{Name: "F4", Modifiers: key.ModAlt}},
+		{in: "Mod+Z", want: Binding{Name: "Z", Modifiers: key.ModShortcut}},
+		{in: "Esc", want: Binding{Name: key.NameEscape}},
+		{in: "PgDn", want: Binding{Name: key.NamePageDown}},
+		{in: "+", want: Binding{Name: "+"}},
+		{in: "Ctrl++", want: Binding{Name: "+", Modifiers: key.ModCtrl}},
+		{in: "Ctrl+Shift+ +", want: Binding{Name: "+", Modifiers: key.ModCtrl | key.ModShift}},
+		{in: "Ctrl+,", want: Binding{Name: ",", Modifiers: key.ModCtrl}},
+		{in: "", wantErr: true},
+		{in: "Ctrl+", wantErr: true},
+		{in: "++", wantErr: true},
+		{in: "Hyper+R", wantErr: true},
+		{in: "F13", wantErr: true},
+		{in: "Banana", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseBinding(tt.in)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("got %+v, want an error", got)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("got %+v, %v, want %+v", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitKeys(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"", nil},
+		{"R", []string{"R"}},
+		{" R, Ctrl+1 ", []string{" R", " Ctrl+1 "}},
+		{",", []string{","}},
+		{",, R", []string{",", " R"}},
+		{"Ctrl+,, R", []string{"Ctrl+,", " R"}},
+		{"+", []string{"+"}},
+		{"+, R", []string{"+", " R"}},
+		{"Ctrl++, ,", []string{"Ctrl++", " ,"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			if got := splitKeys(tt.in); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseKeymap(t *testing.T) {
+	esc := Binding{Name: key.NameEscape}
+	tests := []struct {
+		name string
+		file string
+		// bound maps keys to the type of action they run; unbound keys
+		// run nothing.
+		bound   map[Binding]ActionType
+		unbound []Binding
+		errs    int
+	}{
+		{
+			name:  "defaults",
+			bound: map[Binding]ActionType{{Name: "C"}: Clear, esc: Quit, {Name: "Z", Modifiers: key.ModShortcut}: Undo},
+		},
+		{
+			name:    "rebind",
+			file:    "# comment\nclear = Ctrl+Shift+C\ndim =\n",
+			bound:   map[Binding]ActionType{{Name: "C", Modifiers: key.ModCtrl | key.ModShift}: Clear},
+			unbound: []Binding{{Name: "C"}, {Name: "A"}},
+		},
+		{
+			name:    "plus key",
+			file:    "thick = +, Ctrl++\n",
+			bound:   map[Binding]ActionType{{Name: "+"}: SetWidth, {Name: "+", Modifiers: key.ModCtrl}: SetWidth},
+			unbound: []Binding{{Name: "3"}},
+		},
+		{
+			name:  "default given away",
+			file:  "clear = R\n",
+			bound: map[Binding]ActionType{{Name: "R"}: Clear},
+			errs:  1,
+		},
+		{
+			name:  "bound twice",
+			file:  "clear = Q\ndim = Q\n",
+			bound: map[Binding]ActionType{{Name: "Q"}: Clear},
+			errs:  1,
+		},
+		{
+			name:  "unknown names",
+			file:  "frobnicate = Q\nclear = Hyper+C\nno equals sign\n",
+			bound: map[Binding]ActionType{{Name: "C"}: Clear},
+			errs:  3,
+		},
+		{
+			name:  "quit keeps its default",
+			file:  "clear = Esc\n",
+			bound: map[Binding]ActionType{esc: Quit},
+			errs:  1,
+		},
+		{
+			name:    "quit keeps its key",
+			file:    "quit = Q\nclear = Q\n",
+			bound:   map[Binding]ActionType{{Name: "Q"}: Quit},
+			unbound: []Binding{{Name: "C"}},
+			errs:    1,
+		},
+		{
+			name:  "quit bound later in the file",
+			file:  "clear = Q\nquit = Q\n",
+			bound: map[Binding]ActionType{{Name: "Q"}: Quit},
+			errs:  1,
+		},
+		{
+			name:  "quit without keys",
+			file:  "quit =\n",
+			bound: map[Binding]ActionType{esc: Quit},
+			errs:  1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k, errs := ParseKeymap(strings.NewReader(tt.file))
+			if len(errs) != tt.errs {
+				t.Errorf("got errors %v, want %d", errs, tt.errs)
+			}
+			for b, want := range tt.bound {
+				if action, ok := k.Lookup(b); !ok || action.Type != want {
+					t.Errorf("%s runs %+v, %v, want type %v", b, action, ok, want)
+				}
+			}
+			for _, b := range tt.unbound {
+				if action, ok := k.Lookup(b); ok {
+					t.Errorf("%s runs %+v, want nothing", b, action)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,214 @@
+package render
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"gioui.org/f32"
+
+	"screenpengo/internal/canvas"
+	"screenpengo/internal/tool"
+)
+
+// painter collects the stamps of one element between begin and end and fills
+// them as a single shape, so overlapping stamps of a translucent element do
+// not add up.
+type painter interface {
+	begin(col color.NRGBA)
+	ellipse(rect image.Rectangle)
+	polygon(points []f32.Point)
+	end()
+}
+
+func drawCanvas(p painter, c *canvas.Canvas) {
+	for i := range c.Strokes {
+		drawStroke(p, &c.Strokes[i])
+	}
+
+	if c.Current != nil {
+		drawStroke(p, c.Current)
+	}
+
+	for i := range c.Shapes {
+		drawShape(p, &c.Shapes[i])
+	}
+
+	if c.CurrentShape != nil {
+		drawShape(p, c.CurrentShape)
+	}
+}
+
+func drawShape(p painter, s *canvas.Shape) {
+	strokeWidth := int(math.Max(2, float64(s.WidthPx)))
+
+	p.begin(s.Color)
+	defer p.end()
+
+	if len(s.Dash) > 0 {
+		drawDashedShape(p, s, strokeWidth)
+		return
+	}
+
+	switch s.Type {
+	case tool.Circle:
+		drawCircleShape(p, s, strokeWidth)
+	case tool.Rectangle:
+		drawRectangleShape(p, s, strokeWidth)
+	case tool.Line:
+		drawLineShape(p, s, strokeWidth)
+	case tool.Arrow:
+		drawArrowShape(p, s, strokeWidth)
+	}
+}
+
+func drawCircleShape(p painter, s *canvas.Shape, strokeWidth int) {
+	dx := s.EndPos.X - s.StartPos.X
+	dy := s.EndPos.Y - s.StartPos.Y
+	radius := float64(math.Sqrt(float64(dx*dx + dy*dy)))
+
+	if radius < 1 {
+		return
+	}
+
+	centerX := s.StartPos.X
+	centerY := s.StartPos.Y
+
+	numPoints := int(math.Max(32, radius*2))
+	circleRadius := int(math.Max(1, float64(strokeWidth/2)))
+
+	for i := 0; i < numPoints; i++ {
+		angle := float64(i) * 2.0 * math.Pi / float64(numPoints)
+		x := int(centerX + float32(radius*math.Cos(angle)))
+		y := int(centerY + float32(radius*math.Sin(angle)))
+
+		rect := image.Rect(x-circleRadius, y-circleRadius, x+circleRadius, y+circleRadius)
+		p.ellipse(rect)
+	}
+}
+
+func drawRectangleShape(p painter, s *canvas.Shape, strokeWidth int) {
+	x1, y1 := int(s.StartPos.X), int(s.StartPos.Y)
+	x2, y2 := int(s.EndPos.X), int(s.EndPos.Y)
+
+	if x2 < x1 {
+		x1, x2 = x2, x1
+	}
+	if y2 < y1 {
+		y1, y2 = y2, y1
+	}
+
+	drawThickLine(p, image.Pt(x1, y1), image.Pt(x2, y1), strokeWidth)
+	drawThickLine(p, image.Pt(x2, y1), image.Pt(x2, y2), strokeWidth)
+	drawThickLine(p, image.Pt(x2, y2), image.Pt(x1, y2), strokeWidth)
+	drawThickLine(p, image.Pt(x1, y2), image.Pt(x1, y1), strokeWidth)
+}
+
+func drawLineShape(p painter, s *canvas.Shape, strokeWidth int) {
+	drawThickLine(p, image.Pt(int(s.StartPos.X), int(s.StartPos.Y)),
+		image.Pt(int(s.EndPos.X), int(s.EndPos.Y)), strokeWidth)
+}
+
+func drawArrowShape(p painter, s *canvas.Shape, strokeWidth int) {
+	drawThickLine(p, image.Pt(int(s.StartPos.X), int(s.StartPos.Y)),
+		image.Pt(int(s.EndPos.X), int(s.EndPos.Y)), strokeWidth)
+	drawArrowWings(p, s, strokeWidth)
+}
+
+func drawArrowWings(p painter, s *canvas.Shape, strokeWidth int) {
+	for _, head := range s.ArrowHeads() {
+		switch head.Style {
+		case tool.HeadCircle:
+			r := int(math.Max(1, float64(head.Radius)))
+			x, y := int(head.Center.X), int(head.Center.Y)
+			p.ellipse(image.Rect(x-r, y-r, x+r, y+r))
+		case tool.HeadFilled, tool.HeadDiamond:
+			p.polygon(head.Points)
+			closed := append(append([]f32.Point{}, head.Points...), head.Points[0])
+			drawPolyline(p, closed, strokeWidth)
+		default:
+			drawPolyline(p, head.Points, strokeWidth)
+		}
+	}
+}
+
+func drawDashedShape(p painter, s *canvas.Shape, strokeWidth int) {
+	for _, outline := range s.Outline() {
+		for _, run := range canvas.DashPolyline(outline, s.Dash) {
+			drawPolyline(p, run, strokeWidth)
+		}
+	}
+	if s.Type == tool.Arrow {
+		drawArrowWings(p, s, strokeWidth)
+	}
+}
+
+func drawPolyline(p painter, points []f32.Point, thickness int) {
+	if len(points) == 1 {
+		radius := int(math.Max(1, float64(thickness/2)))
+		x, y := int(points[0].X), int(points[0].Y)
+		p.ellipse(image.Rect(x-radius, y-radius, x+radius, y+radius))
+		return
+	}
+	for i := 1; i < len(points); i++ {
+		drawThickLine(p, image.Pt(int(points[i-1].X), int(points[i-1].Y)),
+			image.Pt(int(points[i].X), int(points[i].Y)), thickness)
+	}
+}
+
+func drawThickLine(p painter, start, end image.Point, thickness int) {
+	radius := int(math.Max(1, float64(thickness/2)))
+
+	dx := float64(end.X - start.X)
+	dy := float64(end.Y - start.Y)
+	length := math.Sqrt(dx*dx + dy*dy)
+	steps := int(math.Max(2, length/float64(radius)))
+
+	for i := 0; i <= steps; i++ {
+		t := float64(i) / float64(steps)
+		x := int(float64(start.X)*(1-t) + float64(end.X)*t)
+		y := int(float64(start.Y)*(1-t) + float64(end.Y)*t)
+
+		rect := image.Rect(x-radius, y-radius, x+radius, y+radius)
+		p.ellipse(rect)
+	}
+}
+
+func drawStroke(p painter, s *canvas.Stroke) {
+	if len(s.Points) == 0 {
+		return
+	}
+
+	p.begin(s.Color)
+	defer p.end()
+
+	if len(s.Dash) > 0 {
+		for _, run := range canvas.DashPolyline(s.Points, s.Dash) {
+			drawPolyline(p, run, int(s.Width))
+		}
+		return
+	}
+	for i, pt := range s.Points {
+		radius := int(math.Max(1, float64(s.WidthAt(i)/2)))
+		rect := image.Rect(int(pt.X)-radius, int(pt.Y)-radius, int(pt.X)+radius, int(pt.Y)+radius)
+		p.ellipse(rect)
+	}
+}
+
+// clockwise returns the polygon wound the same way as the stamped circles
+// (clockwise on screen), reversing a copy if needed.
+func clockwise(points []f32.Point) []f32.Point {
+	var area float32
+	for i := range points {
+		a, b := points[i], points[(i+1)%len(points)]
+		area += a.X*b.Y - b.X*a.Y
+	}
+	if area >= 0 {
+		return points
+	}
+	reversed := make([]f32.Point, len(points))
+	for i, pt := range points {
+		reversed[len(points)-1-i] = pt
+	}
+	return reversed
+}
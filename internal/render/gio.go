@@ -5,177 +5,125 @@ import (
 	"image/color"
 	"math"
 
+	"gioui.org/f32"
+	"gioui.org/font"
 	"gioui.org/layout"
 	"gioui.org/op"
 	"gioui.org/op/clip"
 	"gioui.org/op/paint"
+	"gioui.org/text"
+	"gioui.org/unit"
+	"gioui.org/widget"
 
 	"screenpengo/internal/canvas"
-	"screenpengo/internal/tool"
 )
 
-type GioRenderer struct {
-	Dim bool
+type opsPainter struct {
+	ops  *op.Ops
+	path clip.Path
+	col  color.NRGBA
 }
 
-func (r *GioRenderer) RenderFrame(gtx layout.Context, c *canvas.Canvas, cursorPos image.Point, cursorRadius int, showCursor bool) {
-	paint.FillShape(gtx.Ops, color.NRGBA{A: 0}, clip.Rect{Max: gtx.Constraints.Max}.Op())
-
-	if r.Dim {
-		paint.FillShape(gtx.Ops, color.NRGBA{A: 120}, clip.Rect{Max: gtx.Constraints.Max}.Op())
-	}
-
-	for i := range c.Strokes {
-		r.renderStroke(gtx.Ops, &c.Strokes[i])
-	}
-
-	if c.Current != nil {
-		r.renderStroke(gtx.Ops, c.Current)
-	}
+func (p *opsPainter) begin(col color.NRGBA) {
+	p.col = col
+	p.path.Begin(p.ops)
+}
 
-	for i := range c.Shapes {
-		r.renderShape(gtx.Ops, &c.Shapes[i])
-	}
+func (p *opsPainter) ellipse(rect image.Rectangle) {
+	// Same construction as clip.Ellipse, so all circles wind clockwise and
+	// union under the non-zero rule.
+	const q = 4 * (math.Sqrt2 - 1) / 3
+
+	center := f32.Pt(float32(rect.Min.X+rect.Max.X)/2, float32(rect.Min.Y+rect.Max.Y)/2)
+	r := float32(rect.Dx()) / 2
+	curve := r * q
+	top := f32.Pt(center.X, center.Y-r)
+
+	p.path.MoveTo(top)
+	p.path.CubeTo(f32.Pt(center.X+curve, center.Y-r), f32.Pt(center.X+r, center.Y-curve), f32.Pt(center.X+r, center.Y))
+	p.path.CubeTo(f32.Pt(center.X+r, center.Y+curve), f32.Pt(center.X+curve, center.Y+r), f32.Pt(center.X, center.Y+r))
+	p.path.CubeTo(f32.Pt(center.X-curve, center.Y+r), f32.Pt(center.X-r, center.Y+curve), f32.Pt(center.X-r, center.Y))
+	p.path.CubeTo(f32.Pt(center.X-r, center.Y-curve), f32.Pt(center.X-curve, center.Y-r), top)
+	p.path.Close()
+}
 
-	if c.CurrentShape != nil {
-		r.renderShape(gtx.Ops, c.CurrentShape)
+func (p *opsPainter) polygon(points []f32.Point) {
+	if len(points) < 3 {
+		return
 	}
-
-	if showCursor && cursorRadius > 0 {
-		r.renderCursor(gtx.Ops, cursorPos, cursorRadius)
+	points = clockwise(points)
+	p.path.MoveTo(points[0])
+	for _, pt := range points[1:] {
+		p.path.LineTo(pt)
 	}
+	p.path.Close()
 }
 
-func (r *GioRenderer) renderCursor(ops *op.Ops, pos image.Point, radius int) {
-	rect := image.Rect(pos.X-radius, pos.Y-radius, pos.X+radius, pos.Y+radius)
-
-	paint.FillShape(ops, color.NRGBA{R: 0, G: 0, B: 0, A: 150}, clip.Ellipse(rect).Op(ops))
-
-	innerRadius := int(math.Max(1, float64(radius-2)))
-	innerRect := image.Rect(pos.X-innerRadius, pos.Y-innerRadius, pos.X+innerRadius, pos.Y+innerRadius)
-	paint.FillShape(ops, color.NRGBA{A: 0}, clip.Ellipse(innerRect).Op(ops))
+func (p *opsPainter) end() {
+	paint.FillShape(p.ops, p.col, clip.Outline{Path: p.path.End()}.Op())
 }
 
-func (r *GioRenderer) renderShape(ops *op.Ops, s *canvas.Shape) {
-	strokeWidth := int(math.Max(2, float64(s.WidthPx)))
-
-	switch s.Type {
-	case tool.Circle:
-		r.renderCircleShape(ops, s, strokeWidth)
-	case tool.Rectangle:
-		r.renderRectangleShape(ops, s, strokeWidth)
-	case tool.Line:
-		r.renderLineShape(ops, s, strokeWidth)
-	case tool.Arrow:
-		r.renderArrowShape(ops, s, strokeWidth)
-	}
+type GioRenderer struct {
+	Dim bool
+	// Shaper lays out canvas texts. Without one they are not drawn.
+	Shaper *text.Shaper
 }
 
-func (r *GioRenderer) renderCircleShape(ops *op.Ops, s *canvas.Shape, strokeWidth int) {
-	dx := s.EndPos.X - s.StartPos.X
-	dy := s.EndPos.Y - s.StartPos.Y
-	radius := float64(math.Sqrt(float64(dx*dx + dy*dy)))
+// RenderFrame draws the drawing. The active tool draws its cursor and
+// preview on top.
+func (r *GioRenderer) RenderFrame(gtx layout.Context, c *canvas.Canvas) {
+	paint.FillShape(gtx.Ops, color.NRGBA{A: 0}, clip.Rect{Max: gtx.Constraints.Max}.Op())
 
-	if radius < 1 {
-		return
+	if r.Dim {
+		paint.FillShape(gtx.Ops, color.NRGBA{A: 120}, clip.Rect{Max: gtx.Constraints.Max}.Op())
 	}
 
-	centerX := s.StartPos.X
-	centerY := s.StartPos.Y
-
-	numPoints := int(math.Max(32, radius*2))
-	circleRadius := int(math.Max(1, float64(strokeWidth/2)))
-
-	for i := 0; i < numPoints; i++ {
-		angle := float64(i) * 2.0 * math.Pi / float64(numPoints)
-		x := int(centerX + float32(radius*math.Cos(angle)))
-		y := int(centerY + float32(radius*math.Sin(angle)))
-
-		rect := image.Rect(x-circleRadius, y-circleRadius, x+circleRadius, y+circleRadius)
-		paint.FillShape(ops, s.Color, clip.Ellipse(rect).Op(ops))
-	}
+	drawCanvas(&opsPainter{ops: gtx.Ops}, c)
+	r.renderTexts(gtx, c.Texts)
 }
 
-func (r *GioRenderer) renderRectangleShape(ops *op.Ops, s *canvas.Shape, strokeWidth int) {
-	x1, y1 := int(s.StartPos.X), int(s.StartPos.Y)
-	x2, y2 := int(s.EndPos.X), int(s.EndPos.Y)
-
-	if x2 < x1 {
-		x1, x2 = x2, x1
+func (r *GioRenderer) renderTexts(gtx layout.Context, texts []canvas.Text) {
+	if r.Shaper == nil {
+		return
 	}
-	if y2 < y1 {
-		y1, y2 = y2, y1
+	gtx.Constraints = layout.Constraints{Max: image.Pt(math.MaxInt32/2, math.MaxInt32/2)}
+	for i := range texts {
+		t := &texts[i]
+		macro := op.Record(gtx.Ops)
+		paint.ColorOp{Color: t.Color}.Add(gtx.Ops)
+		material := macro.Stop()
+
+		offset := op.Offset(image.Pt(int(t.Pos.X), int(t.Pos.Y))).Push(gtx.Ops)
+		size := unit.Sp(t.Size / max(gtx.Metric.PxPerSp, 1e-3))
+		widget.Label{}.Layout(gtx, r.Shaper, font.Font{Typeface: font.Typeface(t.Font)}, size, t.Text, material)
+		offset.Pop()
 	}
-
-	r.renderThickLine(ops, image.Pt(x1, y1), image.Pt(x2, y1), strokeWidth, s.Color)
-	r.renderThickLine(ops, image.Pt(x2, y1), image.Pt(x2, y2), strokeWidth, s.Color)
-	r.renderThickLine(ops, image.Pt(x2, y2), image.Pt(x1, y2), strokeWidth, s.Color)
-	r.renderThickLine(ops, image.Pt(x1, y2), image.Pt(x1, y1), strokeWidth, s.Color)
 }
 
-func (r *GioRenderer) renderLineShape(ops *op.Ops, s *canvas.Shape, strokeWidth int) {
-	r.renderThickLine(ops, image.Pt(int(s.StartPos.X), int(s.StartPos.Y)),
-		image.Pt(int(s.EndPos.X), int(s.EndPos.Y)), strokeWidth, s.Color)
-}
-
-func (r *GioRenderer) renderArrowShape(ops *op.Ops, s *canvas.Shape, strokeWidth int) {
-	r.renderThickLine(ops, image.Pt(int(s.StartPos.X), int(s.StartPos.Y)),
-		image.Pt(int(s.EndPos.X), int(s.EndPos.Y)), strokeWidth, s.Color)
-
-	dx := s.EndPos.X - s.StartPos.X
-	dy := s.EndPos.Y - s.StartPos.Y
-	length := float32(math.Sqrt(float64(dx*dx + dy*dy)))
-
-	if length < 1 {
+// DrawCursor draws a ring the size of the pen around pos.
+func DrawCursor(ops *op.Ops, pos image.Point, radius int) {
+	if radius <= 0 {
 		return
 	}
+	rect := image.Rect(pos.X-radius, pos.Y-radius, pos.X+radius, pos.Y+radius)
 
-	dirX := dx / length
-	dirY := dy / length
-
-	arrowSize := float32(strokeWidth * 4)
-
-	angle := float32(math.Pi / 6)
-
-	cos1 := float32(math.Cos(float64(angle)))
-	sin1 := float32(math.Sin(float64(angle)))
-	leftX := s.EndPos.X - arrowSize*(dirX*cos1+dirY*sin1)
-	leftY := s.EndPos.Y - arrowSize*(dirY*cos1-dirX*sin1)
-
-	rightX := s.EndPos.X - arrowSize*(dirX*cos1-dirY*sin1)
-	rightY := s.EndPos.Y - arrowSize*(dirY*cos1+dirX*sin1)
-
-	r.renderThickLine(ops, image.Pt(int(s.EndPos.X), int(s.EndPos.Y)),
-		image.Pt(int(leftX), int(leftY)), strokeWidth, s.Color)
-	r.renderThickLine(ops, image.Pt(int(s.EndPos.X), int(s.EndPos.Y)),
-		image.Pt(int(rightX), int(rightY)), strokeWidth, s.Color)
-}
-
-func (r *GioRenderer) renderThickLine(ops *op.Ops, start, end image.Point, thickness int, col color.NRGBA) {
-	radius := int(math.Max(1, float64(thickness/2)))
-
-	dx := float64(end.X - start.X)
-	dy := float64(end.Y - start.Y)
-	length := math.Sqrt(dx*dx + dy*dy)
-	steps := int(math.Max(2, length/float64(radius)))
-
-	for i := 0; i <= steps; i++ {
-		t := float64(i) / float64(steps)
-		x := int(float64(start.X)*(1-t) + float64(end.X)*t)
-		y := int(float64(start.Y)*(1-t) + float64(end.Y)*t)
+	paint.FillShape(ops, color.NRGBA{R: 0, G: 0, B: 0, A: 150}, clip.Ellipse(rect).Op(ops))
 
-		rect := image.Rect(x-radius, y-radius, x+radius, y+radius)
-		paint.FillShape(ops, col, clip.Ellipse(rect).Op(ops))
-	}
+	innerRadius := int(math.Max(1, float64(radius-2)))
+	innerRect := image.Rect(pos.X-innerRadius, pos.Y-innerRadius, pos.X+innerRadius, pos.Y+innerRadius)
+	paint.FillShape(ops, color.NRGBA{A: 0}, clip.Ellipse(innerRect).Op(ops))
 }
 
-func (r *GioRenderer) renderStroke(ops *op.Ops, s *canvas.Stroke) {
-	if len(s.Points) == 0 {
-		return
-	}
-	radius := int(math.Max(1, float64(s.Width/2)))
-	for _, p := range s.Points {
-		rect := image.Rect(int(p.X)-radius, int(p.Y)-radius, int(p.X)+radius, int(p.Y)+radius)
-		paint.FillShape(ops, s.Color, clip.Ellipse(rect).Op(ops))
-	}
+// DrawSelection outlines the box from topLeft to bottomRight, for the
+// element the move tool would grab or is dragging.
+func DrawSelection(ops *op.Ops, topLeft, bottomRight f32.Point) {
+	const pad = 4
+	var path clip.Path
+	path.Begin(ops)
+	path.MoveTo(topLeft.Sub(f32.Pt(pad, pad)))
+	path.LineTo(f32.Pt(bottomRight.X+pad, topLeft.Y-pad))
+	path.LineTo(bottomRight.Add(f32.Pt(pad, pad)))
+	path.LineTo(f32.Pt(topLeft.X-pad, bottomRight.Y+pad))
+	path.Close()
+	paint.FillShape(ops, color.NRGBA{R: 100, G: 180, B: 255, A: 255}, clip.Stroke{Path: path.End(), Width: 2}.Op())
 }
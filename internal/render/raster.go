@@ -0,0 +1,160 @@
+package render
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"gioui.org/f32"
+
+	"screenpengo/internal/canvas"
+)
+
+// imagePainter marks the pixels covered by an element in a mask and blends
+// the element colour over each marked pixel once when the element ends.
+type imagePainter struct {
+	img   *image.NRGBA
+	scale float32
+	mask  []bool
+	dirty image.Rectangle
+	col   color.NRGBA
+}
+
+func newImagePainter(img *image.NRGBA, scale float32) *imagePainter {
+	return &imagePainter{
+		img:   img,
+		scale: scale,
+		mask:  make([]bool, img.Rect.Dx()*img.Rect.Dy()),
+	}
+}
+
+func (p *imagePainter) begin(col color.NRGBA) {
+	p.col = col
+	p.dirty = image.Rectangle{}
+}
+
+func (p *imagePainter) mark(x, y int) {
+	p.mask[(y-p.img.Rect.Min.Y)*p.img.Rect.Dx()+(x-p.img.Rect.Min.X)] = true
+}
+
+func (p *imagePainter) end() {
+	for y := p.dirty.Min.Y; y < p.dirty.Max.Y; y++ {
+		for x := p.dirty.Min.X; x < p.dirty.Max.X; x++ {
+			i := (y-p.img.Rect.Min.Y)*p.img.Rect.Dx() + (x - p.img.Rect.Min.X)
+			if p.mask[i] {
+				p.mask[i] = false
+				blendOver(p.img, x, y, p.col)
+			}
+		}
+	}
+}
+
+func (p *imagePainter) ellipse(rect image.Rectangle) {
+	cx := float64(rect.Min.X+rect.Max.X) / 2 * float64(p.scale)
+	cy := float64(rect.Min.Y+rect.Max.Y) / 2 * float64(p.scale)
+	rx := math.Max(0.5, float64(rect.Dx())/2*float64(p.scale))
+	ry := math.Max(0.5, float64(rect.Dy())/2*float64(p.scale))
+
+	area := image.Rect(
+		int(math.Floor(cx-rx)), int(math.Floor(cy-ry)),
+		int(math.Ceil(cx+rx)), int(math.Ceil(cy+ry)),
+	).Intersect(p.img.Rect)
+	p.dirty = p.dirty.Union(area)
+
+	for y := area.Min.Y; y < area.Max.Y; y++ {
+		fy := (float64(y) + 0.5 - cy) / ry
+		for x := area.Min.X; x < area.Max.X; x++ {
+			fx := (float64(x) + 0.5 - cx) / rx
+			if fx*fx+fy*fy <= 1 {
+				p.mark(x, y)
+			}
+		}
+	}
+}
+
+func (p *imagePainter) polygon(points []f32.Point) {
+	if len(points) < 3 {
+		return
+	}
+
+	scaled := make([]f32.Point, len(points))
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+	for i, pt := range points {
+		scaled[i] = pt.Mul(p.scale)
+		minX = math.Min(minX, float64(scaled[i].X))
+		minY = math.Min(minY, float64(scaled[i].Y))
+		maxX = math.Max(maxX, float64(scaled[i].X))
+		maxY = math.Max(maxY, float64(scaled[i].Y))
+	}
+
+	area := image.Rect(
+		int(math.Floor(minX)), int(math.Floor(minY)),
+		int(math.Ceil(maxX)), int(math.Ceil(maxY)),
+	).Intersect(p.img.Rect)
+	p.dirty = p.dirty.Union(area)
+
+	for y := area.Min.Y; y < area.Max.Y; y++ {
+		for x := area.Min.X; x < area.Max.X; x++ {
+			if insidePolygon(scaled, float32(x)+0.5, float32(y)+0.5) {
+				p.mark(x, y)
+			}
+		}
+	}
+}
+
+func insidePolygon(points []f32.Point, x, y float32) bool {
+	inside := false
+	j := len(points) - 1
+	for i := range points {
+		a, b := points[i], points[j]
+		if (a.Y > y) != (b.Y > y) && x < (b.X-a.X)*(y-a.Y)/(b.Y-a.Y)+a.X {
+			inside = !inside
+		}
+		j = i
+	}
+	return inside
+}
+
+func blendOver(img *image.NRGBA, x, y int, src color.NRGBA) {
+	i := img.PixOffset(x, y)
+	dst := img.Pix[i : i+4 : i+4]
+
+	srcA := float64(src.A) / 255
+	dstA := float64(dst[3]) / 255
+	outA := srcA + dstA*(1-srcA)
+	if outA == 0 {
+		return
+	}
+
+	mix := func(s, d uint8) uint8 {
+		return uint8((float64(s)*srcA+float64(d)*dstA*(1-srcA))/outA + 0.5)
+	}
+	dst[0] = mix(src.R, dst[0])
+	dst[1] = mix(src.G, dst[1])
+	dst[2] = mix(src.B, dst[2])
+	dst[3] = uint8(outA*255 + 0.5)
+}
+
+// Rasterize draws the canvas into a new image using the same stamping
+// algorithm as GioRenderer, so exported frames match what is on screen.
+// width and height are in canvas pixels; the image is scaled by scale.
+func Rasterize(c *canvas.Canvas, width, height int, scale float32, background color.NRGBA) *image.NRGBA {
+	if scale <= 0 {
+		scale = 1
+	}
+	bounds := image.Rect(0, 0, int(float32(width)*scale), int(float32(height)*scale))
+	img := image.NewNRGBA(bounds)
+
+	if background.A != 0 {
+		for i := 0; i < len(img.Pix); i += 4 {
+			img.Pix[i+0] = background.R
+			img.Pix[i+1] = background.G
+			img.Pix[i+2] = background.B
+			img.Pix[i+3] = background.A
+		}
+	}
+
+	drawCanvas(newImagePainter(img, scale), c)
+	return img
+}
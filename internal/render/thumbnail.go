@@ -0,0 +1,44 @@
+package render
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+
+	"screenpengo/internal/canvas"
+)
+
+// Thumbnails are rendered at twice the size they are shown at in the load
+// dialog so they stay sharp on high-density screens.
+const (
+	ThumbnailWidth  = 320
+	ThumbnailHeight = 200
+)
+
+// Thumbnail renders the canvas, drawn on a screen of the given size, into a
+// white ThumbnailWidth×ThumbnailHeight PNG with the drawing centred in it.
+func Thumbnail(c *canvas.Canvas, screenWidth, screenHeight int) ([]byte, error) {
+	if screenWidth <= 0 || screenHeight <= 0 {
+		screenWidth, screenHeight = ThumbnailWidth, ThumbnailHeight
+	}
+	scale := min(float32(ThumbnailWidth)/float32(screenWidth), float32(ThumbnailHeight)/float32(screenHeight))
+	white := color.NRGBA{R: 255, G: 255, B: 255, A: 255}
+	drawing := Rasterize(c, screenWidth, screenHeight, scale, white)
+
+	thumb := image.NewNRGBA(image.Rect(0, 0, ThumbnailWidth, ThumbnailHeight))
+	for i := 0; i < len(thumb.Pix); i += 4 {
+		copy(thumb.Pix[i:i+4], []uint8{white.R, white.G, white.B, white.A})
+	}
+	offset := image.Pt((ThumbnailWidth-drawing.Rect.Dx())/2, (ThumbnailHeight-drawing.Rect.Dy())/2)
+	for y := 0; y < drawing.Rect.Dy(); y++ {
+		src := drawing.Pix[y*drawing.Stride : y*drawing.Stride+drawing.Rect.Dx()*4]
+		copy(thumb.Pix[thumb.PixOffset(offset.X, offset.Y+y):], src)
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, thumb); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,97 @@
+package replay
+
+import (
+	"time"
+
+	"screenpengo/internal/canvas"
+)
+
+var Speeds = []float64{1, 2, 4, 8}
+
+type Player struct {
+	source   *canvas.Canvas
+	duration time.Duration
+	position time.Duration
+	speed    float64
+	playing  bool
+	lastTick time.Time
+}
+
+func NewPlayer(source *canvas.Canvas) *Player {
+	return &Player{
+		source:   source,
+		duration: source.Duration(),
+		speed:    1,
+	}
+}
+
+func (p *Player) Play(now time.Time) {
+	if p.position >= p.duration {
+		p.position = 0
+	}
+	p.playing = true
+	p.lastTick = now
+}
+
+func (p *Player) Pause() {
+	p.playing = false
+}
+
+func (p *Player) TogglePlay(now time.Time) {
+	if p.playing {
+		p.Pause()
+	} else {
+		p.Play(now)
+	}
+}
+
+func (p *Player) SetSpeed(speed float64) {
+	if speed > 0 {
+		p.speed = speed
+	}
+}
+
+func (p *Player) Seek(progress float32) {
+	progress = min(max(progress, 0), 1)
+	p.position = time.Duration(float64(p.duration) * float64(progress))
+}
+
+func (p *Player) Advance(now time.Time) {
+	if !p.playing {
+		return
+	}
+	elapsed := now.Sub(p.lastTick)
+	p.lastTick = now
+	p.position += time.Duration(float64(elapsed) * p.speed)
+	if p.position >= p.duration {
+		p.position = p.duration
+		p.playing = false
+	}
+}
+
+func (p *Player) Frame() *canvas.Canvas {
+	return p.source.Snapshot(p.position)
+}
+
+func (p *Player) Playing() bool {
+	return p.playing
+}
+
+func (p *Player) Speed() float64 {
+	return p.speed
+}
+
+func (p *Player) Position() time.Duration {
+	return p.position
+}
+
+func (p *Player) Duration() time.Duration {
+	return p.duration
+}
+
+func (p *Player) Progress() float32 {
+	if p.duration <= 0 {
+		return 1
+	}
+	return float32(float64(p.position) / float64(p.duration))
+}
@@ -0,0 +1,183 @@
+package session
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"screenpengo/internal/canvas"
+)
+
+// Every running instance has its own marker and recovery file, so that
+// several can run side by side. They are named after an ID made of the
+// process ID and the start time, and the marker holds the process ID.
+// Versions before that used the fixed names below, which are still read
+// after a crash.
+const (
+	recoveryPrefix = "recovery-"
+	recoverySuffix = ".autosave"
+	markerPrefix   = "session-"
+	markerSuffix   = ".lock"
+	legacyRecovery = "recovery.autosave"
+	legacyMarker   = "session.lock"
+)
+
+// Session keeps a recovery copy of the canvas on disk. The marker file exists
+// while the program is running; finding one whose process is gone means that
+// run did not shut down cleanly and its recovery file is worth offering back.
+type Session struct {
+	dir    string
+	id     string
+	writes chan []byte
+	done   chan struct{}
+	last   []byte
+
+	// orphan holds the marker and recovery file of the crashed session
+	// whose drawing Open returned, until Discard removes them.
+	orphan []string
+}
+
+// Open starts a session in dir. If an earlier session crashed, the canvas
+// it autosaved is returned as well. With several crashed sessions the most
+// recent is offered and the others wait for later starts.
+func Open(dir string) (*Session, *canvas.Canvas, error) {
+	s := &Session{
+		dir:    dir,
+		id:     fmt.Sprintf("%d-%d", os.Getpid(), time.Now().UnixNano()),
+		writes: make(chan []byte, 1),
+		done:   make(chan struct{}),
+	}
+
+	var recovered *canvas.Canvas
+	if marker, recovery, ok := s.findCrashed(); ok {
+		data, err := os.ReadFile(recovery)
+		if err == nil {
+			recovered, err = canvas.DecodeDocument(data)
+		}
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			println("Error reading recovery file:", err.Error())
+		}
+		s.orphan = []string{marker, recovery}
+		if recovered == nil {
+			s.Discard()
+		}
+	}
+
+	if err := os.WriteFile(s.path(markerPrefix+s.id+markerSuffix), []byte(strconv.Itoa(os.Getpid())), 0o644); err != nil {
+		return nil, nil, err
+	}
+
+	go s.writer()
+	return s, recovered, nil
+}
+
+func (s *Session) path(name string) string {
+	return filepath.Join(s.dir, name)
+}
+
+// findCrashed looks for markers of processes that are no longer running,
+// and returns the one with the newest recovery file. A marker with our own
+// process ID was left by an earlier process that had it. Process IDs get
+// reused, so a crashed session may be mistaken for a running one; its
+// drawing is then offered on a later start. Markers that cannot be read are
+// left alone.
+func (s *Session) findCrashed() (marker, recovery string, ok bool) {
+	var newest int64
+	consider := func(m, r string) {
+		info, err := os.Stat(r)
+		if err != nil {
+			// Nothing was autosaved; the marker alone is of no use.
+			os.Remove(m)
+			return
+		}
+		if !ok || info.ModTime().UnixNano() > newest {
+			marker, recovery, ok = m, r, true
+			newest = info.ModTime().UnixNano()
+		}
+	}
+
+	if _, err := os.Stat(s.path(legacyMarker)); err == nil {
+		consider(s.path(legacyMarker), s.path(legacyRecovery))
+	}
+	markers, _ := filepath.Glob(s.path(markerPrefix + "*" + markerSuffix))
+	for _, m := range markers {
+		data, err := os.ReadFile(m)
+		if err != nil {
+			continue
+		}
+		pid, err := strconv.Atoi(string(data))
+		if err != nil || pid != os.Getpid() && processAlive(pid) {
+			continue
+		}
+		id := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(m), markerPrefix), markerSuffix)
+		consider(m, s.path(recoveryPrefix+id+recoverySuffix))
+	}
+	return marker, recovery, ok
+}
+
+// writer runs in the background so that disk I/O never stalls a frame.
+func (s *Session) writer() {
+	defer close(s.done)
+	for data := range s.writes {
+		if err := canvas.WriteFileAtomic(s.path(recoveryPrefix+s.id+recoverySuffix), data); err != nil {
+			println("Error writing recovery file:", err.Error())
+		}
+	}
+}
+
+// queue replaces any write the background goroutine has not picked up yet,
+// since only the latest state matters.
+func (s *Session) queue(data []byte) {
+	select {
+	case s.writes <- data:
+	default:
+		select {
+		case <-s.writes:
+		default:
+		}
+		s.writes <- data
+	}
+}
+
+// Autosave encodes c on the calling goroutine, so the canvas is never shared
+// with the writer, and queues it for writing if it changed since last time.
+// It goes to this session's own file, so it is safe while a recovered
+// drawing is still on offer.
+func (s *Session) Autosave(c *canvas.Canvas) {
+	data, err := canvas.EncodeDocument(c)
+	if err != nil {
+		println("Error autosaving:", err.Error())
+		return
+	}
+	if bytes.Equal(data, s.last) {
+		return
+	}
+	s.last = data
+	s.queue(data)
+}
+
+// Discard removes the files of the crashed session that Open offered back,
+// once its drawing was restored or turned down.
+func (s *Session) Discard() {
+	for _, path := range s.orphan {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			println("Error removing recovery file:", err.Error())
+		}
+	}
+	s.orphan = nil
+}
+
+// Close marks the session as cleanly finished. Pending writes are flushed
+// first so they cannot recreate the recovery file afterwards. A crashed
+// session that is still on offer stays for the next start.
+func (s *Session) Close() {
+	close(s.writes)
+	<-s.done
+	os.Remove(s.path(recoveryPrefix + s.id + recoverySuffix))
+	os.Remove(s.path(markerPrefix + s.id + markerSuffix))
+}
@@ -0,0 +1,83 @@
+package session
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"gioui.org/f32"
+
+	"screenpengo/internal/canvas"
+)
+
+// deadPID is far above any PID a system hands out.
+const deadPID = 1 << 30
+
+func writeSession(t *testing.T, dir, id string, pid int, title string) {
+	t.Helper()
+	c := &canvas.Canvas{Meta: canvas.Metadata{Title: title}}
+	c.Strokes = []canvas.Stroke{{Points: []f32.Point{f32.Pt(1, 1)}, Width: 1}}
+	data, err := canvas.EncodeDocument(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, recoveryPrefix+id+recoverySuffix), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, markerPrefix+id+markerSuffix), []byte(strconv.Itoa(pid)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOpenLeavesRunningSessionsAlone(t *testing.T) {
+	dir := t.TempDir()
+	writeSession(t, dir, "running", os.Getppid(), "running")
+
+	s, recovered, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if recovered != nil {
+		t.Errorf("offered the drawing of a running session")
+	}
+	s.Discard()
+	if _, err := os.Stat(filepath.Join(dir, recoveryPrefix+"running"+recoverySuffix)); err != nil {
+		t.Errorf("recovery file of a running session is gone: %v", err)
+	}
+}
+
+func TestOpenRecoversCrashedSession(t *testing.T) {
+	dir := t.TempDir()
+	writeSession(t, dir, "crashed", deadPID, "crashed")
+
+	s, recovered, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recovered == nil || recovered.Meta.Title != "crashed" {
+		t.Fatalf("recovered %+v, want the crashed drawing", recovered)
+	}
+
+	// Autosaving while the offer is open must not touch the crashed files.
+	s.Autosave(&canvas.Canvas{Strokes: []canvas.Stroke{{Points: []f32.Point{f32.Pt(2, 2)}, Width: 1}}})
+	s.Close()
+	if _, err := os.Stat(filepath.Join(dir, recoveryPrefix+"crashed"+recoverySuffix)); err != nil {
+		t.Fatalf("crashed recovery file lost before Discard: %v", err)
+	}
+
+	s, recovered, err = Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recovered == nil {
+		t.Fatal("crashed drawing no longer offered after a clean exit")
+	}
+	s.Discard()
+	s.Close()
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 0 {
+		t.Errorf("files left after Discard and Close: %v", entries)
+	}
+}
@@ -0,0 +1,91 @@
+package tool
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+type DashStyle int
+
+const (
+	Solid DashStyle = iota
+	Dashed
+	Dotted
+	DashDot
+	CustomDash
+)
+
+var DashStyles = []DashStyle{Solid, Dashed, Dotted, DashDot, CustomDash}
+
+// MinDashPeriodPx is the shortest repeat of a dash pattern, in pixels, that
+// can be drawn. Shorter ones would not move along the line at all in float32.
+const MinDashPeriodPx = 0.5
+
+// MinWidthDp is the thinnest pen.
+const MinWidthDp = 2
+
+func (d DashStyle) String() string {
+	switch d {
+	case Dashed:
+		return "Dashed"
+	case Dotted:
+		return "Dotted"
+	case DashDot:
+		return "Dash-dot"
+	case CustomDash:
+		return "Custom"
+	default:
+		return "Solid"
+	}
+}
+
+// Pattern returns alternating on/off lengths in multiples of the line width.
+// Lines have round caps, so every "on" segment grows by one width and a zero
+// length segment is drawn as a dot; the gaps below account for that.
+func (d DashStyle) Pattern() []float32 {
+	switch d {
+	case Dashed:
+		return []float32{2, 3}
+	case Dotted:
+		return []float32{0, 2}
+	case DashDot:
+		return []float32{3, 2.5, 0, 2.5}
+	default:
+		return nil
+	}
+}
+
+func ParseDashPattern(text string) ([]float32, error) {
+	fields := strings.FieldsFunc(text, func(r rune) bool {
+		return r == ' ' || r == ',' || r == '\t'
+	})
+	if len(fields) == 0 {
+		return nil, nil
+	}
+
+	pattern := make([]float32, 0, len(fields))
+	var total float32
+	for _, field := range fields {
+		v, err := strconv.ParseFloat(field, 32)
+		if err != nil {
+			return nil, errors.New("dash pattern must be a list of numbers")
+		}
+		if v < 0 {
+			return nil, errors.New("dash lengths cannot be negative")
+		}
+		pattern = append(pattern, float32(v))
+		total += float32(v)
+	}
+	if total == 0 {
+		return nil, errors.New("dash pattern cannot be all zeros")
+	}
+	// Checked for the thinnest pen at one pixel per dp.
+	if total*MinWidthDp < MinDashPeriodPx {
+		return nil, errors.New("dash pattern is too short")
+	}
+	if len(pattern)%2 == 1 {
+		pattern = append(pattern, pattern...)
+	}
+	return pattern, nil
+}
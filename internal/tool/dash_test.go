@@ -0,0 +1,49 @@
+package tool
+
+import "testing"
+
+func TestParseDashPattern(t *testing.T) {
+	tests := []struct {
+		text    string
+		want    []float32
+		wantErr bool
+	}{
+		{"", nil, false},
+		{"4 2", []float32{4, 2}, false},
+		{"4, 2,\t1 2", []float32{4, 2, 1, 2}, false},
+		{"3", []float32{3, 3}, false},
+		{"0 2", []float32{0, 2}, false},
+		{"0 0", nil, true},
+		{"-1 2", nil, true},
+		{"a b", nil, true},
+		{"0 1e-8", nil, true},
+		{"0.1 0.1", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseDashPattern(tt.text)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseDashPattern(%q): error %v, want error %v", tt.text, err, tt.wantErr)
+			continue
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("ParseDashPattern(%q) = %v, want %v", tt.text, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("ParseDashPattern(%q) = %v, want %v", tt.text, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestDashPatternTooFine(t *testing.T) {
+	pen := PenConfig{Dash: CustomDash, CustomDash: []float32{0, 0.3}}
+	if got := pen.DashPattern(1); got != nil {
+		t.Errorf("DashPattern(1) = %v, want a solid line", got)
+	}
+	if got := pen.DashPattern(10); len(got) != 2 || got[1] != 3 {
+		t.Errorf("DashPattern(10) = %v, want [0 3]", got)
+	}
+}
@@ -12,7 +12,10 @@ const (
 	Orange
 	Pink
 	Blur
+	// Eraser is not a colour of the pen but picks the eraser tool.
 	Eraser
+	// CustomColor is any colour set on the sliders.
+	CustomColor
 )
 
 type WidthPreset int
@@ -21,6 +24,7 @@ const (
 	Thin WidthPreset = iota
 	Medium
 	Thick
+	CustomWidth
 )
 
 type PenConfig struct {
@@ -28,6 +32,29 @@ type PenConfig struct {
 	WidthDp     float32
 	ColorPreset ColorPreset
 	WidthPreset WidthPreset
+	Dash        DashStyle
+	CustomDash  []float32
+}
+
+func (p *PenConfig) DashPattern(widthPx float32) []float32 {
+	relative := p.Dash.Pattern()
+	if p.Dash == CustomDash {
+		relative = p.CustomDash
+	}
+	if len(relative) == 0 {
+		return nil
+	}
+
+	pattern := make([]float32, len(relative))
+	var total float32
+	for i, v := range relative {
+		pattern[i] = v * widthPx
+		total += pattern[i]
+	}
+	if total < MinDashPeriodPx {
+		return nil
+	}
+	return pattern
 }
 
 func (p *PenConfig) SetColor(preset ColorPreset) {
@@ -49,8 +76,6 @@ func (p *PenConfig) SetColor(preset ColorPreset) {
 		p.Color = color.NRGBA{A: 0x40}
 		p.WidthDp = 20
 		p.WidthPreset = Thick
-	case Eraser:
-		p.Color = color.NRGBA{R: 255, G: 255, B: 255, A: 255}
 	}
 }
 
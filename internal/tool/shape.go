@@ -11,6 +11,65 @@ const (
 )
 
 type ShapeConfig struct {
-	Type   ShapeType
-	Active bool
+	Type  ShapeType
+	Arrow ArrowStyle
+}
+
+type ArrowHead int
+
+const (
+	HeadNone ArrowHead = iota
+	HeadOpen
+	HeadFilled
+	HeadCircle
+	HeadBar
+	HeadDiamond
+)
+
+var ArrowHeads = []ArrowHead{HeadNone, HeadOpen, HeadFilled, HeadCircle, HeadBar, HeadDiamond}
+
+func (h ArrowHead) String() string {
+	switch h {
+	case HeadOpen:
+		return "Open"
+	case HeadFilled:
+		return "Triangle"
+	case HeadCircle:
+		return "Circle"
+	case HeadBar:
+		return "Bar"
+	case HeadDiamond:
+		return "Diamond"
+	default:
+		return "None"
+	}
+}
+
+func (h ArrowHead) Filled() bool {
+	return h == HeadFilled || h == HeadCircle || h == HeadDiamond
+}
+
+// ArrowStyle describes both ends of an arrow. Size is in multiples of the
+// line width and Angle is the half-angle of the head in degrees.
+type ArrowStyle struct {
+	Start ArrowHead
+	End   ArrowHead
+	Size  float32
+	Angle float32
+}
+
+var DefaultArrowStyle = ArrowStyle{
+	Start: HeadNone,
+	End:   HeadOpen,
+	Size:  4,
+	Angle: 30,
+}
+
+// OrDefault returns the default style for arrows saved before head styles
+// existed, which have a zero size.
+func (a ArrowStyle) OrDefault() ArrowStyle {
+	if a.Size <= 0 {
+		return DefaultArrowStyle
+	}
+	return a
 }
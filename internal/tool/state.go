@@ -0,0 +1,101 @@
+package tool
+
+import "image/color"
+
+// Names of the built-in tools, as used in State.Tool. More can be added
+// through the editor package.
+const (
+	PenTool    = "pen"
+	EraserTool = "eraser"
+	ShapeTool  = "shape"
+	MoveTool   = "move"
+)
+
+// State is the active tool with its settings. The toolbar and the keyboard
+// both change it through the methods below and the toolbar shows it, so the
+// two always agree.
+type State struct {
+	// Tool names the tool the pointer works with.
+	Tool  string
+	Pen   PenConfig
+	Shape ShapeConfig
+
+	// previous is the tool to go back to when a toggled tool is put down.
+	previous string
+}
+
+func NewState() *State {
+	s := &State{
+		Tool:  PenTool,
+		Shape: ShapeConfig{Type: NoShape, Arrow: DefaultArrowStyle},
+	}
+	s.Pen.SetColor(Red)
+	s.Pen.SetWidth(Medium)
+	return s
+}
+
+func (s *State) Erasing() bool {
+	return s.Tool == EraserTool
+}
+
+// Select makes name the active tool.
+func (s *State) Select(name string) {
+	if name != s.Tool {
+		s.previous = s.Tool
+	}
+	s.Tool = name
+}
+
+// Toggle takes up tool name, or puts it down and goes back to the tool used
+// before.
+func (s *State) Toggle(name string) {
+	if s.Tool != name {
+		s.Select(name)
+		return
+	}
+	back := s.previous
+	if back == "" || back == name {
+		back = PenTool
+	}
+	s.Select(back)
+}
+
+// SetColor picks a preset colour. Eraser selects the eraser instead; any
+// other colour puts it down.
+func (s *State) SetColor(preset ColorPreset) {
+	if preset == Eraser {
+		s.Select(EraserTool)
+		return
+	}
+	s.Pen.SetColor(preset)
+	s.putDownEraser()
+}
+
+func (s *State) SetWidth(preset WidthPreset) {
+	s.Pen.SetWidth(preset)
+}
+
+// SetCustomColor sets a colour picked on the sliders.
+func (s *State) SetCustomColor(c color.NRGBA) {
+	s.Pen.Color = c
+	s.Pen.ColorPreset = CustomColor
+	s.putDownEraser()
+}
+
+// SetCustomWidth sets a width picked on the slider.
+func (s *State) SetCustomWidth(widthDp float32) {
+	s.Pen.WidthDp = widthDp
+	s.Pen.WidthPreset = CustomWidth
+}
+
+// SelectShape switches to drawing shapes of type t.
+func (s *State) SelectShape(t ShapeType) {
+	s.Shape.Type = t
+	s.Select(ShapeTool)
+}
+
+func (s *State) putDownEraser() {
+	if s.Erasing() {
+		s.Toggle(EraserTool)
+	}
+}
@@ -0,0 +1,93 @@
+package ui
+
+import (
+	"fmt"
+	"image/color"
+
+	"gioui.org/layout"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+
+	"screenpengo/internal/tool"
+)
+
+const (
+	minHeadSize  = 2
+	maxHeadSize  = 10
+	minHeadAngle = 10
+	maxHeadAngle = 60
+)
+
+type arrowControls struct {
+	startButton widget.Clickable
+	endButton   widget.Clickable
+	sizeSlider  widget.Float
+	angleSlider widget.Float
+}
+
+func newArrowControls(style tool.ArrowStyle) arrowControls {
+	return arrowControls{
+		sizeSlider:  widget.Float{Value: (style.Size - minHeadSize) / (maxHeadSize - minHeadSize)},
+		angleSlider: widget.Float{Value: (style.Angle - minHeadAngle) / (maxHeadAngle - minHeadAngle)},
+	}
+}
+
+func nextArrowHead(h tool.ArrowHead) tool.ArrowHead {
+	return tool.ArrowHeads[(int(h)+1)%len(tool.ArrowHeads)]
+}
+
+func (t *Toolbar) handleArrowEvents(gtx layout.Context) {
+	ac := &t.arrow
+	style := &t.state.Shape.Arrow
+
+	if ac.startButton.Clicked(gtx) {
+		style.Start = nextArrowHead(style.Start)
+	}
+	if ac.endButton.Clicked(gtx) {
+		style.End = nextArrowHead(style.End)
+	}
+	if ac.sizeSlider.Update(gtx) {
+		style.Size = minHeadSize + ac.sizeSlider.Value*(maxHeadSize-minHeadSize)
+	}
+	if ac.angleSlider.Update(gtx) {
+		style.Angle = minHeadAngle + ac.angleSlider.Value*(maxHeadAngle-minHeadAngle)
+	}
+}
+
+func (t *Toolbar) layoutArrowOptions(gtx layout.Context) layout.Dimensions {
+	ac := &t.arrow
+	style := t.state.Shape.Arrow
+	headButton := func(clickable *widget.Clickable, label string) layout.FlexChild {
+		return layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			btn := material.Button(t.theme, clickable, label)
+			btn.Background = color.NRGBA{R: 100, G: 100, B: 100, A: 200}
+			return btn.Layout(gtx)
+		})
+	}
+	slider := func(value *widget.Float) layout.FlexChild {
+		return layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			gtx.Constraints.Min.X = gtx.Dp(150)
+			gtx.Constraints.Max.X = gtx.Dp(150)
+			return material.Slider(t.theme, value).Layout(gtx)
+		})
+	}
+
+	return layout.Flex{Axis: layout.Vertical, Spacing: layout.SpaceStart}.Layout(gtx,
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			return material.Body1(t.theme, "Arrow heads").Layout(gtx)
+		}),
+		layout.Rigid(layout.Spacer{Height: 5}.Layout),
+		headButton(&ac.startButton, "Start: "+style.Start.String()),
+		layout.Rigid(layout.Spacer{Height: 5}.Layout),
+		headButton(&ac.endButton, "End: "+style.End.String()),
+		layout.Rigid(layout.Spacer{Height: 5}.Layout),
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			return material.Body2(t.theme, fmt.Sprintf("Size: %.1f× width", style.Size)).Layout(gtx)
+		}),
+		slider(&ac.sizeSlider),
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			return material.Body2(t.theme, fmt.Sprintf("Angle: %.0f°", style.Angle)).Layout(gtx)
+		}),
+		slider(&ac.angleSlider),
+	)
+}
@@ -0,0 +1,813 @@
+package ui
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gioui.org/io/event"
+	"gioui.org/io/key"
+	"gioui.org/layout"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+	"gioui.org/unit"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+
+	"screenpengo/internal/canvas"
+	"screenpengo/internal/format"
+	"screenpengo/internal/render"
+)
+
+const (
+	fileGridColumns = 3
+	fileGridHeight  = 360
+)
+
+type fileSort int
+
+const (
+	sortByName fileSort = iota
+	sortByModified
+)
+
+func (s fileSort) String() string {
+	if s == sortByModified {
+		return "Newest first"
+	}
+	return "Name"
+}
+
+type savedFile struct {
+	info     canvas.DocumentInfo
+	thumb    paint.ImageOp
+	hasThumb bool
+
+	button          widget.Clickable
+	renameButton    widget.Clickable
+	duplicateButton widget.Clickable
+	deleteButton    widget.Clickable
+	confirmDelete   bool
+}
+
+type fileBrowser struct {
+	files    []*savedFile
+	visible  []*savedFile
+	selected int
+	sortBy   fileSort
+
+	search       widget.Editor
+	list         widget.List
+	tags         []string
+	tagButtons   map[string]*widget.Clickable
+	tagFilter    string
+	tagList      widget.List
+	renaming     *savedFile
+	renameEditor widget.Editor
+	importEditor widget.Editor
+
+	sortButton    widget.Clickable
+	refreshButton widget.Clickable
+	loadButton    widget.Clickable
+	insertButton  widget.Clickable
+	importButton  widget.Clickable
+	cancelButton  widget.Clickable
+}
+
+func newFileBrowser() fileBrowser {
+	return fileBrowser{
+		search:       widget.Editor{SingleLine: true},
+		list:         widget.List{List: layout.List{Axis: layout.Vertical}},
+		tagList:      widget.List{List: layout.List{Axis: layout.Horizontal}},
+		tagButtons:   make(map[string]*widget.Clickable),
+		renameEditor: widget.Editor{SingleLine: true, Submit: true},
+		importEditor: widget.Editor{SingleLine: true, Submit: true},
+	}
+}
+
+func (t *Toolbar) openFileBrowser(gtx layout.Context) {
+	b := &t.browser
+	b.renaming = nil
+	b.selected = 0
+	t.refreshFileList()
+	gtx.Execute(key.FocusCmd{Tag: &b.search})
+}
+
+func (t *Toolbar) refreshFileList() {
+	b := &t.browser
+	docs, err := t.storage.List()
+	if err != nil {
+		t.loadError = errorText(err)
+		docs = nil
+	}
+
+	b.files = make([]*savedFile, len(docs))
+	for i, doc := range docs {
+		file := &savedFile{info: doc}
+		if data, err := t.storage.Thumbnail(doc.Name); err == nil {
+			if img, err := png.Decode(bytes.NewReader(data)); err == nil {
+				file.thumb = paint.NewImageOp(img)
+				file.hasThumb = true
+			}
+		}
+		b.files[i] = file
+	}
+	b.collectTags()
+	b.applyFilter()
+}
+
+// collectTags lists every tag in use, spelled as it first appears in name
+// order, and drops the tag filter if no drawing has that tag any more.
+func (b *fileBrowser) collectTags() {
+	b.tags = b.tags[:0]
+	for _, file := range b.files {
+		for _, tag := range file.info.Meta.Tags {
+			if !containsFold(b.tags, tag) {
+				b.tags = append(b.tags, tag)
+			}
+		}
+	}
+	sort.Slice(b.tags, func(i, j int) bool { return strings.ToLower(b.tags[i]) < strings.ToLower(b.tags[j]) })
+	for _, tag := range b.tags {
+		if b.tagButtons[tag] == nil {
+			b.tagButtons[tag] = new(widget.Clickable)
+		}
+	}
+	if !containsFold(b.tags, b.tagFilter) {
+		b.tagFilter = ""
+	}
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// applyFilter rebuilds the visible entries from the search text and sort
+// order, keeping the selection on the same document where possible.
+func (b *fileBrowser) applyFilter() {
+	var selectedName string
+	if b.selected >= 0 && b.selected < len(b.visible) {
+		selectedName = b.visible[b.selected].info.Name
+	}
+
+	query := strings.ToLower(strings.TrimSpace(b.search.Text()))
+	b.visible = b.visible[:0]
+	for _, file := range b.files {
+		if b.tagFilter != "" && !file.info.Meta.HasTag(b.tagFilter) {
+			continue
+		}
+		if query == "" || file.matches(query) {
+			b.visible = append(b.visible, file)
+		}
+	}
+
+	sort.SliceStable(b.visible, func(i, j int) bool {
+		x, y := b.visible[i].info, b.visible[j].info
+		if b.sortBy == sortByModified && !x.ModTime.Equal(y.ModTime) {
+			return x.ModTime.After(y.ModTime)
+		}
+		return strings.ToLower(x.Name) < strings.ToLower(y.Name)
+	})
+
+	b.selected = 0
+	for i, file := range b.visible {
+		if file.info.Name == selectedName {
+			b.selected = i
+		}
+	}
+}
+
+// matches looks for a lower-case query in the name, title and description.
+func (file *savedFile) matches(query string) bool {
+	for _, text := range []string{file.info.Name, file.info.Meta.Title, file.info.Meta.Description} {
+		if strings.Contains(strings.ToLower(text), query) {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *fileBrowser) selectedFile() *savedFile {
+	if b.selected < 0 || b.selected >= len(b.visible) {
+		return nil
+	}
+	return b.visible[b.selected]
+}
+
+func (b *fileBrowser) moveSelection(delta int) {
+	if len(b.visible) == 0 {
+		return
+	}
+	b.selected = max(0, min(len(b.visible)-1, b.selected+delta))
+
+	row := b.selected / fileGridColumns
+	pos := b.list.Position
+	if row < pos.First || (pos.Count > 0 && row >= pos.First+pos.Count) {
+		b.list.ScrollTo(row)
+	}
+}
+
+func (t *Toolbar) handleFileBrowserEvents(gtx layout.Context, ev *Events) {
+	b := &t.browser
+
+	t.handleFileBrowserKeys(gtx, ev)
+
+	for {
+		e, ok := b.search.Update(gtx)
+		if !ok {
+			break
+		}
+		if _, isChange := e.(widget.ChangeEvent); isChange {
+			b.selected = 0
+			b.applyFilter()
+			b.list.ScrollTo(0)
+		}
+	}
+
+	if b.sortButton.Clicked(gtx) {
+		b.sortBy = (b.sortBy + 1) % (sortByModified + 1)
+		b.applyFilter()
+	}
+	if b.refreshButton.Clicked(gtx) {
+		t.refreshFileList()
+	}
+	if b.loadButton.Clicked(gtx) {
+		t.requestLoad(ev)
+	}
+	if b.insertButton.Clicked(gtx) {
+		t.requestInsert(ev)
+	}
+	if b.importButton.Clicked(gtx) {
+		t.requestImport(ev)
+	}
+	for {
+		e, ok := b.importEditor.Update(gtx)
+		if !ok {
+			break
+		}
+		if _, isSubmit := e.(widget.SubmitEvent); isSubmit {
+			t.requestImport(ev)
+		}
+	}
+	if b.cancelButton.Clicked(gtx) {
+		t.loadDialogOpen = false
+	}
+	for _, tag := range b.tags {
+		if b.tagButtons[tag].Clicked(gtx) {
+			if b.tagFilter == tag {
+				b.tagFilter = ""
+			} else {
+				b.tagFilter = tag
+			}
+			b.applyFilter()
+			b.list.ScrollTo(0)
+		}
+	}
+
+	for i, file := range b.visible {
+		// A click selects the drawing so that it can be inserted instead;
+		// a double click loads it straight away.
+		for {
+			click, ok := file.button.Update(gtx)
+			if !ok {
+				break
+			}
+			b.selected = i
+			if click.NumClicks >= 2 {
+				t.requestLoad(ev)
+			}
+		}
+		if file.renameButton.Clicked(gtx) {
+			b.selected = i
+			t.startRename(gtx, file)
+		}
+		if file.duplicateButton.Clicked(gtx) {
+			b.selected = i
+			t.duplicateFile(file)
+			return
+		}
+		if file.deleteButton.Clicked(gtx) {
+			b.selected = i
+			if t.deleteFile(file) {
+				return
+			}
+		}
+	}
+
+	if b.renaming != nil {
+		for {
+			e, ok := b.renameEditor.Update(gtx)
+			if !ok {
+				break
+			}
+			if _, isSubmit := e.(widget.SubmitEvent); isSubmit {
+				t.finishRename()
+				return
+			}
+		}
+	}
+}
+
+// handleFileBrowserKeys reads the navigation keys before the search box does,
+// so arrows move through the grid while typing still goes to the search box.
+// Left, Right and Delete are left to the search box while it has text, and
+// only Escape is taken from the import box.
+func (t *Toolbar) handleFileBrowserKeys(gtx layout.Context, ev *Events) {
+	b := &t.browser
+	editingText := b.search.Len() > 0 && gtx.Focused(&b.search)
+
+	filters := []event.Filter{
+		key.Filter{Name: key.NameEscape},
+	}
+	if b.renaming == nil && !gtx.Focused(&b.importEditor) {
+		filters = append(filters,
+			key.Filter{Name: key.NameUpArrow},
+			key.Filter{Name: key.NameDownArrow},
+			key.Filter{Name: key.NamePageUp},
+			key.Filter{Name: key.NamePageDown},
+			key.Filter{Name: key.NameReturn, Optional: key.ModShift},
+			key.Filter{Name: key.NameEnter, Optional: key.ModShift},
+			key.Filter{Name: "F2"},
+		)
+		if !editingText {
+			filters = append(filters,
+				key.Filter{Name: key.NameLeftArrow},
+				key.Filter{Name: key.NameRightArrow},
+				key.Filter{Name: key.NameDeleteForward},
+			)
+		}
+	}
+
+	for {
+		e, ok := gtx.Event(filters...)
+		if !ok {
+			break
+		}
+		ke, ok := e.(key.Event)
+		if !ok || ke.State != key.Press {
+			continue
+		}
+
+		switch ke.Name {
+		case key.NameEscape:
+			if b.renaming != nil {
+				b.renaming = nil
+				gtx.Execute(key.FocusCmd{Tag: &b.search})
+			} else {
+				t.loadDialogOpen = false
+			}
+		case key.NameUpArrow:
+			b.moveSelection(-fileGridColumns)
+		case key.NameDownArrow:
+			b.moveSelection(fileGridColumns)
+		case key.NamePageUp:
+			b.moveSelection(-fileGridColumns * 3)
+		case key.NamePageDown:
+			b.moveSelection(fileGridColumns * 3)
+		case key.NameLeftArrow:
+			b.moveSelection(-1)
+		case key.NameRightArrow:
+			b.moveSelection(1)
+		case key.NameReturn, key.NameEnter:
+			if ke.Modifiers.Contain(key.ModShift) {
+				t.requestInsert(ev)
+			} else {
+				t.requestLoad(ev)
+			}
+		case "F2":
+			if file := b.selectedFile(); file != nil {
+				t.startRename(gtx, file)
+			}
+		case key.NameDeleteForward:
+			if file := b.selectedFile(); file != nil {
+				t.deleteFile(file)
+			}
+		}
+	}
+}
+
+func (t *Toolbar) requestLoad(ev *Events) {
+	if file := t.browser.selectedFile(); file != nil {
+		ev.LoadRequested = true
+		ev.LoadFilename = file.info.Name
+	}
+}
+
+func (t *Toolbar) requestInsert(ev *Events) {
+	if file := t.browser.selectedFile(); file != nil {
+		ev.InsertRequested = true
+		ev.InsertFilename = file.info.Name
+	}
+}
+
+func (t *Toolbar) requestImport(ev *Events) {
+	path := importPath(t.browser.importEditor.Text())
+	if path == "" {
+		t.loadError = "Enter the path of a file to import"
+		return
+	}
+	ev.ImportRequested = true
+	ev.ImportPath = path
+}
+
+// importPath accepts what file managers put on the clipboard as well as
+// plain paths: quoted paths, file:// URLs and ~ for the home directory.
+func importPath(text string) string {
+	path := strings.Trim(strings.TrimSpace(text), `"'`)
+	if rest, ok := strings.CutPrefix(path, "file://"); ok {
+		if unescaped, err := url.PathUnescape(rest); err == nil {
+			path = unescaped
+		}
+	}
+	if rest, ok := strings.CutPrefix(path, "~"+string(filepath.Separator)); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			path = filepath.Join(home, rest)
+		}
+	}
+	return path
+}
+
+func (t *Toolbar) startRename(gtx layout.Context, file *savedFile) {
+	b := &t.browser
+	b.renaming = file
+	b.renameEditor.SetText(file.info.Name)
+	b.renameEditor.SetCaret(b.renameEditor.Len(), 0)
+	gtx.Execute(key.FocusCmd{Tag: &b.renameEditor})
+}
+
+func (t *Toolbar) finishRename() {
+	b := &t.browser
+	file := b.renaming
+	name := canvas.CleanName(b.renameEditor.Text())
+	if name == file.info.Name {
+		b.renaming = nil
+		return
+	}
+
+	err := canvas.ValidateName(name)
+	if err == nil {
+		err = t.storage.Rename(file.info.Name, name)
+	}
+	if errors.Is(err, fs.ErrExist) {
+		err = fmt.Errorf("a drawing named %q already exists", name)
+	}
+	if err != nil {
+		t.loadError = errorText(err)
+		return
+	}
+
+	t.loadError = ""
+	b.renaming = nil
+	file.info.Name = name
+	t.refreshFileList()
+}
+
+func (t *Toolbar) duplicateFile(file *savedFile) {
+	name := t.copyName(file.info.Name)
+	c, err := t.storage.Load(file.info.Name)
+	if err == nil {
+		err = t.storage.Save(name, c)
+	}
+	if err != nil {
+		t.loadError = errorText(err)
+		return
+	}
+	if thumb, err := t.storage.Thumbnail(file.info.Name); err == nil {
+		t.storage.SaveThumbnail(name, thumb)
+	}
+
+	t.loadError = ""
+	t.refreshFileList()
+	for i, f := range t.browser.visible {
+		if f.info.Name == name {
+			t.browser.selected = i
+		}
+	}
+}
+
+// copyName finds a free "<name> copy", "<name> copy 2", ... name. Any Stat
+// error ends the search; an invalid name is then reported by Save.
+func (t *Toolbar) copyName(name string) string {
+	for n := 1; ; n++ {
+		candidate := name + " copy"
+		if n > 1 {
+			candidate = fmt.Sprintf("%s copy %d", name, n)
+		}
+		if _, err := t.storage.Stat(candidate); err != nil {
+			return candidate
+		}
+	}
+}
+
+// deleteFile asks for confirmation on the first call and deletes on the
+// second. It reports whether the file list changed.
+func (t *Toolbar) deleteFile(file *savedFile) bool {
+	if !file.confirmDelete {
+		for _, f := range t.browser.files {
+			f.confirmDelete = false
+		}
+		file.confirmDelete = true
+		return false
+	}
+
+	if err := t.storage.Delete(file.info.Name); err != nil {
+		t.loadError = errorText(err)
+		return false
+	}
+	t.loadError = ""
+	t.refreshFileList()
+	return true
+}
+
+func (t *Toolbar) layoutLoadDialog(gtx layout.Context) layout.Dimensions {
+	b := &t.browser
+
+	return t.drawPanel(gtx, func(gtx layout.Context) layout.Dimensions {
+		return layout.Flex{Axis: layout.Vertical, Spacing: layout.SpaceStart}.Layout(gtx,
+			layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+				return layout.Flex{Axis: layout.Horizontal, Alignment: layout.Middle}.Layout(gtx,
+					layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+						label := material.Body1(t.theme, "Load Drawing")
+						label.Font.Weight = 700
+						return label.Layout(gtx)
+					}),
+					layout.Flexed(1, layout.Spacer{Width: 10}.Layout),
+					layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+						btn := material.Button(t.theme, &b.sortButton, "Sort: "+b.sortBy.String())
+						btn.Background = color.NRGBA{R: 100, G: 100, B: 100, A: 200}
+						return btn.Layout(gtx)
+					}),
+					layout.Rigid(layout.Spacer{Width: 5}.Layout),
+					layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+						btn := material.Button(t.theme, &b.refreshButton, "↻")
+						btn.Background = color.NRGBA{R: 100, G: 100, B: 100, A: 200}
+						return btn.Layout(gtx)
+					}),
+				)
+			}),
+			layout.Rigid(layout.Spacer{Height: 10}.Layout),
+			layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+				gtx.Constraints.Min.X = gtx.Dp(200)
+				gtx.Constraints.Max.X = gtx.Dp(200)
+				editor := material.Editor(t.theme, &b.search, "Search...")
+				editor.TextSize = 14
+				return editor.Layout(gtx)
+			}),
+			layout.Rigid(t.layoutTagFilter),
+			layout.Rigid(layout.Spacer{Height: 10}.Layout),
+			layout.Rigid(t.layoutFileGrid),
+			layout.Rigid(t.layoutFileDetails),
+			layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+				if t.loadError == "" {
+					return layout.Dimensions{}
+				}
+				gtx.Constraints.Max.X = gtx.Dp(480)
+				label := material.Caption(t.theme, t.loadError)
+				label.Color = color.NRGBA{R: 200, G: 40, B: 40, A: 255}
+				return label.Layout(gtx)
+			}),
+			layout.Rigid(layout.Spacer{Height: 5}.Layout),
+			layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+				label := material.Caption(t.theme, "Click or arrows: select · Double-click or Enter: load · Shift+Enter: insert · F2: rename · Del: delete")
+				label.Color = color.NRGBA{R: 100, G: 100, B: 100, A: 255}
+				return label.Layout(gtx)
+			}),
+			layout.Rigid(layout.Spacer{Height: 10}.Layout),
+			layout.Rigid(t.layoutImportRow),
+			layout.Rigid(layout.Spacer{Height: 10}.Layout),
+			layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+				return layout.Flex{Axis: layout.Horizontal, Spacing: layout.SpaceStart}.Layout(gtx,
+					layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+						btn := material.Button(t.theme, &b.loadButton, "Load")
+						btn.Background = color.NRGBA{R: 50, G: 100, B: 200, A: 255}
+						return btn.Layout(gtx)
+					}),
+					layout.Rigid(layout.Spacer{Width: 10}.Layout),
+					layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+						btn := material.Button(t.theme, &b.insertButton, "Insert")
+						btn.Background = color.NRGBA{R: 50, G: 100, B: 200, A: 255}
+						return btn.Layout(gtx)
+					}),
+					layout.Rigid(layout.Spacer{Width: 10}.Layout),
+					layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+						btn := material.Button(t.theme, &b.cancelButton, "Cancel")
+						btn.Background = color.NRGBA{R: 150, G: 50, B: 50, A: 255}
+						return btn.Layout(gtx)
+					}),
+				)
+			}),
+		)
+	})
+}
+
+// layoutImportRow takes the path of a foreign file to add to the drawing.
+func (t *Toolbar) layoutImportRow(gtx layout.Context) layout.Dimensions {
+	b := &t.browser
+	hint := "Import " + strings.Join(format.ImportExtensions(), ", ") + " file..."
+	return layout.Flex{Axis: layout.Horizontal, Alignment: layout.Middle}.Layout(gtx,
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			gtx.Constraints.Min.X = gtx.Dp(300)
+			gtx.Constraints.Max.X = gtx.Dp(300)
+			editor := material.Editor(t.theme, &b.importEditor, hint)
+			editor.TextSize = 14
+			return editor.Layout(gtx)
+		}),
+		layout.Rigid(layout.Spacer{Width: 10}.Layout),
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			btn := material.Button(t.theme, &b.importButton, "Import")
+			btn.Background = color.NRGBA{R: 120, G: 90, B: 160, A: 255}
+			return btn.Layout(gtx)
+		}),
+	)
+}
+
+// layoutTagFilter shows a button per tag; the pressed one limits the grid to
+// drawings with that tag.
+func (t *Toolbar) layoutTagFilter(gtx layout.Context) layout.Dimensions {
+	b := &t.browser
+	if len(b.tags) == 0 {
+		return layout.Dimensions{}
+	}
+	gtx.Constraints.Max.X = min(gtx.Constraints.Max.X, gtx.Dp(fileGridColumns*(render.ThumbnailWidth/2+8)))
+	return layout.Inset{Top: 5}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+		return material.List(t.theme, &b.tagList).Layout(gtx, len(b.tags), func(gtx layout.Context, i int) layout.Dimensions {
+			tag := b.tags[i]
+			background := color.NRGBA{R: 100, G: 100, B: 100, A: 200}
+			if tag == b.tagFilter {
+				background = color.NRGBA{R: 100, G: 180, B: 255, A: 255}
+			}
+			return layout.Inset{Right: 3}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+				btn := material.Button(t.theme, b.tagButtons[tag], "#"+tag)
+				btn.Background = background
+				btn.TextSize = 11
+				btn.Inset = layout.UniformInset(unit.Dp(4))
+				return btn.Layout(gtx)
+			})
+		})
+	})
+}
+
+// layoutFileDetails describes the selected drawing from its metadata.
+func (t *Toolbar) layoutFileDetails(gtx layout.Context) layout.Dimensions {
+	file := t.browser.selectedFile()
+	if file == nil {
+		return layout.Dimensions{}
+	}
+	meta := file.info.Meta
+
+	var lines []string
+	if meta.Title != "" {
+		lines = append(lines, meta.Title)
+	}
+	if meta.Description != "" {
+		lines = append(lines, meta.Description)
+	}
+	var facts []string
+	if len(meta.Tags) > 0 {
+		facts = append(facts, "Tags: "+strings.Join(meta.Tags, ", "))
+	}
+	if meta.Author != "" {
+		facts = append(facts, "by "+meta.Author)
+	}
+	if !meta.Created.IsZero() {
+		facts = append(facts, "created "+meta.Created.Local().Format("2006-01-02 15:04"))
+	}
+	if meta.AppVersion != "" {
+		facts = append(facts, "screenpen "+meta.AppVersion)
+	}
+	if len(facts) > 0 {
+		lines = append(lines, strings.Join(facts, " · "))
+	}
+	if len(lines) == 0 {
+		return layout.Dimensions{}
+	}
+
+	gtx.Constraints.Max.X = min(gtx.Constraints.Max.X, gtx.Dp(480))
+	return layout.Inset{Top: 5}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+		label := material.Caption(t.theme, strings.Join(lines, "\n"))
+		label.MaxLines = 4
+		return label.Layout(gtx)
+	})
+}
+
+func (t *Toolbar) layoutFileGrid(gtx layout.Context) layout.Dimensions {
+	b := &t.browser
+	if len(b.visible) == 0 {
+		text := "No saved files found"
+		if len(b.files) > 0 {
+			text = "No drawings match the search"
+		}
+		label := material.Caption(t.theme, text)
+		label.Color = color.NRGBA{R: 150, G: 150, B: 150, A: 255}
+		return label.Layout(gtx)
+	}
+
+	gtx.Constraints.Max.Y = min(gtx.Constraints.Max.Y, gtx.Dp(fileGridHeight))
+	rows := (len(b.visible) + fileGridColumns - 1) / fileGridColumns
+	return material.List(t.theme, &b.list).Layout(gtx, rows, func(gtx layout.Context, row int) layout.Dimensions {
+		var cells []layout.FlexChild
+		for col := 0; col < fileGridColumns; col++ {
+			idx := row*fileGridColumns + col
+			if idx >= len(b.visible) {
+				break
+			}
+			cells = append(cells, layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+				return layout.UniformInset(4).Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+					return t.layoutFileCell(gtx, b.visible[idx], idx == b.selected)
+				})
+			}))
+		}
+		return layout.Flex{Axis: layout.Horizontal}.Layout(gtx, cells...)
+	})
+}
+
+func (t *Toolbar) layoutFileCell(gtx layout.Context, file *savedFile, selected bool) layout.Dimensions {
+	width := gtx.Dp(render.ThumbnailWidth / 2)
+	gtx.Constraints.Min.X = width
+	gtx.Constraints.Max.X = width
+
+	return layout.Stack{}.Layout(gtx,
+		layout.Expanded(func(gtx layout.Context) layout.Dimensions {
+			if selected {
+				rect := clip.UniformRRect(image.Rectangle{Max: gtx.Constraints.Min}, gtx.Dp(4))
+				paint.FillShape(gtx.Ops, color.NRGBA{R: 100, G: 180, B: 255, A: 120}, rect.Op(gtx.Ops))
+			}
+			return layout.Dimensions{Size: gtx.Constraints.Min}
+		}),
+		layout.Stacked(func(gtx layout.Context) layout.Dimensions {
+			return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+				layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+					return material.Clickable(gtx, &file.button, func(gtx layout.Context) layout.Dimensions {
+						return t.layoutThumbnail(gtx, file, width)
+					})
+				}),
+				layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+					if t.browser.renaming == file {
+						editor := material.Editor(t.theme, &t.browser.renameEditor, "New name")
+						editor.TextSize = 14
+						return editor.Layout(gtx)
+					}
+					label := material.Body2(t.theme, file.info.Name)
+					label.MaxLines = 1
+					return label.Layout(gtx)
+				}),
+				layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+					label := material.Caption(t.theme, file.info.ModTime.Format("2006-01-02 15:04"))
+					label.Color = color.NRGBA{R: 100, G: 100, B: 100, A: 255}
+					return label.Layout(gtx)
+				}),
+				layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+					deleteLabel := "Delete"
+					deleteColor := color.NRGBA{R: 100, G: 100, B: 100, A: 200}
+					if file.confirmDelete {
+						deleteLabel = "Sure?"
+						deleteColor = color.NRGBA{R: 200, G: 40, B: 40, A: 255}
+					}
+					return layout.Flex{Axis: layout.Horizontal}.Layout(gtx,
+						t.fileAction(&file.renameButton, "Rename", color.NRGBA{R: 100, G: 100, B: 100, A: 200}),
+						layout.Rigid(layout.Spacer{Width: 3}.Layout),
+						t.fileAction(&file.duplicateButton, "Copy", color.NRGBA{R: 100, G: 100, B: 100, A: 200}),
+						layout.Rigid(layout.Spacer{Width: 3}.Layout),
+						t.fileAction(&file.deleteButton, deleteLabel, deleteColor),
+					)
+				}),
+			)
+		}),
+	)
+}
+
+func (t *Toolbar) fileAction(clickable *widget.Clickable, label string, background color.NRGBA) layout.FlexChild {
+	return layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+		btn := material.Button(t.theme, clickable, label)
+		btn.Background = background
+		btn.TextSize = 11
+		btn.Inset = layout.UniformInset(unit.Dp(4))
+		return btn.Layout(gtx)
+	})
+}
+
+func (t *Toolbar) layoutThumbnail(gtx layout.Context, file *savedFile, width int) layout.Dimensions {
+	size := image.Pt(width, gtx.Dp(render.ThumbnailHeight/2))
+	gtx.Constraints = layout.Exact(size)
+	if !file.hasThumb {
+		defer clip.Rect{Max: size}.Push(gtx.Ops).Pop()
+		paint.ColorOp{Color: color.NRGBA{R: 220, G: 220, B: 220, A: 255}}.Add(gtx.Ops)
+		paint.PaintOp{}.Add(gtx.Ops)
+		return layout.Center.Layout(gtx, material.Caption(t.theme, "No preview").Layout)
+	}
+	return widget.Image{Src: file.thumb, Fit: widget.Contain}.Layout(gtx)
+}
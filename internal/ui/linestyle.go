@@ -0,0 +1,107 @@
+package ui
+
+import (
+	"image/color"
+
+	"gioui.org/layout"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+
+	"screenpengo/internal/tool"
+)
+
+type lineStyleControls struct {
+	buttons       [5]widget.Clickable
+	customEditor  widget.Editor
+	customPattern []float32
+	customError   string
+}
+
+func newLineStyleControls() lineStyleControls {
+	c := lineStyleControls{
+		customEditor: widget.Editor{SingleLine: true, Submit: true},
+	}
+	c.customEditor.SetText("4 2 1 2")
+	c.customPattern, _ = tool.ParseDashPattern(c.customEditor.Text())
+	return c
+}
+
+func (t *Toolbar) handleLineStyleEvents(gtx layout.Context) {
+	ls := &t.lineStyle
+	pen := &t.state.Pen
+
+	for i := range ls.buttons {
+		if ls.buttons[i].Clicked(gtx) {
+			pen.Dash = tool.DashStyles[i]
+			pen.CustomDash = ls.customPattern
+		}
+	}
+
+	for {
+		e, ok := ls.customEditor.Update(gtx)
+		if !ok {
+			break
+		}
+		if _, isChange := e.(widget.ChangeEvent); !isChange {
+			continue
+		}
+		pattern, err := tool.ParseDashPattern(ls.customEditor.Text())
+		if err != nil {
+			ls.customError = errorText(err)
+			continue
+		}
+		ls.customError = ""
+		ls.customPattern = pattern
+		pen.CustomDash = pattern
+	}
+}
+
+func (t *Toolbar) layoutLineStyle(gtx layout.Context) layout.Dimensions {
+	ls := &t.lineStyle
+
+	children := []layout.FlexChild{
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			return material.Body1(t.theme, "Line style").Layout(gtx)
+		}),
+	}
+	for i, style := range tool.DashStyles {
+		idx := i
+		selected := style == t.state.Pen.Dash
+		label := style.String()
+		children = append(children,
+			layout.Rigid(layout.Spacer{Height: 5}.Layout),
+			layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+				btn := material.Button(t.theme, &ls.buttons[idx], label)
+				if selected {
+					btn.Background = color.NRGBA{R: 100, G: 180, B: 255, A: 255}
+				} else {
+					btn.Background = color.NRGBA{R: 80, G: 120, B: 180, A: 220}
+				}
+				return btn.Layout(gtx)
+			}),
+		)
+	}
+	children = append(children,
+		layout.Rigid(layout.Spacer{Height: 5}.Layout),
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			gtx.Constraints.Min.X = gtx.Dp(180)
+			gtx.Constraints.Max.X = gtx.Dp(180)
+			editor := material.Editor(t.theme, &ls.customEditor, "dash gap ...")
+			editor.TextSize = 14
+			return editor.Layout(gtx)
+		}),
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			text := "Custom lengths, in line widths"
+			col := color.NRGBA{R: 100, G: 100, B: 100, A: 255}
+			if ls.customError != "" {
+				text = ls.customError
+				col = color.NRGBA{R: 200, G: 40, B: 40, A: 255}
+			}
+			label := material.Caption(t.theme, text)
+			label.Color = col
+			return label.Layout(gtx)
+		}),
+	)
+
+	return layout.Flex{Axis: layout.Vertical, Spacing: layout.SpaceStart}.Layout(gtx, children...)
+}
@@ -0,0 +1,70 @@
+package ui
+
+import (
+	"image/color"
+
+	"gioui.org/layout"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+)
+
+type recoveryPrompt struct {
+	open bool
+
+	restoreButton widget.Clickable
+	discardButton widget.Clickable
+}
+
+// OfferRecovery asks the user whether to restore the drawing autosaved by a
+// session that did not exit cleanly.
+func (t *Toolbar) OfferRecovery() {
+	t.recovery.open = true
+}
+
+func (t *Toolbar) handleRecoveryEvents(gtx layout.Context, ev *Events) {
+	if !t.recovery.open {
+		return
+	}
+	if t.recovery.restoreButton.Clicked(gtx) {
+		t.recovery.open = false
+		ev.RecoveryRestored = true
+	}
+	if t.recovery.discardButton.Clicked(gtx) {
+		t.recovery.open = false
+		ev.RecoveryDiscarded = true
+	}
+}
+
+func (t *Toolbar) layoutRecoveryPrompt(gtx layout.Context) layout.Dimensions {
+	return t.drawPanel(gtx, func(gtx layout.Context) layout.Dimensions {
+		gtx.Constraints.Max.X = gtx.Dp(260)
+
+		return layout.Flex{Axis: layout.Vertical, Spacing: layout.SpaceStart}.Layout(gtx,
+			layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+				label := material.Body1(t.theme, "Restore previous session?")
+				label.Font.Weight = 700
+				return label.Layout(gtx)
+			}),
+			layout.Rigid(layout.Spacer{Height: 5}.Layout),
+			layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+				return material.Body2(t.theme, "Screenpen did not exit cleanly last time. The drawing was autosaved.").Layout(gtx)
+			}),
+			layout.Rigid(layout.Spacer{Height: 10}.Layout),
+			layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+				return layout.Flex{Axis: layout.Horizontal}.Layout(gtx,
+					layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+						btn := material.Button(t.theme, &t.recovery.restoreButton, "Restore")
+						btn.Background = color.NRGBA{R: 50, G: 150, B: 50, A: 255}
+						return btn.Layout(gtx)
+					}),
+					layout.Rigid(layout.Spacer{Width: 10}.Layout),
+					layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+						btn := material.Button(t.theme, &t.recovery.discardButton, "Discard")
+						btn.Background = color.NRGBA{R: 150, G: 50, B: 50, A: 255}
+						return btn.Layout(gtx)
+					}),
+				)
+			}),
+		)
+	})
+}
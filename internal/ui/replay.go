@@ -0,0 +1,155 @@
+package ui
+
+import (
+	"fmt"
+	"image/color"
+	"time"
+
+	"gioui.org/layout"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+
+	"screenpengo/internal/replay"
+)
+
+type ReplayStatus struct {
+	Playing  bool
+	Speed    float64
+	Progress float32
+	Position time.Duration
+	Duration time.Duration
+}
+
+type replayControls struct {
+	open bool
+
+	playButton   widget.Clickable
+	exitButton   widget.Clickable
+	speedButtons [4]widget.Clickable
+	scrubSlider  widget.Float
+
+	status ReplayStatus
+}
+
+func (t *Toolbar) SetReplayStatus(status ReplayStatus) {
+	t.replay.status = status
+	if !t.replay.scrubSlider.Dragging() {
+		t.replay.scrubSlider.Value = status.Progress
+	}
+}
+
+func (t *Toolbar) IsReplayOpen() bool {
+	return t.replay.open
+}
+
+func (t *Toolbar) stopReplay(ev *Events) {
+	if t.replay.open {
+		t.replay.open = false
+		ev.ReplayStopped = true
+	}
+}
+
+func (t *Toolbar) handleReplayEvents(gtx layout.Context, ev *Events) {
+	if t.replayButton.Clicked(gtx) {
+		if t.replay.open {
+			t.stopReplay(ev)
+		} else {
+			t.replay.open = true
+			t.colorPickerOpen = false
+			t.widthPickerOpen = false
+			t.shapesPickerOpen = false
+			t.saveDialogOpen = false
+			t.loadDialogOpen = false
+			ev.ReplayStarted = true
+		}
+	}
+
+	if !t.replay.open {
+		return
+	}
+
+	if t.replay.exitButton.Clicked(gtx) {
+		t.stopReplay(ev)
+		return
+	}
+	if t.replay.playButton.Clicked(gtx) {
+		ev.ReplayPlayPause = true
+	}
+	for i := range t.replay.speedButtons {
+		if t.replay.speedButtons[i].Clicked(gtx) {
+			ev.ReplaySpeed = replay.Speeds[i]
+		}
+	}
+	if t.replay.scrubSlider.Update(gtx) {
+		ev.ReplaySeek = true
+		ev.ReplayProgress = t.replay.scrubSlider.Value
+	}
+}
+
+func (t *Toolbar) layoutReplayPanel(gtx layout.Context) layout.Dimensions {
+	return t.drawPanel(gtx, func(gtx layout.Context) layout.Dimensions {
+		gtx.Constraints.Max.X = gtx.Dp(260)
+		status := t.replay.status
+
+		return layout.Flex{Axis: layout.Vertical, Spacing: layout.SpaceStart}.Layout(gtx,
+			layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+				label := material.Body1(t.theme, "Replay")
+				label.Font.Weight = 700
+				return label.Layout(gtx)
+			}),
+			layout.Rigid(layout.Spacer{Height: 10}.Layout),
+			layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+				gtx.Constraints.Min.X = gtx.Dp(240)
+				gtx.Constraints.Max.X = gtx.Dp(240)
+				return material.Slider(t.theme, &t.replay.scrubSlider).Layout(gtx)
+			}),
+			layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+				text := fmt.Sprintf("%s / %s", formatReplayTime(status.Position), formatReplayTime(status.Duration))
+				return material.Body2(t.theme, text).Layout(gtx)
+			}),
+			layout.Rigid(layout.Spacer{Height: 10}.Layout),
+			layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+				children := []layout.FlexChild{
+					layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+						text := "▶"
+						if status.Playing {
+							text = "❚❚"
+						}
+						btn := material.Button(t.theme, &t.replay.playButton, text)
+						btn.Background = color.NRGBA{R: 50, G: 150, B: 50, A: 255}
+						return btn.Layout(gtx)
+					}),
+				}
+				for i, speed := range replay.Speeds {
+					idx := i
+					label := fmt.Sprintf("%g×", speed)
+					selected := speed == status.Speed
+					children = append(children,
+						layout.Rigid(layout.Spacer{Width: 5}.Layout),
+						layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+							btn := material.Button(t.theme, &t.replay.speedButtons[idx], label)
+							if selected {
+								btn.Background = color.NRGBA{R: 100, G: 180, B: 255, A: 255}
+							} else {
+								btn.Background = color.NRGBA{R: 70, G: 70, B: 70, A: 220}
+							}
+							return btn.Layout(gtx)
+						}),
+					)
+				}
+				return layout.Flex{Axis: layout.Horizontal}.Layout(gtx, children...)
+			}),
+			layout.Rigid(layout.Spacer{Height: 10}.Layout),
+			layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+				btn := material.Button(t.theme, &t.replay.exitButton, "Exit replay")
+				btn.Background = color.NRGBA{R: 150, G: 50, B: 50, A: 255}
+				return btn.Layout(gtx)
+			}),
+		)
+	})
+}
+
+func formatReplayTime(d time.Duration) string {
+	seconds := int(d / time.Second)
+	return fmt.Sprintf("%d:%02d", seconds/60, seconds%60)
+}
@@ -1,10 +1,14 @@
 package ui
 
 import (
+	"errors"
 	"fmt"
 	"image"
 	"image/color"
+	"io/fs"
+	"strings"
 
+	"gioui.org/io/key"
 	"gioui.org/layout"
 	"gioui.org/op/clip"
 	"gioui.org/op/paint"
@@ -12,81 +16,210 @@ import (
 	"gioui.org/widget/material"
 
 	"screenpengo/internal/canvas"
+	"screenpengo/internal/format"
 	"screenpengo/internal/tool"
 )
 
+type ExportFormat int
+
+const (
+	ExportSVG ExportFormat = iota
+	ExportPDF
+	ExportGIF
+	ExportPNGSequence
+	ExportXopp
+	ExportInkML
+	ExportExcalidraw
+	ExportHPGL
+	ExportGCode
+)
+
+// Target returns the name of the file, or for a PNG sequence the directory,
+// that an export of the drawing called name writes to.
+func (f ExportFormat) Target(name string) string {
+	switch f {
+	case ExportPDF:
+		return name + ".pdf"
+	case ExportGIF:
+		return name + ".gif"
+	case ExportPNGSequence:
+		return name + "-frames"
+	case ExportXopp:
+		return name + ".xopp"
+	case ExportInkML:
+		return name + ".inkml"
+	case ExportExcalidraw:
+		return name + ".excalidraw"
+	case ExportHPGL:
+		return name + ".hpgl"
+	case ExportGCode:
+		return name + ".gcode"
+	}
+	return name + ".svg"
+}
+
+// The width slider covers widths from minSliderWidth to maxSliderWidth dp.
+const (
+	minSliderWidth = tool.MinWidthDp
+	maxSliderWidth = 20
+)
+
+var (
+	timelapseFrameRates = []float64{5, 10, 15, 25, 30}
+	timelapseSpeedUps   = []float64{1, 2, 4, 8, 16}
+)
+
+// Events are what the toolbar asks of the application in a frame. Changes
+// of tool, colour and width go straight to the shared tool.State instead.
+type Events struct {
+	SaveRequested   bool
+	SaveFilename    string
+	SaveMetadata    canvas.Metadata
+	LoadRequested   bool
+	LoadFilename    string
+	InsertRequested bool
+	InsertFilename  string
+	ImportRequested bool
+	ImportPath      string
+
+	ExportRequested bool
+	ExportFormat    ExportFormat
+	ExportFilename  string
+	// ExportOverwrite is set once the user confirmed replacing the target.
+	ExportOverwrite bool
+	ExportTemplate  format.PageTemplate
+	ExportPaper     format.PaperSize
+	ExportFrameRate float64
+	ExportSpeedUp   float64
+
+	ReplayStarted   bool
+	ReplayStopped   bool
+	ReplayPlayPause bool
+	ReplaySpeed     float64
+	ReplaySeek      bool
+	ReplayProgress  float32
+
+	RecoveryRestored  bool
+	RecoveryDiscarded bool
+}
+
 type Toolbar struct {
 	hideButton   widget.Clickable
 	colorButton  widget.Clickable
 	widthButton  widget.Clickable
 	eraserButton widget.Clickable
+	moveButton   widget.Clickable
 	shapesButton widget.Clickable
 	saveButton   widget.Clickable
 	loadButton   widget.Clickable
+	replayButton widget.Clickable
 
+	penButton       widget.Clickable
 	circleButton    widget.Clickable
 	rectangleButton widget.Clickable
 	lineButton      widget.Clickable
 	arrowButton     widget.Clickable
 
-	confirmSaveButton widget.Clickable
-	cancelSaveButton  widget.Clickable
+	confirmSaveButton      widget.Clickable
+	exportSVGButton        widget.Clickable
+	exportPDFButton        widget.Clickable
+	exportXoppButton       widget.Clickable
+	exportInkMLButton      widget.Clickable
+	exportExcalidrawButton widget.Clickable
+	exportHPGLButton       widget.Clickable
+	exportGCodeButton      widget.Clickable
+	paperButton            widget.Clickable
+	templateButton         widget.Clickable
+	exportGIFButton        widget.Clickable
+	exportPNGsButton       widget.Clickable
+	frameRateButton        widget.Clickable
+	speedUpButton          widget.Clickable
+	cancelSaveButton       widget.Clickable
 
-	confirmLoadButton widget.Clickable
-	cancelLoadButton  widget.Clickable
+	filenameEditor    widget.Editor
+	titleEditor       widget.Editor
+	descriptionEditor widget.Editor
+	tagsEditor        widget.Editor
+	authorEditor      widget.Editor
 
-	filenameEditor     widget.Editor
-	loadFilenameEditor widget.Editor
+	// meta is the metadata of the drawing on screen; the save dialog starts
+	// from it.
+	meta canvas.Metadata
 
-	savedFiles        []string
-	fileButtons       []widget.Clickable
-	refreshListButton widget.Clickable
+	saveError        string
+	pendingOverwrite string
+	// overwriteByExport is set when pendingOverwrite is the target of an
+	// export rather than a drawing; clicking that export again replaces it.
+	overwriteByExport bool
+	// exporting is set between TimelapseStarted and TimelapseFinished.
+	exporting bool
+	loadError string
+
+	browser fileBrowser
 
 	redSlider   widget.Float
 	greenSlider widget.Float
 	blueSlider  widget.Float
+	alphaSlider widget.Float
 
 	widthSlider widget.Float
 
-	prevRedValue   float32
-	prevGreenValue float32
-	prevBlueValue  float32
-	prevWidthValue float32
-
 	colorPickerOpen  bool
 	widthPickerOpen  bool
 	shapesPickerOpen bool
 	saveDialogOpen   bool
 	loadDialogOpen   bool
+	// showSaveDialog and showLoadDialog are set by keyboard shortcuts.
+	showSaveDialog bool
+	showLoadDialog bool
 
-	eraserActive bool
-	hidden       bool
+	pdfTemplate    format.PageTemplate
+	plotPaper      format.PaperSize
+	frameRateIndex int
+	speedUpIndex   int
+
+	replay    replayControls
+	lineStyle lineStyleControls
+	arrow     arrowControls
+	recovery  recoveryPrompt
+
+	hidden bool
+
+	// state is shared with the keyboard; the sliders and buttons show it.
+	state *tool.State
+
+	storage      canvas.Storage
+	saveLocation string
 
 	theme *material.Theme
 }
 
-func NewToolbar(theme *material.Theme) *Toolbar {
+func NewToolbar(theme *material.Theme, state *tool.State, storage canvas.Storage, saveLocation string) *Toolbar {
 	saveEditor := widget.Editor{
 		SingleLine: true,
 		Submit:     true,
 	}
 	saveEditor.SetText("")
 
-	loadEditor := widget.Editor{
-		SingleLine: true,
-		Submit:     true,
-	}
-	loadEditor.SetText("")
+	t := &Toolbar{
+		theme:          theme,
+		state:          state,
+		storage:        storage,
+		saveLocation:   saveLocation,
+		lineStyle:      newLineStyleControls(),
+		arrow:          newArrowControls(state.Shape.Arrow),
+		frameRateIndex: 1,
+		speedUpIndex:   2,
+		filenameEditor: saveEditor,
+		browser:        newFileBrowser(),
 
-	return &Toolbar{
-		theme:              theme,
-		redSlider:          widget.Float{Value: 1.0},
-		greenSlider:        widget.Float{Value: 0.0},
-		blueSlider:         widget.Float{Value: 0.0},
-		widthSlider:        widget.Float{Value: 0.5},
-		filenameEditor:     saveEditor,
-		loadFilenameEditor: loadEditor,
+		titleEditor:       widget.Editor{SingleLine: true},
+		descriptionEditor: widget.Editor{},
+		tagsEditor:        widget.Editor{SingleLine: true},
+		authorEditor:      widget.Editor{SingleLine: true},
 	}
+	t.syncSliders()
+	return t
 }
 
 func (t *Toolbar) ToggleHidden() {
@@ -100,29 +233,21 @@ func (t *Toolbar) ToggleHidden() {
 	}
 }
 
-func (t *Toolbar) HandleEvents(gtx layout.Context) (currentColor color.NRGBA, currentWidth float32, eraserClicked bool, slidersChanged bool, selectedShape tool.ShapeType, saveRequested bool, saveFilename string, loadRequested bool, loadFilename string) {
-	selectedShape = tool.NoShape
-	saveRequested = false
-	loadRequested = false
+func (t *Toolbar) HandleEvents(gtx layout.Context) Events {
+	var ev Events
 
 	if t.hideButton.Clicked(gtx) {
 		t.ToggleHidden()
 	}
 
 	if t.hidden {
-		currentColor = color.NRGBA{
-			R: uint8(t.redSlider.Value * 255),
-			G: uint8(t.greenSlider.Value * 255),
-			B: uint8(t.blueSlider.Value * 255),
-			A: 255,
-		}
-		currentWidth = 2 + (t.widthSlider.Value * 18)
-		return
+		return ev
 	}
 
 	if t.colorButton.Clicked(gtx) {
 		t.colorPickerOpen = !t.colorPickerOpen
 		if t.colorPickerOpen {
+			t.stopReplay(&ev)
 			t.widthPickerOpen = false
 		}
 	}
@@ -130,6 +255,7 @@ func (t *Toolbar) HandleEvents(gtx layout.Context) (currentColor color.NRGBA, cu
 	if t.widthButton.Clicked(gtx) {
 		t.widthPickerOpen = !t.widthPickerOpen
 		if t.widthPickerOpen {
+			t.stopReplay(&ev)
 			t.colorPickerOpen = false
 			t.shapesPickerOpen = false
 		}
@@ -138,117 +264,367 @@ func (t *Toolbar) HandleEvents(gtx layout.Context) (currentColor color.NRGBA, cu
 	if t.shapesButton.Clicked(gtx) {
 		t.shapesPickerOpen = !t.shapesPickerOpen
 		if t.shapesPickerOpen {
+			t.stopReplay(&ev)
 			t.colorPickerOpen = false
 			t.widthPickerOpen = false
 		}
 	}
 
+	if t.penButton.Clicked(gtx) {
+		t.state.Select(tool.PenTool)
+	}
 	if t.circleButton.Clicked(gtx) {
-		selectedShape = tool.Circle
-		t.eraserActive = false
+		t.state.SelectShape(tool.Circle)
 	}
 	if t.rectangleButton.Clicked(gtx) {
-		selectedShape = tool.Rectangle
-		t.eraserActive = false
+		t.state.SelectShape(tool.Rectangle)
 	}
 	if t.lineButton.Clicked(gtx) {
-		selectedShape = tool.Line
-		t.eraserActive = false
+		t.state.SelectShape(tool.Line)
 	}
 	if t.arrowButton.Clicked(gtx) {
-		selectedShape = tool.Arrow
-		t.eraserActive = false
+		t.state.SelectShape(tool.Arrow)
 	}
 
 	if t.saveButton.Clicked(gtx) {
-		t.saveDialogOpen = !t.saveDialogOpen
 		if t.saveDialogOpen {
-			t.colorPickerOpen = false
-			t.widthPickerOpen = false
-			t.shapesPickerOpen = false
-			t.loadDialogOpen = false
+			t.saveDialogOpen = false
+		} else {
+			t.openSaveDialog(gtx, &ev)
+		}
+	}
+	if t.showSaveDialog {
+		t.showSaveDialog = false
+		t.openSaveDialog(gtx, &ev)
+	}
+
+	for {
+		e, ok := t.filenameEditor.Update(gtx)
+		if !ok {
+			break
+		}
+		if _, isChange := e.(widget.ChangeEvent); isChange {
+			t.saveError = ""
+			t.clearOverwrite()
 		}
 	}
 
 	if t.confirmSaveButton.Clicked(gtx) {
-		saveRequested = true
-		saveFilename = t.filenameEditor.Text()
-		t.saveDialogOpen = false
+		if name, ok := t.validSaveName(); ok {
+			if (t.pendingOverwrite != name || t.overwriteByExport) && t.documentExists(name) {
+				t.pendingOverwrite = name
+				t.overwriteByExport = false
+			} else {
+				ev.SaveRequested = true
+				ev.SaveFilename = name
+				ev.SaveMetadata = t.editedMetadata()
+			}
+		}
+	}
+	if t.exportSVGButton.Clicked(gtx) {
+		t.requestExport(&ev, ExportSVG)
+	}
+	if t.exportPDFButton.Clicked(gtx) {
+		if t.requestExport(&ev, ExportPDF) {
+			ev.ExportTemplate = t.pdfTemplate
+		}
+	}
+	if t.exportXoppButton.Clicked(gtx) {
+		t.requestExport(&ev, ExportXopp)
+	}
+	if t.exportInkMLButton.Clicked(gtx) {
+		t.requestExport(&ev, ExportInkML)
+	}
+	if t.exportExcalidrawButton.Clicked(gtx) {
+		t.requestExport(&ev, ExportExcalidraw)
+	}
+	if t.exportHPGLButton.Clicked(gtx) {
+		if t.requestExport(&ev, ExportHPGL) {
+			ev.ExportPaper = t.plotPaper
+		}
+	}
+	if t.exportGCodeButton.Clicked(gtx) {
+		if t.requestExport(&ev, ExportGCode) {
+			ev.ExportPaper = t.plotPaper
+		}
+	}
+	if t.paperButton.Clicked(gtx) {
+		t.plotPaper = (t.plotPaper + 1) % (format.PaperLetter + 1)
+	}
+	if t.templateButton.Clicked(gtx) {
+		t.pdfTemplate = (t.pdfTemplate + 1) % (format.TemplateDotted + 1)
+	}
+	if t.exportGIFButton.Clicked(gtx) {
+		t.requestTimelapseExport(&ev, ExportGIF)
+	}
+	if t.exportPNGsButton.Clicked(gtx) {
+		t.requestTimelapseExport(&ev, ExportPNGSequence)
+	}
+	if t.frameRateButton.Clicked(gtx) {
+		t.frameRateIndex = (t.frameRateIndex + 1) % len(timelapseFrameRates)
+	}
+	if t.speedUpButton.Clicked(gtx) {
+		t.speedUpIndex = (t.speedUpIndex + 1) % len(timelapseSpeedUps)
 	}
 	if t.cancelSaveButton.Clicked(gtx) {
 		t.saveDialogOpen = false
 	}
 
 	if t.loadButton.Clicked(gtx) {
-		t.loadDialogOpen = !t.loadDialogOpen
 		if t.loadDialogOpen {
+			t.loadDialogOpen = false
+		} else {
+			t.openLoadDialog(gtx, &ev)
+		}
+	}
+	if t.showLoadDialog {
+		t.showLoadDialog = false
+		t.openLoadDialog(gtx, &ev)
+	}
+	if t.loadDialogOpen {
+		t.handleFileBrowserEvents(gtx, &ev)
+	}
+
+	t.handleRecoveryEvents(gtx, &ev)
+	t.handleReplayEvents(gtx, &ev)
+	t.handleLineStyleEvents(gtx)
+	t.handleArrowEvents(gtx)
+
+	if t.eraserButton.Clicked(gtx) {
+		t.state.Toggle(tool.EraserTool)
+		if t.state.Erasing() {
 			t.colorPickerOpen = false
 			t.widthPickerOpen = false
-			t.shapesPickerOpen = false
-			t.saveDialogOpen = false
-			t.refreshFileList()
 		}
 	}
 
-	if t.refreshListButton.Clicked(gtx) {
-		t.refreshFileList()
+	if t.moveButton.Clicked(gtx) {
+		t.state.Toggle(tool.MoveTool)
 	}
 
-	for i := range t.fileButtons {
-		if t.fileButtons[i].Clicked(gtx) {
-			loadRequested = true
-			loadFilename = t.savedFiles[i]
-			t.loadDialogOpen = false
-			break
+	colorChanged := false
+	for _, slider := range []*widget.Float{&t.redSlider, &t.greenSlider, &t.blueSlider, &t.alphaSlider} {
+		if slider.Update(gtx) {
+			colorChanged = true
 		}
 	}
-
-	if t.confirmLoadButton.Clicked(gtx) {
-		loadRequested = true
-		loadFilename = t.loadFilenameEditor.Text()
-		t.loadDialogOpen = false
+	if colorChanged {
+		t.state.SetCustomColor(t.sliderColor())
 	}
-	if t.cancelLoadButton.Clicked(gtx) {
-		t.loadDialogOpen = false
+	if t.widthSlider.Update(gtx) {
+		t.state.SetCustomWidth(t.sliderWidth())
 	}
 
-	if t.eraserButton.Clicked(gtx) {
-		t.eraserActive = !t.eraserActive
+	return ev
+}
 
-		if t.eraserActive {
-			eraserClicked = true
-			t.colorPickerOpen = false
-			t.widthPickerOpen = false
-		} else {
-			slidersChanged = true
+// syncSliders moves the sliders to the colour and width in t.state, which
+// the keyboard may have changed. A slider being dragged is left alone.
+func (t *Toolbar) syncSliders() {
+	pen := &t.state.Pen
+	set := func(slider *widget.Float, value float32) {
+		if !slider.Dragging() {
+			slider.Value = max(0, min(1, value))
 		}
 	}
+	set(&t.redSlider, float32(pen.Color.R)/255)
+	set(&t.greenSlider, float32(pen.Color.G)/255)
+	set(&t.blueSlider, float32(pen.Color.B)/255)
+	set(&t.alphaSlider, float32(pen.Color.A)/255)
+	set(&t.widthSlider, (pen.WidthDp-minSliderWidth)/(maxSliderWidth-minSliderWidth))
+}
+
+// ShowSaveDialog opens the save dialog, which also holds the exports, on the
+// next call to HandleEvents, as if the save button had been clicked.
+func (t *Toolbar) ShowSaveDialog() {
+	t.hidden = false
+	t.showSaveDialog = true
+}
+
+// ShowLoadDialog does the same for the load dialog.
+func (t *Toolbar) ShowLoadDialog() {
+	t.hidden = false
+	t.showLoadDialog = true
+}
+
+func (t *Toolbar) openSaveDialog(gtx layout.Context, ev *Events) {
+	t.saveDialogOpen = true
+	t.saveError = ""
+	t.clearOverwrite()
+	t.titleEditor.SetText(t.meta.Title)
+	t.descriptionEditor.SetText(t.meta.Description)
+	t.tagsEditor.SetText(strings.Join(t.meta.Tags, ", "))
+	t.authorEditor.SetText(t.meta.Author)
+	t.stopReplay(ev)
+	t.colorPickerOpen = false
+	t.widthPickerOpen = false
+	t.shapesPickerOpen = false
+	t.loadDialogOpen = false
+	gtx.Execute(key.FocusCmd{Tag: &t.filenameEditor})
+}
+
+func (t *Toolbar) openLoadDialog(gtx layout.Context, ev *Events) {
+	t.loadDialogOpen = true
+	t.loadError = ""
+	t.stopReplay(ev)
+	t.colorPickerOpen = false
+	t.widthPickerOpen = false
+	t.shapesPickerOpen = false
+	t.saveDialogOpen = false
+	t.openFileBrowser(gtx)
+}
+
+// requestTimelapseExport does nothing while a timelapse export is running;
+// the application refuses a second one too.
+func (t *Toolbar) requestTimelapseExport(ev *Events, exportFormat ExportFormat) {
+	if t.exporting {
+		return
+	}
+	if t.requestExport(ev, exportFormat) {
+		ev.ExportFrameRate = timelapseFrameRates[t.frameRateIndex]
+		ev.ExportSpeedUp = timelapseSpeedUps[t.speedUpIndex]
+	}
+}
+
+// requestExport asks for an export under the name in the save dialog. It is
+// taken as a confirmation if the application reported with ExportExists
+// that this very target is already there.
+func (t *Toolbar) requestExport(ev *Events, exportFormat ExportFormat) bool {
+	name, ok := t.validSaveName()
+	if !ok {
+		return false
+	}
+	ev.ExportRequested = true
+	ev.ExportFormat = exportFormat
+	ev.ExportFilename = name
+	ev.ExportOverwrite = t.overwriteByExport && t.pendingOverwrite == exportFormat.Target(name)
+	return true
+}
+
+func (t *Toolbar) validSaveName() (string, bool) {
+	name := canvas.CleanName(t.filenameEditor.Text())
+	if err := canvas.ValidateName(name); err != nil {
+		t.saveError = errorText(err)
+		return "", false
+	}
+	t.saveError = ""
+	return name, true
+}
+
+// editedMetadata returns t.meta with the fields from the save dialog.
+func (t *Toolbar) editedMetadata() canvas.Metadata {
+	meta := t.meta
+	meta.Title = strings.TrimSpace(t.titleEditor.Text())
+	meta.Description = strings.TrimSpace(t.descriptionEditor.Text())
+	meta.Tags = canvas.ParseTags(t.tagsEditor.Text())
+	meta.Author = strings.TrimSpace(t.authorEditor.Text())
+	return meta
+}
+
+// SetMetadata tells the toolbar about the metadata of the drawing on screen,
+// after it was loaded or saved.
+func (t *Toolbar) SetMetadata(meta canvas.Metadata) {
+	t.meta = meta
+}
+
+func (t *Toolbar) documentExists(name string) bool {
+	_, err := t.storage.Stat(name)
+	return err == nil
+}
+
+// SaveFinished closes the save dialog after a successful save or export, or
+// keeps it open with the error shown under the filename.
+func (t *Toolbar) SaveFinished(err error) {
+	t.clearOverwrite()
+	if err != nil {
+		t.saveError = errorText(err)
+		return
+	}
+	t.saveError = ""
+	t.saveDialogOpen = false
+}
+
+// TimelapseStarted shows in the save dialog that a timelapse export is
+// running in the background.
+func (t *Toolbar) TimelapseStarted() {
+	t.clearOverwrite()
+	t.exporting = true
+}
+
+// ExportExists keeps the save dialog open when the target of the requested
+// export is already there. Clicking the same export again replaces it, like
+// Overwrite does for drawings.
+func (t *Toolbar) ExportExists(target string) {
+	t.pendingOverwrite = target
+	t.overwriteByExport = true
+}
+
+func (t *Toolbar) clearOverwrite() {
+	t.pendingOverwrite = ""
+	t.overwriteByExport = false
+}
 
-	if t.redSlider.Value != t.prevRedValue ||
-		t.greenSlider.Value != t.prevGreenValue ||
-		t.blueSlider.Value != t.prevBlueValue ||
-		t.widthSlider.Value != t.prevWidthValue {
-		slidersChanged = true
-		t.eraserActive = false
-		t.prevRedValue = t.redSlider.Value
-		t.prevGreenValue = t.greenSlider.Value
-		t.prevBlueValue = t.blueSlider.Value
-		t.prevWidthValue = t.widthSlider.Value
+// TimelapseFinished reports the end of the export announced by
+// TimelapseStarted like SaveFinished does for other exports.
+func (t *Toolbar) TimelapseFinished(err error) {
+	t.exporting = false
+	if err != nil {
+		t.saveError = errorText(err)
+		return
+	}
+	t.saveDialogOpen = false
+}
+
+// LoadFinished works like SaveFinished for the load dialog.
+func (t *Toolbar) LoadFinished(name string, err error) {
+	switch {
+	case err == nil:
+		t.loadError = ""
+		t.loadDialogOpen = false
+	case errors.Is(err, fs.ErrNotExist):
+		t.loadError = fmt.Sprintf("No drawing named %q", name)
+	default:
+		t.loadError = errorText(err)
+	}
+}
+
+// ImportFinished works like LoadFinished for files imported by path.
+func (t *Toolbar) ImportFinished(path string, err error) {
+	switch {
+	case err == nil:
+		t.loadError = ""
+		t.loadDialogOpen = false
+		t.browser.importEditor.SetText("")
+	case errors.Is(err, fs.ErrNotExist):
+		t.loadError = fmt.Sprintf("No file %q", path)
+	default:
+		t.loadError = errorText(err)
 	}
+}
 
-	currentColor = color.NRGBA{
-		R: uint8(t.redSlider.Value * 255),
-		G: uint8(t.greenSlider.Value * 255),
-		B: uint8(t.blueSlider.Value * 255),
-		A: 255,
+func errorText(err error) string {
+	text := err.Error()
+	if text == "" {
+		return text
 	}
+	return strings.ToUpper(text[:1]) + text[1:]
+}
 
-	currentWidth = 2 + (t.widthSlider.Value * 18)
+func (t *Toolbar) sliderColor() color.NRGBA {
+	return color.NRGBA{
+		R: uint8(t.redSlider.Value*255 + 0.5),
+		G: uint8(t.greenSlider.Value*255 + 0.5),
+		B: uint8(t.blueSlider.Value*255 + 0.5),
+		A: uint8(t.alphaSlider.Value*255 + 0.5),
+	}
+}
 
-	return currentColor, currentWidth, eraserClicked, slidersChanged, selectedShape, saveRequested, saveFilename, loadRequested, loadFilename
+func (t *Toolbar) sliderWidth() float32 {
+	return minSliderWidth + t.widthSlider.Value*(maxSliderWidth-minSliderWidth)
 }
 
 func (t *Toolbar) Layout(gtx layout.Context) layout.Dimensions {
+	t.syncSliders()
 	return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
 		layout.Flexed(1, layout.Spacer{}.Layout),
 		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
@@ -260,7 +636,9 @@ func (t *Toolbar) Layout(gtx layout.Context) layout.Dimensions {
 					return t.layoutMainButtons(gtx)
 				}),
 				layout.Rigid(func(gtx layout.Context) layout.Dimensions {
-					if t.colorPickerOpen {
+					if t.recovery.open {
+						return t.layoutRecoveryPrompt(gtx)
+					} else if t.colorPickerOpen {
 						return t.layoutColorPicker(gtx)
 					} else if t.widthPickerOpen {
 						return t.layoutWidthPicker(gtx)
@@ -268,6 +646,8 @@ func (t *Toolbar) Layout(gtx layout.Context) layout.Dimensions {
 						return t.layoutShapesPicker(gtx)
 					} else if t.saveDialogOpen {
 						return t.layoutSaveDialog(gtx)
+					} else if t.replay.open {
+						return t.layoutReplayPanel(gtx)
 					} else if t.loadDialogOpen {
 						return t.layoutLoadDialog(gtx)
 					}
@@ -310,7 +690,7 @@ func (t *Toolbar) layoutMainButtons(gtx layout.Context) layout.Dimensions {
 			layout.Rigid(layout.Spacer{Height: 10}.Layout),
 			layout.Rigid(func(gtx layout.Context) layout.Dimensions {
 				btn := material.Button(t.theme, &t.eraserButton, "Eraser")
-				if t.eraserActive {
+				if t.state.Erasing() {
 					btn.Background = color.NRGBA{R: 100, G: 180, B: 255, A: 255}
 				} else {
 					btn.Background = color.NRGBA{R: 220, G: 220, B: 220, A: 220}
@@ -318,6 +698,16 @@ func (t *Toolbar) layoutMainButtons(gtx layout.Context) layout.Dimensions {
 				return btn.Layout(gtx)
 			}),
 			layout.Rigid(layout.Spacer{Height: 10}.Layout),
+			layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+				btn := material.Button(t.theme, &t.moveButton, "Move")
+				if t.state.Tool == tool.MoveTool {
+					btn.Background = color.NRGBA{R: 100, G: 180, B: 255, A: 255}
+				} else {
+					btn.Background = color.NRGBA{R: 70, G: 70, B: 70, A: 220}
+				}
+				return btn.Layout(gtx)
+			}),
+			layout.Rigid(layout.Spacer{Height: 10}.Layout),
 			layout.Rigid(func(gtx layout.Context) layout.Dimensions {
 				btn := material.Button(t.theme, &t.shapesButton, "Shapes")
 				btn.Background = color.NRGBA{R: 70, G: 70, B: 70, A: 220}
@@ -335,6 +725,16 @@ func (t *Toolbar) layoutMainButtons(gtx layout.Context) layout.Dimensions {
 				btn.Background = color.NRGBA{R: 50, G: 100, B: 200, A: 220}
 				return btn.Layout(gtx)
 			}),
+			layout.Rigid(layout.Spacer{Height: 10}.Layout),
+			layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+				btn := material.Button(t.theme, &t.replayButton, "Replay")
+				if t.replay.open {
+					btn.Background = color.NRGBA{R: 100, G: 180, B: 255, A: 255}
+				} else {
+					btn.Background = color.NRGBA{R: 70, G: 70, B: 70, A: 220}
+				}
+				return btn.Layout(gtx)
+			}),
 		)
 	})
 }
@@ -347,36 +747,43 @@ func (t *Toolbar) layoutColorPicker(gtx layout.Context) layout.Dimensions {
 
 func (t *Toolbar) layoutWidthPicker(gtx layout.Context) layout.Dimensions {
 	return t.drawPanel(gtx, func(gtx layout.Context) layout.Dimensions {
-		return t.layoutWidthSlider(gtx)
+		return layout.Flex{Axis: layout.Vertical, Spacing: layout.SpaceStart}.Layout(gtx,
+			layout.Rigid(t.layoutWidthSlider),
+			layout.Rigid(layout.Spacer{Height: 15}.Layout),
+			layout.Rigid(t.layoutLineStyle),
+		)
 	})
 }
 
 func (t *Toolbar) layoutShapesPicker(gtx layout.Context) layout.Dimensions {
+	shapeButton := func(button *widget.Clickable, label string, active bool) layout.FlexChild {
+		return layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			btn := material.Button(t.theme, button, label)
+			if active {
+				btn.Background = color.NRGBA{R: 100, G: 180, B: 255, A: 255}
+			} else {
+				btn.Background = color.NRGBA{R: 80, G: 120, B: 180, A: 220}
+			}
+			return btn.Layout(gtx)
+		})
+	}
+	isShape := func(shapeType tool.ShapeType) bool {
+		return t.state.Tool == tool.ShapeTool && t.state.Shape.Type == shapeType
+	}
+
 	return t.drawPanel(gtx, func(gtx layout.Context) layout.Dimensions {
 		return layout.Flex{Axis: layout.Vertical, Spacing: layout.SpaceStart}.Layout(gtx,
-			layout.Rigid(func(gtx layout.Context) layout.Dimensions {
-				btn := material.Button(t.theme, &t.circleButton, "Circle")
-				btn.Background = color.NRGBA{R: 80, G: 120, B: 180, A: 220}
-				return btn.Layout(gtx)
-			}),
+			shapeButton(&t.penButton, "Pen", t.state.Tool == tool.PenTool),
 			layout.Rigid(layout.Spacer{Height: 5}.Layout),
-			layout.Rigid(func(gtx layout.Context) layout.Dimensions {
-				btn := material.Button(t.theme, &t.rectangleButton, "Rectangle")
-				btn.Background = color.NRGBA{R: 80, G: 120, B: 180, A: 220}
-				return btn.Layout(gtx)
-			}),
+			shapeButton(&t.circleButton, "Circle", isShape(tool.Circle)),
 			layout.Rigid(layout.Spacer{Height: 5}.Layout),
-			layout.Rigid(func(gtx layout.Context) layout.Dimensions {
-				btn := material.Button(t.theme, &t.lineButton, "Line")
-				btn.Background = color.NRGBA{R: 80, G: 120, B: 180, A: 220}
-				return btn.Layout(gtx)
-			}),
+			shapeButton(&t.rectangleButton, "Rectangle", isShape(tool.Rectangle)),
 			layout.Rigid(layout.Spacer{Height: 5}.Layout),
-			layout.Rigid(func(gtx layout.Context) layout.Dimensions {
-				btn := material.Button(t.theme, &t.arrowButton, "Arrow")
-				btn.Background = color.NRGBA{R: 80, G: 120, B: 180, A: 220}
-				return btn.Layout(gtx)
-			}),
+			shapeButton(&t.lineButton, "Line", isShape(tool.Line)),
+			layout.Rigid(layout.Spacer{Height: 5}.Layout),
+			shapeButton(&t.arrowButton, "Arrow", isShape(tool.Arrow)),
+			layout.Rigid(layout.Spacer{Height: 15}.Layout),
+			layout.Rigid(t.layoutArrowOptions),
 		)
 	})
 }
@@ -403,133 +810,143 @@ func (t *Toolbar) layoutSaveDialog(gtx layout.Context) layout.Dimensions {
 				editor.TextSize = 14
 				return editor.Layout(gtx)
 			}),
+			layout.Rigid(layout.Spacer{Height: 10}.Layout),
+			t.metadataField(&t.titleEditor, "Title"),
+			t.metadataField(&t.descriptionEditor, "Description"),
+			t.metadataField(&t.tagsEditor, "Tags, comma separated"),
+			t.metadataField(&t.authorEditor, "Author"),
 			layout.Rigid(layout.Spacer{Height: 5}.Layout),
 			layout.Rigid(func(gtx layout.Context) layout.Dimensions {
-				label := material.Caption(t.theme, "Saved to ~/.screenpen/")
-				label.Color = color.NRGBA{R: 100, G: 100, B: 100, A: 255}
+				gtx.Constraints.Max.X = gtx.Dp(320)
+				text := "Saved to " + t.saveLocation
+				col := color.NRGBA{R: 100, G: 100, B: 100, A: 255}
+				if t.saveError != "" {
+					text = t.saveError
+					col = color.NRGBA{R: 200, G: 40, B: 40, A: 255}
+				} else if t.overwriteByExport {
+					text = fmt.Sprintf("%q already exists. Export again to replace it.", t.pendingOverwrite)
+					col = color.NRGBA{R: 200, G: 120, B: 0, A: 255}
+				} else if t.pendingOverwrite != "" {
+					text = fmt.Sprintf("%q already exists. Press Overwrite to replace it.", t.pendingOverwrite)
+					col = color.NRGBA{R: 200, G: 120, B: 0, A: 255}
+				} else if t.exporting {
+					text = "Exporting…"
+				}
+				label := material.Caption(t.theme, text)
+				label.Color = col
 				return label.Layout(gtx)
 			}),
-			layout.Rigid(layout.Spacer{Height: 15}.Layout),
+			layout.Rigid(layout.Spacer{Height: 10}.Layout),
+			layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+				btn := material.Button(t.theme, &t.templateButton, "PDF page: "+t.pdfTemplate.String())
+				btn.Background = color.NRGBA{R: 100, G: 100, B: 100, A: 200}
+				return btn.Layout(gtx)
+			}),
+			layout.Rigid(layout.Spacer{Height: 5}.Layout),
 			layout.Rigid(func(gtx layout.Context) layout.Dimensions {
 				return layout.Flex{Axis: layout.Horizontal, Spacing: layout.SpaceStart}.Layout(gtx,
 					layout.Rigid(func(gtx layout.Context) layout.Dimensions {
-						btn := material.Button(t.theme, &t.confirmSaveButton, "Save")
-						btn.Background = color.NRGBA{R: 50, G: 150, B: 50, A: 255}
+						text := fmt.Sprintf("%g fps", timelapseFrameRates[t.frameRateIndex])
+						btn := material.Button(t.theme, &t.frameRateButton, text)
+						btn.Background = color.NRGBA{R: 100, G: 100, B: 100, A: 200}
 						return btn.Layout(gtx)
 					}),
-					layout.Rigid(layout.Spacer{Width: 10}.Layout),
+					layout.Rigid(layout.Spacer{Width: 5}.Layout),
 					layout.Rigid(func(gtx layout.Context) layout.Dimensions {
-						btn := material.Button(t.theme, &t.cancelSaveButton, "Cancel")
-						btn.Background = color.NRGBA{R: 150, G: 50, B: 50, A: 255}
+						text := fmt.Sprintf("%g× speed", timelapseSpeedUps[t.speedUpIndex])
+						btn := material.Button(t.theme, &t.speedUpButton, text)
+						btn.Background = color.NRGBA{R: 100, G: 100, B: 100, A: 200}
 						return btn.Layout(gtx)
 					}),
-				)
-			}),
-		)
-	})
-}
-
-func (t *Toolbar) layoutLoadDialog(gtx layout.Context) layout.Dimensions {
-	return t.drawPanel(gtx, func(gtx layout.Context) layout.Dimensions {
-		return layout.Flex{Axis: layout.Vertical, Spacing: layout.SpaceStart}.Layout(gtx,
-			layout.Rigid(func(gtx layout.Context) layout.Dimensions {
-				return layout.Flex{Axis: layout.Horizontal, Spacing: layout.SpaceBetween}.Layout(gtx,
+					layout.Rigid(layout.Spacer{Width: 5}.Layout),
 					layout.Rigid(func(gtx layout.Context) layout.Dimensions {
-						label := material.Body1(t.theme, "Load Drawing")
-						label.Font.Weight = 700
-						return label.Layout(gtx)
+						btn := material.Button(t.theme, &t.exportGIFButton, "GIF")
+						btn.Background = color.NRGBA{R: 120, G: 90, B: 160, A: 255}
+						return btn.Layout(gtx)
 					}),
+					layout.Rigid(layout.Spacer{Width: 5}.Layout),
 					layout.Rigid(func(gtx layout.Context) layout.Dimensions {
-						btn := material.Button(t.theme, &t.refreshListButton, "↻")
-						btn.Background = color.NRGBA{R: 100, G: 100, B: 100, A: 200}
+						btn := material.Button(t.theme, &t.exportPNGsButton, "PNGs")
+						btn.Background = color.NRGBA{R: 120, G: 90, B: 160, A: 255}
 						return btn.Layout(gtx)
 					}),
 				)
 			}),
-			layout.Rigid(layout.Spacer{Height: 10}.Layout),
-			layout.Rigid(func(gtx layout.Context) layout.Dimensions {
-				label := material.Body2(t.theme, "Saved files:")
-				return label.Layout(gtx)
-			}),
-			layout.Rigid(layout.Spacer{Height: 5}.Layout),
+			layout.Rigid(layout.Spacer{Height: 15}.Layout),
 			layout.Rigid(func(gtx layout.Context) layout.Dimensions {
-				if len(t.savedFiles) == 0 {
-					label := material.Caption(t.theme, "No saved files found")
-					label.Color = color.NRGBA{R: 150, G: 150, B: 150, A: 255}
-					return label.Layout(gtx)
-				}
-
-				return layout.Flex{Axis: layout.Vertical, Spacing: layout.SpaceStart}.Layout(gtx,
-					func() []layout.FlexChild {
-						var children []layout.FlexChild
-						for i, filename := range t.savedFiles {
-							idx := i
-							name := filename
-							children = append(children,
-								layout.Rigid(func(gtx layout.Context) layout.Dimensions {
-									btn := material.Button(t.theme, &t.fileButtons[idx], name)
-									btn.Background = color.NRGBA{R: 70, G: 120, B: 200, A: 220}
-									return btn.Layout(gtx)
-								}),
-							)
-							if i < len(t.savedFiles)-1 {
-								children = append(children, layout.Rigid(layout.Spacer{Height: 3}.Layout))
-							}
+				return layout.Flex{Axis: layout.Horizontal, Spacing: layout.SpaceStart}.Layout(gtx,
+					layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+						if t.pendingOverwrite != "" && !t.overwriteByExport {
+							btn := material.Button(t.theme, &t.confirmSaveButton, "Overwrite")
+							btn.Background = color.NRGBA{R: 200, G: 120, B: 0, A: 255}
+							return btn.Layout(gtx)
 						}
-						return children
-					}()...,
+						btn := material.Button(t.theme, &t.confirmSaveButton, "Save")
+						btn.Background = color.NRGBA{R: 50, G: 150, B: 50, A: 255}
+						return btn.Layout(gtx)
+					}),
+					layout.Rigid(layout.Spacer{Width: 10}.Layout),
+					layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+						btn := material.Button(t.theme, &t.cancelSaveButton, "Cancel")
+						btn.Background = color.NRGBA{R: 150, G: 50, B: 50, A: 255}
+						return btn.Layout(gtx)
+					}),
 				)
 			}),
 			layout.Rigid(layout.Spacer{Height: 10}.Layout),
 			layout.Rigid(func(gtx layout.Context) layout.Dimensions {
-				label := material.Caption(t.theme, "or enter filename:")
-				label.Color = color.NRGBA{R: 100, G: 100, B: 100, A: 255}
-				return label.Layout(gtx)
-			}),
-			layout.Rigid(layout.Spacer{Height: 5}.Layout),
-			layout.Rigid(func(gtx layout.Context) layout.Dimensions {
-				gtx.Constraints.Min.X = gtx.Dp(200)
-				gtx.Constraints.Max.X = gtx.Dp(200)
-				editor := material.Editor(t.theme, &t.loadFilenameEditor, "")
-				editor.TextSize = 14
-				return editor.Layout(gtx)
+				return layout.Flex{Axis: layout.Horizontal, Alignment: layout.Middle}.Layout(gtx,
+					layout.Rigid(material.Body2(t.theme, "Export:").Layout),
+					t.exportButton(&t.exportSVGButton, "SVG"),
+					t.exportButton(&t.exportPDFButton, "PDF"),
+					t.exportButton(&t.exportXoppButton, "XOPP"),
+					t.exportButton(&t.exportInkMLButton, "InkML"),
+					t.exportButton(&t.exportExcalidrawButton, "Excalidraw"),
+				)
 			}),
 			layout.Rigid(layout.Spacer{Height: 10}.Layout),
 			layout.Rigid(func(gtx layout.Context) layout.Dimensions {
-				return layout.Flex{Axis: layout.Horizontal, Spacing: layout.SpaceStart}.Layout(gtx,
+				return layout.Flex{Axis: layout.Horizontal, Alignment: layout.Middle}.Layout(gtx,
+					layout.Rigid(material.Body2(t.theme, "Plotter:").Layout),
 					layout.Rigid(func(gtx layout.Context) layout.Dimensions {
-						btn := material.Button(t.theme, &t.confirmLoadButton, "Load")
-						btn.Background = color.NRGBA{R: 50, G: 100, B: 200, A: 255}
-						return btn.Layout(gtx)
-					}),
-					layout.Rigid(layout.Spacer{Width: 10}.Layout),
-					layout.Rigid(func(gtx layout.Context) layout.Dimensions {
-						btn := material.Button(t.theme, &t.cancelLoadButton, "Cancel")
-						btn.Background = color.NRGBA{R: 150, G: 50, B: 50, A: 255}
-						return btn.Layout(gtx)
+						return layout.Inset{Left: 8}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+							btn := material.Button(t.theme, &t.paperButton, "Paper: "+t.plotPaper.String())
+							btn.Background = color.NRGBA{R: 100, G: 100, B: 100, A: 200}
+							return btn.Layout(gtx)
+						})
 					}),
+					t.exportButton(&t.exportHPGLButton, "HPGL"),
+					t.exportButton(&t.exportGCodeButton, "G-code"),
 				)
 			}),
 		)
 	})
 }
 
-func (t *Toolbar) IsDialogOpen() bool {
-	return t.saveDialogOpen || t.loadDialogOpen
+func (t *Toolbar) exportButton(button *widget.Clickable, label string) layout.FlexChild {
+	return layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+		return layout.Inset{Left: 8}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+			btn := material.Button(t.theme, button, label)
+			btn.Background = color.NRGBA{R: 120, G: 90, B: 160, A: 255}
+			return btn.Layout(gtx)
+		})
+	})
 }
 
-func (t *Toolbar) refreshFileList() {
-	files, err := canvas.ListSavedFiles()
-	if err != nil {
-		t.savedFiles = nil
-		t.fileButtons = nil
-		return
-	}
+func (t *Toolbar) metadataField(editor *widget.Editor, hint string) layout.FlexChild {
+	return layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+		gtx.Constraints.Min.X = gtx.Dp(320)
+		gtx.Constraints.Max.X = gtx.Dp(320)
+		return layout.Inset{Bottom: 5}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+			e := material.Editor(t.theme, editor, hint)
+			e.TextSize = 14
+			return e.Layout(gtx)
+		})
+	})
+}
 
-	t.savedFiles = files
-	if len(t.fileButtons) != len(files) {
-		t.fileButtons = make([]widget.Clickable, len(files))
-	}
+func (t *Toolbar) IsDialogOpen(gtx layout.Context) bool {
+	return t.saveDialogOpen || t.loadDialogOpen || gtx.Focused(&t.lineStyle.customEditor)
 }
 
 func (t *Toolbar) drawPanel(gtx layout.Context, w layout.Widget) layout.Dimensions {
@@ -555,14 +972,21 @@ func (t *Toolbar) layoutColorSliders(gtx layout.Context) layout.Dimensions {
 
 	return layout.Flex{Axis: layout.Vertical, Spacing: layout.SpaceStart}.Layout(gtx,
 		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
-			previewColor := color.NRGBA{
-				R: uint8(t.redSlider.Value * 255),
-				G: uint8(t.greenSlider.Value * 255),
-				B: uint8(t.blueSlider.Value * 255),
-				A: 255,
-			}
+			previewColor := t.sliderColor()
 			size := gtx.Dp(60)
 			defer clip.Rect{Max: image.Pt(size, size)}.Push(gtx.Ops).Pop()
+			// Checkerboard so that translucent colours are visible.
+			cell := size / 6
+			for y := 0; y*cell < size; y++ {
+				for x := 0; x*cell < size; x++ {
+					shade := uint8(255)
+					if (x+y)%2 == 1 {
+						shade = 200
+					}
+					paint.FillShape(gtx.Ops, color.NRGBA{R: shade, G: shade, B: shade, A: 255},
+						clip.Rect{Min: image.Pt(x*cell, y*cell), Max: image.Pt((x+1)*cell, (y+1)*cell)}.Op())
+				}
+			}
 			paint.ColorOp{Color: previewColor}.Add(gtx.Ops)
 			paint.PaintOp{}.Add(gtx.Ops)
 			return layout.Dimensions{Size: image.Pt(size, size)}
@@ -621,6 +1045,28 @@ func (t *Toolbar) layoutColorSliders(gtx layout.Context) layout.Dimensions {
 				}),
 			)
 		}),
+		layout.Rigid(layout.Spacer{Height: 5}.Layout),
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			return layout.Flex{Axis: layout.Horizontal}.Layout(gtx,
+				layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+					label := material.Body1(t.theme, "A")
+					label.Color = color.NRGBA{R: 150, G: 150, B: 150, A: 255}
+					return label.Layout(gtx)
+				}),
+				layout.Rigid(layout.Spacer{Width: 5}.Layout),
+				layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+					gtx.Constraints.Min.X = gtx.Dp(150)
+					gtx.Constraints.Max.X = gtx.Dp(150)
+					slider := material.Slider(t.theme, &t.alphaSlider)
+					slider.Color = color.NRGBA{R: 150, G: 150, B: 150, A: 255}
+					return slider.Layout(gtx)
+				}),
+				layout.Rigid(layout.Spacer{Width: 5}.Layout),
+				layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+					return material.Body2(t.theme, fmt.Sprintf("%d%%", int(t.alphaSlider.Value*100+0.5))).Layout(gtx)
+				}),
+			)
+		}),
 	)
 }
 
@@ -641,8 +1087,7 @@ func (t *Toolbar) layoutWidthSlider(gtx layout.Context) layout.Dimensions {
 		}),
 		layout.Rigid(layout.Spacer{Height: 10}.Layout),
 		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
-			currentWidth := 2 + (t.widthSlider.Value * 18)
-			label := material.Body2(t.theme, fmt.Sprintf("%.1f dp", currentWidth))
+			label := material.Body2(t.theme, fmt.Sprintf("%.1f dp", t.sliderWidth()))
 			return label.Layout(gtx)
 		}),
 	)